@@ -2,3 +2,9 @@ package base
 
 type PageNumber uint64
 type FrameID uint64
+
+// SlotID identifies a cell inside a slotted page
+type SlotID uint16
+
+// LSN is the position of a record in the write-ahead log, 0 means no record
+type LSN uint64
@@ -5,4 +5,37 @@ type DiskOperation string
 const (
 	ReadOp  DiskOperation = "read"
 	WriteOp DiskOperation = "write"
+	SyncOp  DiskOperation = "sync"
 )
+
+// Priority is the class of a disk request, lower classes are served first
+type Priority uint8
+
+const (
+	// ForegroundRead is a page a caller is waiting for
+	ForegroundRead Priority = iota
+	// EvictionWrite frees a frame a foreground read is waiting for
+	EvictionWrite
+	// CheckpointWrite writes back a page nobody is waiting for
+	CheckpointWrite
+	// PrefetchRead loads a page before anyone asks for it
+	PrefetchRead
+
+	// PriorityClasses is the number of classes
+	PriorityClasses
+)
+
+func (p Priority) String() string {
+	switch p {
+	case ForegroundRead:
+		return "foreground read"
+	case EvictionWrite:
+		return "eviction write"
+	case CheckpointWrite:
+		return "checkpoint write"
+	case PrefetchRead:
+		return "prefetch read"
+	default:
+		return "unknown"
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/dark-vinci/nildb/constants"
 	"github.com/dark-vinci/nildb/faces"
+	"github.com/dark-vinci/nildb/utils"
 )
 
 type Block struct {
@@ -27,26 +29,29 @@ func NewBlock(
 	}
 }
 
+// Write stores buff at pageNumber. Reads and writes are positional, so
+// they can run concurrently on different pages.
 func (b *Block) Write(pageNumber int, buff []byte) error {
 	offset := int64(b.pageSize * pageNumber)
 
-	if _, err := b.ioOperator.Seek(offset, io.SeekStart); err != nil {
-		fmt.Println("Seek error:", err)
-		return err
-	}
-
-	if _, err := b.ioOperator.Write(buff); err != nil {
+	if _, err := b.ioOperator.WriteAt(buff, offset); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// Flush has nothing to do, writes go straight to the operator
 func (b *Block) Flush() error {
 	return nil
 }
 
+// Sync makes every write done so far durable
 func (b *Block) Sync() error {
+	if err := b.Flush(); err != nil {
+		return err
+	}
+
 	if err := b.ioOperator.Sync(); err != nil {
 		return err
 	}
@@ -54,6 +59,8 @@ func (b *Block) Sync() error {
 	return nil
 }
 
+// Read reads the page at pageNumber into buff, a page past the end of the
+// file fails with io.EOF whatever the block size
 func (b *Block) Read(pageNumber int, buff []byte) error {
 	var (
 		capacity    int
@@ -73,28 +80,138 @@ func (b *Block) Read(pageNumber int, buff []byte) error {
 		pageOffset = pageNumber*b.pageSize - offset
 	}
 
-	_, err := b.ioOperator.Seek(int64(blockOffset), io.SeekStart)
-	if err != nil {
-		fmt.Println("Error: file cannot be seeked", err)
+	// the last page of the file may be short, the missing part reads as zeros
+	if b.pageSize >= b.blockSize {
+		n, err := b.ioOperator.ReadAt(buff[:b.pageSize], int64(blockOffset))
+		if err == io.EOF && n > 0 {
+			clear(buff[n:b.pageSize])
+			return nil
+		}
+
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("file cannot be read: %w", err)
+		}
+
 		return err
 	}
 
-	if b.pageSize >= b.blockSize {
-		_, err := b.ioOperator.Read(buff)
-		if err != nil {
-			fmt.Println("Error: file cannot be read", err)
-			return err
-		}
+	block := utils.AlignedBuffer(capacity, constants.PageAlignment)
+
+	n, err := b.ioOperator.ReadAt(block, int64(blockOffset))
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("file cannot be read: %w", err)
 	}
 
-	block := make([]byte, capacity)
-	_, err = b.ioOperator.Read(block)
-	if err != nil {
-		fmt.Println("Error: file cannot be read", err)
-		return err
+	// the block may hold the end of the file before the page
+	if pageOffset >= n {
+		return io.EOF
 	}
 
 	copy(buff, block[pageOffset:pageOffset+b.pageSize])
 
 	return nil
 }
+
+// ReadPages reads each page of pageNumbers into the buffer of the same
+// index and returns the error of each. Runs of consecutive page numbers,
+// in the given order, are read with one call to the operator. The last
+// page of the file may be short, the missing part reads as zeros, and a
+// page past the end fails with io.EOF.
+func (b *Block) ReadPages(pageNumbers []int, buffs [][]byte) []error {
+	errs := make([]error, len(pageNumbers))
+
+	for start, end := 0, 0; start < len(pageNumbers); start = end {
+		end = runEnd(pageNumbers, start)
+
+		b.readRun(pageNumbers[start], buffs[start:end], errs[start:end])
+	}
+
+	return errs
+}
+
+// WritePages stores each buffer at the page of the same index and returns
+// the error of each. Runs of consecutive page numbers, in the given order,
+// are written with one call to the operator.
+func (b *Block) WritePages(pageNumbers []int, buffs [][]byte) []error {
+	errs := make([]error, len(pageNumbers))
+
+	for start, end := 0, 0; start < len(pageNumbers); start = end {
+		end = runEnd(pageNumbers, start)
+
+		if end-start == 1 {
+			errs[start] = b.Write(pageNumbers[start], buffs[start])
+			continue
+		}
+
+		run := utils.AlignedBuffer((end-start)*b.pageSize, constants.PageAlignment)
+
+		for i, buff := range buffs[start:end] {
+			copy(run[i*b.pageSize:], buff[:b.pageSize])
+		}
+
+		err := b.Write(pageNumbers[start], run)
+
+		for i := start; i < end; i++ {
+			errs[i] = err
+		}
+	}
+
+	return errs
+}
+
+// runEnd returns the end of the run of consecutive page numbers at start
+func runEnd(pageNumbers []int, start int) int {
+	end := start + 1
+
+	for end < len(pageNumbers) && pageNumbers[end] == pageNumbers[end-1]+1 {
+		end++
+	}
+
+	return end
+}
+
+// readRun reads the consecutive pages from first into buffs, whole blocks
+// at a time when pages are smaller than blocks
+func (b *Block) readRun(first int, buffs [][]byte, errs []error) {
+	var (
+		start = first * b.pageSize
+		end   = start + len(buffs)*b.pageSize
+	)
+
+	if b.pageSize < b.blockSize {
+		start &^= b.blockSize - 1
+		end = (end + b.blockSize - 1) &^ (b.blockSize - 1)
+	}
+
+	region := utils.AlignedBuffer(end-start, constants.PageAlignment)
+
+	n, err := b.ioOperator.ReadAt(region, int64(start))
+	if err != nil && err != io.EOF {
+		for i := range errs {
+			errs[i] = err
+		}
+
+		return
+	}
+
+	for i, buff := range buffs {
+		offset := (first+i)*b.pageSize - start
+
+		// bytes past n were not read and are still zeros
+		if offset >= n {
+			errs[i] = io.EOF
+		} else {
+			copy(buff[:b.pageSize], region[offset:offset+b.pageSize])
+		}
+	}
+}
+
+// IOOperator returns the file the block reads and writes
+func (b *Block) IOOperator() faces.IOOperator {
+	return b.ioOperator
+}
+
+// PageSize returns the size of the pages read and written through the block
+func (b *Block) PageSize() int {
+	return b.pageSize
+}
@@ -0,0 +1,191 @@
+package btree
+
+import (
+	"bytes"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/overflow"
+	"github.com/dark-vinci/nildb/pages"
+)
+
+// BTree is a B+TREE whose nodes are slotted pages. Leaves hold the entries
+// and are linked both ways for range scans, internal nodes hold separators.
+// The root keeps its page number for the lifetime of the tree.
+type BTree struct {
+	pager   Pager
+	root    base.PageNumber
+	maxCell int
+}
+
+// New allocates an empty root leaf and returns the tree
+func New(pager Pager) (*BTree, error) {
+	t := &BTree{pager: pager}
+
+	root, err := t.allocate(true)
+	if err != nil {
+		return nil, err
+	}
+
+	defer t.release(root)
+
+	t.root = root.pn
+	t.maxCell = maxCellSize(root.page)
+
+	return t, nil
+}
+
+// Open returns the tree stored under root
+func Open(pager Pager, root base.PageNumber) (*BTree, error) {
+	t := &BTree{pager: pager, root: root}
+
+	n, err := t.fetch(root)
+	if err != nil {
+		return nil, err
+	}
+
+	defer t.release(n)
+
+	t.maxCell = maxCellSize(n.page)
+
+	return t, nil
+}
+
+// maxCellSize keeps at least four cells per node, so a split or a
+// redistribution always leaves both halves within a page
+func maxCellSize(page *pages.Page) int {
+	return page.Capacity()/4 - pages.SlotSize
+}
+
+// Root returns the page number of the root node
+func (t *BTree) Root() base.PageNumber {
+	return t.root
+}
+
+func (t *BTree) fetch(pn base.PageNumber) (*node, error) {
+	fr, err := t.pager.GetPage(pn, true)
+	if err != nil {
+		return nil, err
+	}
+
+	page, ok := fr.Page.(*pages.Page)
+	if !ok {
+		t.pager.ReleasePage(pn)
+		return nil, errors.ErrNotANode
+	}
+
+	return &node{pn: pn, page: page}, nil
+}
+
+func (t *BTree) release(n *node) {
+	t.pager.ReleasePage(n.pn)
+}
+
+func (t *BTree) dirty(n *node) {
+	t.pager.MarkDirty(n.pn)
+}
+
+// allocate returns a new pinned empty node
+func (t *BTree) allocate(leaf bool) (*node, error) {
+	handle, pn, err := t.pager.GetNewPage(true)
+	if err != nil {
+		return nil, err
+	}
+
+	page, ok := (*handle).(*pages.Page)
+	if !ok {
+		t.pager.ReleasePage(pn)
+		return nil, errors.ErrNotANode
+	}
+
+	page.Reset()
+	page.SetLeaf(leaf)
+	page.SetLeft(0)
+	page.SetRight(0)
+
+	n := &node{pn: pn, page: page}
+	t.dirty(n)
+
+	return n, nil
+}
+
+// Get returns a copy of the value stored under key
+func (t *BTree) Get(key []byte) ([]byte, error) {
+	n, err := t.findLeaf(key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer t.release(n)
+
+	i, found := n.searchLeaf(key)
+	if !found {
+		return nil, errors.ErrKeyNotFound
+	}
+
+	return t.valueOf(n.cell(i))
+}
+
+// findLeaf descends to the pinned leaf that covers key
+func (t *BTree) findLeaf(key []byte) (*node, error) {
+	n, err := t.fetch(t.root)
+	if err != nil {
+		return nil, err
+	}
+
+	for !n.page.IsLeaf() {
+		child := n.child(n.searchInternal(key))
+		t.release(n)
+
+		if n, err = t.fetch(child); err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// checkSize refuses keys that cannot be stored inline, values of any size
+// are moved to an overflow chain
+func (t *BTree) checkSize(key []byte) error {
+	if keyLenSize+len(key)+overflowRefSize > t.maxCell || childSize+len(key) > t.maxCell {
+		return errors.ErrEntryTooLarge
+	}
+
+	return nil
+}
+
+// makeCell builds the leaf cell for an entry, writing the value to an
+// overflow chain when the entry does not fit in a node
+func (t *BTree) makeCell(key, value []byte) ([]byte, error) {
+	if cell := leafCell(key, value); len(cell) <= t.maxCell {
+		return cell, nil
+	}
+
+	head, err := overflow.Write(t.pager, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return overflowCell(key, head, len(value)), nil
+}
+
+// valueOf returns a copy of the value of a leaf cell
+func (t *BTree) valueOf(cell []byte) ([]byte, error) {
+	if isOverflowCell(cell) {
+		return overflow.Read(t.pager, overflowHead(cell))
+	}
+
+	_, value := decodeLeaf(cell)
+
+	return bytes.Clone(value), nil
+}
+
+// freeValue releases the overflow chain of a leaf cell, if it has one
+func (t *BTree) freeValue(cell []byte) error {
+	if !isOverflowCell(cell) {
+		return nil
+	}
+
+	return overflow.Free(t.pager, overflowHead(cell))
+}
@@ -0,0 +1,355 @@
+package btree
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/interfaces"
+	"github.com/dark-vinci/nildb/pager/pagertest"
+)
+
+func testKey(i int) []byte {
+	return []byte(fmt.Sprintf("key-%06d", i))
+}
+
+func testValue(i int) []byte {
+	return bytes.Repeat([]byte{byte(i)}, 20+i%50)
+}
+
+func sequence(n int) []int {
+	keys := make([]int, n)
+
+	for i := range keys {
+		keys[i] = i
+	}
+
+	return keys
+}
+
+func newTestTree(t *testing.T) (*BTree, *pagertest.MemPager) {
+	t.Helper()
+
+	p := pagertest.NewMemPager(constants.DefaultPageSize)
+
+	tree, err := New(p)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+
+	return tree, p
+}
+
+func fill(t *testing.T, tree *BTree, keys []int) {
+	t.Helper()
+
+	for _, k := range keys {
+		if err := tree.Insert(testKey(k), testValue(k)); err != nil {
+			t.Fatalf("insert %d failed: %v", k, err)
+		}
+	}
+}
+
+// TestInsertAndGet verifies point lookups after inserts in different orders
+func TestInsertAndGet(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []int
+	}{
+		{name: "Ascending", keys: sequence(3000)},
+		{name: "Random", keys: rand.New(rand.NewSource(2)).Perm(3000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, p := newTestTree(t)
+			fill(t, tree, tt.keys)
+
+			for _, k := range tt.keys {
+				got, err := tree.Get(testKey(k))
+				if err != nil {
+					t.Fatalf("get %d failed: %v", k, err)
+				}
+
+				if !bytes.Equal(got, testValue(k)) {
+					t.Fatalf("wrong value for key %d", k)
+				}
+			}
+
+			if _, err := tree.Get([]byte("missing")); err != errors.ErrKeyNotFound {
+				t.Errorf("expected ErrKeyNotFound, got %v", err)
+			}
+
+			if p.Pinned() != 0 {
+				t.Errorf("expected every page to be released, %d pins left", p.Pinned())
+			}
+
+			if p.Allocated() < 10 {
+				t.Errorf("expected the tree to have split into many nodes, got %d", p.Allocated())
+			}
+		})
+	}
+}
+
+// TestInsertReplace verifies inserting an existing key replaces its value
+func TestInsertReplace(t *testing.T) {
+	tree, _ := newTestTree(t)
+
+	if err := tree.Insert([]byte("k"), []byte("old")); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	if err := tree.Insert([]byte("k"), []byte("new value")); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	got, err := tree.Get([]byte("k"))
+	if err != nil || string(got) != "new value" {
+		t.Errorf("expected %q, got %q (%v)", "new value", got, err)
+	}
+}
+
+// failingPager refuses new pages once its budget is spent, a negative
+// budget never runs out
+type failingPager struct {
+	*pagertest.MemPager
+	budget int
+}
+
+func (f *failingPager) GetNewPage(pin bool) (*faces.PageHandle, base.PageNumber, error) {
+	if f.budget == 0 {
+		return nil, 0, errors.ErrNoFreeFrame
+	}
+
+	f.budget--
+
+	return f.MemPager.GetNewPage(pin)
+}
+
+// TestInsertFailure verifies an insert that cannot get the pages its
+// splits need leaves the tree, the old value and the pins as they were,
+// whichever level runs out
+func TestInsertFailure(t *testing.T) {
+	const keys = 3000
+
+	p := &failingPager{MemPager: pagertest.NewMemPager(constants.DefaultPageSize), budget: -1}
+
+	tree, err := New(p)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+
+	fill(t, tree, sequence(keys))
+
+	var (
+		added    [][]byte
+		replaced = make(map[int]bool)
+		refused  int
+		big      = func(key []byte) []byte { return bytes.Repeat([]byte{0xff}, tree.maxCell-keyLenSize-len(key)) }
+	)
+
+	// failed checks the insert of key failed and changed nothing
+	failed := func(err error, key []byte, allocated int) {
+		t.Helper()
+
+		if err != errors.ErrNoFreeFrame {
+			t.Fatalf("expected ErrNoFreeFrame for %q, got %v", key, err)
+		}
+
+		if p.Pinned() != 0 {
+			t.Fatalf("%d pins left after a failed insert", p.Pinned())
+		}
+
+		if p.Allocated() != allocated {
+			t.Fatalf("expected %d pages after a failed insert, got %d", allocated, p.Allocated())
+		}
+	}
+
+	for k := 0; k < keys; k += 101 {
+		// big values fill the leaf of k until a split runs out of pages
+		p.budget = k % 3
+
+		for j := 0; ; j++ {
+			var (
+				key       = []byte(fmt.Sprintf("%s-%02d", testKey(k), j))
+				allocated = p.Allocated()
+			)
+
+			if err := tree.Insert(key, big(key)); err != nil {
+				failed(err, key, allocated)
+
+				if _, err := tree.Get(key); err != errors.ErrKeyNotFound {
+					t.Fatalf("expected %q to be missing, got %v", key, err)
+				}
+
+				break
+			}
+
+			added = append(added, key)
+		}
+
+		// the leaf that ran out is full, replacing the value of the key
+		// after the failed one with a bigger one needs a split too
+		var (
+			next      = testKey(k + 1)
+			allocated = p.Allocated()
+		)
+
+		p.budget = 0
+
+		err := tree.Insert(next, big(next))
+		if err == nil {
+			replaced[k+1] = true
+			continue
+		}
+
+		failed(err, next, allocated)
+		refused++
+	}
+
+	if refused == 0 {
+		t.Fatalf("expected some replaces to run out of pages")
+	}
+
+	for k := range keys {
+		want := testValue(k)
+		if replaced[k] {
+			want = big(testKey(k))
+		}
+
+		if got, err := tree.Get(testKey(k)); err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("wrong value for key %d: %v", k, err)
+		}
+	}
+
+	for _, key := range added {
+		if got, err := tree.Get(key); err != nil || !bytes.Equal(got, big(key)) {
+			t.Fatalf("wrong value for %q: %v", key, err)
+		}
+	}
+}
+
+// TestEntryTooLarge verifies keys that would not leave room for a split are refused
+func TestEntryTooLarge(t *testing.T) {
+	tree, _ := newTestTree(t)
+
+	if err := tree.Insert(make([]byte, constants.DefaultPageSize/2), []byte("v")); err != errors.ErrEntryTooLarge {
+		t.Errorf("expected ErrEntryTooLarge, got %v", err)
+	}
+}
+
+// TestLargeValues verifies values bigger than a node go through overflow chains
+func TestLargeValues(t *testing.T) {
+	tree, p := newTestTree(t)
+	fill(t, tree, sequence(200))
+
+	base := p.Allocated()
+	large := bytes.Repeat([]byte(`{"json":"blob"}`), 2000)
+
+	if err := tree.Insert([]byte("blob"), large); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	got, err := tree.Get([]byte("blob"))
+	if err != nil || !bytes.Equal(got, large) {
+		t.Fatalf("expected large value back, got %d bytes (%v)", len(got), err)
+	}
+
+	// replacing the value frees the old chain
+	if err := tree.Insert([]byte("blob"), large[:5000]); err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+
+	got, err = tree.Get([]byte("blob"))
+	if err != nil || !bytes.Equal(got, large[:5000]) {
+		t.Fatalf("expected replaced value back, got %d bytes (%v)", len(got), err)
+	}
+
+	if err := tree.Delete([]byte("blob")); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	if p.Allocated() != base {
+		t.Errorf("expected overflow pages to be freed, %d pages in use instead of %d", p.Allocated(), base)
+	}
+
+	if p.Pinned() != 0 {
+		t.Errorf("expected every page to be released, %d pins left", p.Pinned())
+	}
+}
+
+// TestDelete verifies deletes with merges and redistributions keep the tree consistent
+func TestDelete(t *testing.T) {
+	const n = 3000
+
+	tree, p := newTestTree(t)
+	fill(t, tree, rand.New(rand.NewSource(3)).Perm(n))
+
+	order := rand.New(rand.NewSource(4)).Perm(n)
+	deleted := make(map[int]bool)
+
+	for i, k := range order {
+		if err := tree.Delete(testKey(k)); err != nil {
+			t.Fatalf("delete %d failed: %v", k, err)
+		}
+
+		deleted[k] = true
+
+		// check the whole tree every now and then
+		if i%500 != 0 {
+			continue
+		}
+
+		for j := 0; j < n; j++ {
+			_, err := tree.Get(testKey(j))
+			if deleted[j] && err != errors.ErrKeyNotFound {
+				t.Fatalf("expected key %d to be deleted, got %v", j, err)
+			}
+
+			if !deleted[j] && err != nil {
+				t.Fatalf("expected key %d to exist, got %v", j, err)
+			}
+		}
+
+		count := 0
+		_ = tree.Scan(nil, nil, func(key, value []byte) bool {
+			count++
+			return true
+		})
+
+		if count != n-len(deleted) {
+			t.Fatalf("expected scan to see %d keys, got %d", n-len(deleted), count)
+		}
+	}
+
+	if err := tree.Delete(testKey(0)); err != errors.ErrKeyNotFound {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	if p.Allocated() != 1 {
+		t.Errorf("expected only the root to be left, got %d pages", p.Allocated())
+	}
+
+	if p.Pinned() != 0 {
+		t.Errorf("expected every page to be released, %d pins left", p.Pinned())
+	}
+}
+
+// TestReopen verifies a tree can be opened again from its root page
+func TestReopen(t *testing.T) {
+	tree, p := newTestTree(t)
+	fill(t, tree, rand.New(rand.NewSource(5)).Perm(500))
+
+	reopened, err := Open(p, tree.Root())
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	if got, err := reopened.Get(testKey(42)); err != nil || !bytes.Equal(got, testValue(42)) {
+		t.Errorf("expected key 42 in reopened tree, got %v", err)
+	}
+}
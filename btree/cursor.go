@@ -0,0 +1,207 @@
+package btree
+
+import (
+	"bytes"
+
+	"github.com/dark-vinci/nildb/base"
+)
+
+// Cursor walks the leaves of the tree in key order, in both directions.
+// The current leaf stays pinned until the cursor moves off it or is closed.
+type Cursor struct {
+	tree  *BTree
+	leaf  *node
+	index int
+}
+
+// Cursor returns an unpositioned cursor, call First, Last or Seek before use
+func (t *BTree) Cursor() *Cursor {
+	return &Cursor{tree: t}
+}
+
+// Valid reports whether the cursor is positioned on an entry
+func (c *Cursor) Valid() bool {
+	return c.leaf != nil && c.index >= 0 && c.index < c.leaf.len()
+}
+
+// Key returns the key under the cursor, it is only valid until the cursor moves
+func (c *Cursor) Key() []byte {
+	if !c.Valid() {
+		return nil
+	}
+
+	return c.leaf.key(c.index)
+}
+
+// Value returns a copy of the value under the cursor, reading its overflow
+// chain if it has one
+func (c *Cursor) Value() ([]byte, error) {
+	if !c.Valid() {
+		return nil, nil
+	}
+
+	return c.tree.valueOf(c.leaf.cell(c.index))
+}
+
+// Close releases the pinned leaf
+func (c *Cursor) Close() {
+	if c.leaf != nil {
+		c.tree.release(c.leaf)
+		c.leaf = nil
+	}
+}
+
+// First moves to the smallest key
+func (c *Cursor) First() error {
+	if err := c.descend(func(n *node) int { return 0 }); err != nil {
+		return err
+	}
+
+	c.index = 0
+
+	return c.skipForward()
+}
+
+// Last moves to the largest key
+func (c *Cursor) Last() error {
+	if err := c.descend(func(n *node) int { return n.len() }); err != nil {
+		return err
+	}
+
+	c.index = c.leaf.len() - 1
+
+	return c.skipBackward()
+}
+
+// Seek moves to the first key >= key
+func (c *Cursor) Seek(key []byte) error {
+	if err := c.descend(func(n *node) int { return n.searchInternal(key) }); err != nil {
+		return err
+	}
+
+	c.index, _ = c.leaf.searchLeaf(key)
+
+	return c.skipForward()
+}
+
+// Next moves to the following key, the cursor is invalid past the last key
+func (c *Cursor) Next() error {
+	if !c.Valid() {
+		return nil
+	}
+
+	c.index++
+
+	return c.skipForward()
+}
+
+// Prev moves to the preceding key, the cursor is invalid before the first key
+func (c *Cursor) Prev() error {
+	if !c.Valid() {
+		return nil
+	}
+
+	c.index--
+
+	return c.skipBackward()
+}
+
+// descend pins the leaf reached by following pick from the root
+func (c *Cursor) descend(pick func(n *node) int) error {
+	c.Close()
+
+	n, err := c.tree.fetch(c.tree.root)
+	if err != nil {
+		return err
+	}
+
+	for !n.page.IsLeaf() {
+		child := n.child(pick(n))
+		c.tree.release(n)
+
+		if n, err = c.tree.fetch(child); err != nil {
+			return err
+		}
+	}
+
+	c.leaf = n
+
+	return nil
+}
+
+// moveTo swaps the pinned leaf for pn, zero leaves the cursor invalid
+func (c *Cursor) moveTo(pn base.PageNumber) error {
+	c.Close()
+
+	if pn == 0 {
+		return nil
+	}
+
+	n, err := c.tree.fetch(pn)
+	if err != nil {
+		return err
+	}
+
+	c.leaf = n
+
+	return nil
+}
+
+// skipForward follows right links until the index points at an entry
+func (c *Cursor) skipForward() error {
+	for c.leaf != nil && c.index >= c.leaf.len() {
+		if err := c.moveTo(c.leaf.page.Right()); err != nil {
+			return err
+		}
+
+		c.index = 0
+	}
+
+	return nil
+}
+
+// skipBackward follows left links until the index points at an entry
+func (c *Cursor) skipBackward() error {
+	for c.leaf != nil && c.index < 0 {
+		if err := c.moveTo(c.leaf.page.Left()); err != nil {
+			return err
+		}
+
+		if c.leaf != nil {
+			c.index = c.leaf.len() - 1
+		}
+	}
+
+	return nil
+}
+
+// Scan calls fn for every entry with start <= key < end in order, until fn
+// returns false. A nil start or end leaves that side of the range open.
+func (t *BTree) Scan(start, end []byte, fn func(key, value []byte) bool) error {
+	c := t.Cursor()
+	defer c.Close()
+
+	var err error
+	if start == nil {
+		err = c.First()
+	} else {
+		err = c.Seek(start)
+	}
+
+	for ; err == nil && c.Valid(); err = c.Next() {
+		if end != nil && bytes.Compare(c.Key(), end) >= 0 {
+			return nil
+		}
+
+		value, err := c.Value()
+		if err != nil {
+			return err
+		}
+
+		if !fn(c.Key(), value) {
+			return nil
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,137 @@
+package btree
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// TestCursorForward verifies a forward walk sees every key in order
+func TestCursorForward(t *testing.T) {
+	const n = 2000
+
+	tree, p := newTestTree(t)
+	fill(t, tree, rand.New(rand.NewSource(6)).Perm(n))
+
+	c := tree.Cursor()
+
+	i := 0
+	for err := c.First(); c.Valid(); err = c.Next() {
+		if err != nil {
+			t.Fatalf("cursor failed: %v", err)
+		}
+
+		if !bytes.Equal(c.Key(), testKey(i)) {
+			t.Fatalf("expected key %s, got %s", testKey(i), c.Key())
+		}
+
+		value, err := c.Value()
+		if err != nil || !bytes.Equal(value, testValue(i)) {
+			t.Fatalf("wrong value for key %s", c.Key())
+		}
+
+		i++
+	}
+
+	c.Close()
+
+	if i != n {
+		t.Errorf("expected %d keys, got %d", n, i)
+	}
+
+	if p.Pinned() != 0 {
+		t.Errorf("expected every page to be released, %d pins left", p.Pinned())
+	}
+}
+
+// TestCursorBackward verifies a backward walk sees every key in reverse order
+func TestCursorBackward(t *testing.T) {
+	const n = 2000
+
+	tree, p := newTestTree(t)
+	fill(t, tree, rand.New(rand.NewSource(7)).Perm(n))
+
+	c := tree.Cursor()
+
+	i := n - 1
+	for err := c.Last(); c.Valid(); err = c.Prev() {
+		if err != nil {
+			t.Fatalf("cursor failed: %v", err)
+		}
+
+		if !bytes.Equal(c.Key(), testKey(i)) {
+			t.Fatalf("expected key %s, got %s", testKey(i), c.Key())
+		}
+
+		i--
+	}
+
+	c.Close()
+
+	if i != -1 {
+		t.Errorf("expected to walk back to the first key, stopped at %d", i)
+	}
+
+	if p.Pinned() != 0 {
+		t.Errorf("expected every page to be released, %d pins left", p.Pinned())
+	}
+}
+
+// TestCursorSeek verifies seeking positions on the first key >= the target
+func TestCursorSeek(t *testing.T) {
+	tree, _ := newTestTree(t)
+
+	for i := 0; i < 1000; i += 2 {
+		fill(t, tree, []int{i})
+	}
+
+	tests := []struct {
+		name   string
+		target []byte
+		want   []byte
+	}{
+		{name: "Exact key", target: testKey(500), want: testKey(500)},
+		{name: "Between keys", target: testKey(501), want: testKey(502)},
+		{name: "Before first", target: []byte("a"), want: testKey(0)},
+		{name: "After last", target: testKey(999), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tree.Cursor()
+			defer c.Close()
+
+			if err := c.Seek(tt.target); err != nil {
+				t.Fatalf("seek failed: %v", err)
+			}
+
+			if !bytes.Equal(c.Key(), tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, c.Key())
+			}
+		})
+	}
+}
+
+// TestScanRange verifies Scan honours both ends of the range
+func TestScanRange(t *testing.T) {
+	tree, _ := newTestTree(t)
+	fill(t, tree, rand.New(rand.NewSource(8)).Perm(1000))
+
+	var got [][]byte
+	err := tree.Scan(testKey(100), testKey(200), func(key, value []byte) bool {
+		got = append(got, bytes.Clone(key))
+		return true
+	})
+
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+
+	if len(got) != 100 {
+		t.Fatalf("expected 100 keys, got %d", len(got))
+	}
+
+	if !bytes.Equal(got[0], testKey(100)) || !bytes.Equal(got[99], testKey(199)) {
+		t.Errorf("unexpected range bounds %s..%s", got[0], got[99])
+	}
+}
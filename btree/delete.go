@@ -0,0 +1,221 @@
+package btree
+
+import (
+	"bytes"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/errors"
+)
+
+// Delete removes key from the tree. Nodes left less than half full are
+// merged with, or borrow from, a sibling.
+func (t *BTree) Delete(key []byte) error {
+	if _, err := t.delete(t.root, key); err != nil {
+		return err
+	}
+
+	return t.collapseRoot()
+}
+
+func (t *BTree) delete(pn base.PageNumber, key []byte) (bool, error) {
+	n, err := t.fetch(pn)
+	if err != nil {
+		return false, err
+	}
+
+	defer t.release(n)
+
+	if n.page.IsLeaf() {
+		i, found := n.searchLeaf(key)
+		if !found {
+			return false, errors.ErrKeyNotFound
+		}
+
+		old := bytes.Clone(n.cell(i))
+
+		if err := n.page.RemoveAt(base.SlotID(i)); err != nil {
+			return false, err
+		}
+
+		t.dirty(n)
+
+		return isUnderflow(n), t.freeValue(old)
+	}
+
+	i := n.searchInternal(key)
+
+	underflow, err := t.delete(n.child(i), key)
+	if err != nil || !underflow {
+		return false, err
+	}
+
+	if err := t.rebalance(n, i); err != nil {
+		return false, err
+	}
+
+	return isUnderflow(n), nil
+}
+
+func isUnderflow(n *node) bool {
+	return int(n.page.FreeSpace())*2 > n.page.Capacity()
+}
+
+// rebalance fixes the underflowed i-th child of parent using a sibling
+func (t *BTree) rebalance(parent *node, i int) error {
+	if parent.len() == 0 {
+		return nil
+	}
+
+	// pair the child with its left sibling when there is one
+	li := i - 1
+	if i == 0 {
+		li = 0
+	}
+
+	left, err := t.fetch(parent.child(li))
+	if err != nil {
+		return err
+	}
+
+	defer t.release(left)
+
+	right, err := t.fetch(parent.child(li + 1))
+	if err != nil {
+		return err
+	}
+
+	defer t.release(right)
+
+	if left.page.IsLeaf() {
+		return t.rebalanceLeaves(parent, li, left, right)
+	}
+
+	return t.rebalanceInternals(parent, li, left, right)
+}
+
+func (t *BTree) rebalanceLeaves(parent *node, li int, left, right *node) error {
+	cells := append(left.cells(), right.cells()...)
+
+	if sizeOf(cells) <= left.page.Capacity() {
+		left.rebuild(cells)
+		left.page.SetRight(right.page.Right())
+		t.dirty(left)
+
+		if next := right.page.Right(); next != 0 {
+			nn, err := t.fetch(next)
+			if err != nil {
+				return err
+			}
+
+			nn.page.SetLeft(left.pn)
+			t.dirty(nn)
+			t.release(nn)
+		}
+
+		return t.dropSeparator(parent, li, left, right)
+	}
+
+	var (
+		mid    = splitPoint(cells)
+		key, _ = decodeLeaf(cells[mid])
+	)
+
+	if err := parent.page.Update(base.SlotID(li), internalCell(left.pn, key)); err != nil {
+		// the new separator does not fit in the parent, keep the
+		// underflowed node rather than failing the delete
+		if err == errors.ErrPageFull {
+			return nil
+		}
+
+		return err
+	}
+
+	left.rebuild(cells[:mid])
+	right.rebuild(cells[mid:])
+	t.dirty(left)
+	t.dirty(right)
+	t.dirty(parent)
+
+	return nil
+}
+
+func (t *BTree) rebalanceInternals(parent *node, li int, left, right *node) error {
+	// the separator comes down between both halves, pointing at the
+	// right-most child of the left node
+	_, sep := decodeInternal(parent.cell(li))
+
+	cells := append(left.cells(), internalCell(left.page.Right(), sep))
+	cells = append(cells, right.cells()...)
+
+	if sizeOf(cells) <= left.page.Capacity() {
+		left.rebuild(cells)
+		left.page.SetRight(right.page.Right())
+		t.dirty(left)
+
+		return t.dropSeparator(parent, li, left, right)
+	}
+
+	var (
+		mid        = splitPoint(cells)
+		child, key = decodeInternal(cells[mid])
+	)
+
+	if err := parent.page.Update(base.SlotID(li), internalCell(left.pn, key)); err != nil {
+		if err == errors.ErrPageFull {
+			return nil
+		}
+
+		return err
+	}
+
+	right.rebuild(cells[mid+1:])
+	left.rebuild(cells[:mid])
+	left.page.SetRight(child)
+	t.dirty(left)
+	t.dirty(right)
+	t.dirty(parent)
+
+	return nil
+}
+
+// dropSeparator removes the separator between two merged siblings from
+// the parent and frees the right one
+func (t *BTree) dropSeparator(parent *node, li int, left, right *node) error {
+	if err := parent.page.RemoveAt(base.SlotID(li)); err != nil {
+		return err
+	}
+
+	parent.setChild(li, left.pn)
+	t.dirty(parent)
+
+	return t.pager.FreePage(right.pn)
+}
+
+// collapseRoot pulls the only child of an empty internal root into the
+// root page, shrinking the height of the tree
+func (t *BTree) collapseRoot() error {
+	root, err := t.fetch(t.root)
+	if err != nil {
+		return err
+	}
+
+	defer t.release(root)
+
+	for !root.page.IsLeaf() && root.len() == 0 {
+		child, err := t.fetch(root.page.Right())
+		if err != nil {
+			return err
+		}
+
+		// an only child has no siblings, its links are already empty
+		root.page.CopyFrom(child.page)
+		t.dirty(root)
+		t.release(child)
+
+		if err := t.pager.FreePage(child.pn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
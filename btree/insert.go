@@ -0,0 +1,322 @@
+package btree
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/pages"
+)
+
+// split is what a full node hands to its parent: the separator and the
+// new node that takes the keys >= separator. Nothing is changed yet, the
+// nodes involved stay pinned until apply moves the keys or abort gives the
+// new node back, so a failure further up leaves the tree as it was.
+type split struct {
+	key   []byte
+	right base.PageNumber
+	apply func()
+	abort func()
+}
+
+// after chains s with the split of the child it makes room for, the child
+// is split first and both are dropped together
+func (s *split) after(child *split) *split {
+	apply, abort := s.apply, s.abort
+
+	s.apply = func() {
+		child.apply()
+		apply()
+	}
+
+	s.abort = func() {
+		abort()
+		child.abort()
+	}
+
+	return s
+}
+
+// Insert stores value under key, replacing any previous value. A failed
+// insert leaves the tree and the previous value as they were.
+func (t *BTree) Insert(key, value []byte) error {
+	if err := t.checkSize(key); err != nil {
+		return err
+	}
+
+	cell, err := t.makeCell(key, value)
+	if err != nil {
+		return err
+	}
+
+	s, old, err := t.insert(t.root, key, cell)
+	if err == nil && s != nil {
+		err = t.splitRoot(s)
+	}
+
+	if err != nil {
+		_ = t.freeValue(cell)
+		return err
+	}
+
+	// the old value is only freed once the new one is in the tree
+	if old == nil {
+		return nil
+	}
+
+	return t.freeValue(old)
+}
+
+// insert puts cell in the subtree at pn and returns the cell it replaced,
+// nil when the key is new. A node that has to split is left as it is, its
+// split is returned for the caller to apply once its own change is sure.
+func (t *BTree) insert(pn base.PageNumber, key, cell []byte) (*split, []byte, error) {
+	n, err := t.fetch(pn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if n.page.IsLeaf() {
+		var old []byte
+
+		i, found := n.searchLeaf(key)
+		if found {
+			old = bytes.Clone(n.cell(i))
+		}
+
+		s, err := t.putCell(n, i, cell, found)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return s, old, nil
+	}
+
+	i := n.searchInternal(key)
+	child := n.child(i)
+
+	s, old, err := t.insert(child, key, cell)
+	if err != nil || s == nil {
+		t.release(n)
+		return nil, old, err
+	}
+
+	// the old child keeps the keys below the separator, the entry that
+	// pointed at it now points at the new right node
+	var (
+		entry = internalCell(child, s.key)
+		cells = slices.Insert(n.cells(), i, entry)
+		last  = n.page.Right()
+	)
+
+	if i+1 < len(cells) {
+		_, key := decodeInternal(cells[i+1])
+		cells[i+1] = internalCell(s.right, key)
+	} else {
+		last = s.right
+	}
+
+	if n.page.CanFit(len(entry)) {
+		s.apply()
+
+		n.setChild(i, s.right)
+		err = n.page.InsertAt(base.SlotID(i), entry)
+		t.dirty(n)
+		t.release(n)
+
+		return nil, old, err
+	}
+
+	up, err := t.splitInternal(n, cells, last)
+	if err != nil {
+		s.abort()
+		return nil, nil, err
+	}
+
+	return up.after(s), old, nil
+}
+
+// putCell puts the cell at position i of a leaf, in place of the cell there
+// when replace is set. The leaf is released unless it has to split, the
+// split returned then holds it.
+func (t *BTree) putCell(n *node, i int, cell []byte, replace bool) (*split, error) {
+	fits := n.page.CanFit(len(cell))
+	if replace {
+		fits = pages.CellSize(len(cell)) <= int(n.page.FreeSpace())+pages.CellSize(len(n.cell(i)))
+	}
+
+	if fits {
+		defer t.release(n)
+
+		var err error
+		if replace {
+			err = n.page.Update(base.SlotID(i), cell)
+		} else {
+			err = n.page.InsertAt(base.SlotID(i), cell)
+		}
+
+		t.dirty(n)
+
+		return nil, err
+	}
+
+	cells := n.cells()
+	if replace {
+		cells[i] = cell
+	} else {
+		cells = slices.Insert(cells, i, cell)
+	}
+
+	return t.splitLeaf(n, cells)
+}
+
+// splitLeaf plans the split of n into the cells given, the new leaf goes
+// between n and its old right sibling. The leaf is released on error.
+func (t *BTree) splitLeaf(n *node, cells [][]byte) (*split, error) {
+	right, err := t.allocate(true)
+	if err != nil {
+		t.release(n)
+		return nil, err
+	}
+
+	var next *node
+
+	if pn := n.page.Right(); pn != 0 {
+		if next, err = t.fetch(pn); err != nil {
+			t.discard(right)
+			t.release(n)
+
+			return nil, err
+		}
+	}
+
+	var (
+		mid    = splitPoint(cells)
+		key, _ = decodeLeaf(cells[mid])
+	)
+
+	return &split{
+		key:   bytes.Clone(key),
+		right: right.pn,
+		apply: func() {
+			n.rebuild(cells[:mid])
+			right.rebuild(cells[mid:])
+
+			if next != nil {
+				next.page.SetLeft(right.pn)
+				t.dirty(next)
+				t.release(next)
+			}
+
+			right.page.SetRight(n.page.Right())
+			right.page.SetLeft(n.pn)
+			n.page.SetRight(right.pn)
+
+			t.dirty(right)
+			t.dirty(n)
+			t.release(right)
+			t.release(n)
+		},
+		abort: func() {
+			if next != nil {
+				t.release(next)
+			}
+
+			t.discard(right)
+			t.release(n)
+		},
+	}, nil
+}
+
+// splitInternal plans the split of n into the cells given, last being the
+// right-most child of them all. The node is released on error.
+func (t *BTree) splitInternal(n *node, cells [][]byte, last base.PageNumber) (*split, error) {
+	right, err := t.allocate(false)
+	if err != nil {
+		t.release(n)
+		return nil, err
+	}
+
+	var (
+		mid        = splitPoint(cells)
+		child, key = decodeInternal(cells[mid])
+	)
+
+	return &split{
+		key:   bytes.Clone(key),
+		right: right.pn,
+		apply: func() {
+			// the middle separator moves up, its child becomes the
+			// right-most child of the left half
+			right.rebuild(cells[mid+1:])
+			right.page.SetRight(last)
+
+			n.rebuild(cells[:mid])
+			n.page.SetRight(child)
+
+			t.dirty(right)
+			t.dirty(n)
+			t.release(right)
+			t.release(n)
+		},
+		abort: func() {
+			t.discard(right)
+			t.release(n)
+		},
+	}, nil
+}
+
+// discard gives back a node allocated for a split that did not happen
+func (t *BTree) discard(n *node) {
+	t.release(n)
+
+	// the page only leaks if it cannot be freed
+	_ = t.pager.FreePage(n.pn)
+}
+
+// splitRoot moves the old root into a new page and turns the root into an
+// internal node over both halves, so the root page number never changes
+func (t *BTree) splitRoot(s *split) error {
+	root, err := t.fetch(t.root)
+	if err != nil {
+		s.abort()
+		return err
+	}
+
+	defer t.release(root)
+
+	left, err := t.allocate(root.page.IsLeaf())
+	if err != nil {
+		s.abort()
+		return err
+	}
+
+	right, err := t.fetch(s.right)
+	if err != nil {
+		t.discard(left)
+		s.abort()
+
+		return err
+	}
+
+	defer t.release(left)
+	defer t.release(right)
+
+	s.apply()
+	left.page.CopyFrom(root.page)
+	t.dirty(left)
+
+	if left.page.IsLeaf() {
+		right.page.SetLeft(left.pn)
+		t.dirty(right)
+	}
+
+	root.page.Reset()
+	root.page.SetLeaf(false)
+	root.page.SetLeft(0)
+	root.page.SetRight(s.right)
+	err = root.page.InsertAt(0, internalCell(left.pn, s.key))
+	t.dirty(root)
+
+	return err
+}
@@ -0,0 +1,186 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/pages"
+)
+
+const (
+	keyLenSize = 2 // leaf cell: [key length][key][value]
+	childSize  = 8 // internal cell: [child page number][key]
+
+	// overflowFlag is set in the key length of leaf cells whose value lives
+	// in an overflow chain, the cell then holds [head page][value length]
+	overflowFlag    = 0x8000
+	overflowRefSize = 16
+)
+
+// node is a pinned B+TREE page
+type node struct {
+	pn   base.PageNumber
+	page *pages.Page
+}
+
+func leafCell(key, value []byte) []byte {
+	cell := make([]byte, keyLenSize+len(key)+len(value))
+
+	binary.LittleEndian.PutUint16(cell, uint16(len(key)))
+	copy(cell[keyLenSize:], key)
+	copy(cell[keyLenSize+len(key):], value)
+
+	return cell
+}
+
+func overflowCell(key []byte, head base.PageNumber, size int) []byte {
+	ref := make([]byte, overflowRefSize)
+
+	binary.LittleEndian.PutUint64(ref, uint64(head))
+	binary.LittleEndian.PutUint64(ref[8:], uint64(size))
+
+	cell := leafCell(key, ref)
+	binary.LittleEndian.PutUint16(cell, uint16(len(key))|overflowFlag)
+
+	return cell
+}
+
+// decodeLeaf returns the key and the value, or the overflow reference of the value
+func decodeLeaf(cell []byte) ([]byte, []byte) {
+	keyLen := int(binary.LittleEndian.Uint16(cell) &^ overflowFlag)
+
+	return cell[keyLenSize : keyLenSize+keyLen], cell[keyLenSize+keyLen:]
+}
+
+func isOverflowCell(cell []byte) bool {
+	return binary.LittleEndian.Uint16(cell)&overflowFlag != 0
+}
+
+// overflowHead returns the first page of the chain holding the value of the cell
+func overflowHead(cell []byte) base.PageNumber {
+	_, ref := decodeLeaf(cell)
+
+	return base.PageNumber(binary.LittleEndian.Uint64(ref))
+}
+
+func internalCell(child base.PageNumber, key []byte) []byte {
+	cell := make([]byte, childSize+len(key))
+
+	binary.LittleEndian.PutUint64(cell, uint64(child))
+	copy(cell[childSize:], key)
+
+	return cell
+}
+
+func decodeInternal(cell []byte) (base.PageNumber, []byte) {
+	return base.PageNumber(binary.LittleEndian.Uint64(cell)), cell[childSize:]
+}
+
+func (n *node) len() int {
+	return int(n.page.NumSlots())
+}
+
+func (n *node) cell(i int) []byte {
+	cell, _ := n.page.Get(base.SlotID(i))
+	return cell
+}
+
+func (n *node) key(i int) []byte {
+	if n.page.IsLeaf() {
+		key, _ := decodeLeaf(n.cell(i))
+		return key
+	}
+
+	_, key := decodeInternal(n.cell(i))
+
+	return key
+}
+
+// child returns the i-th child, i == len() is the right-most child
+func (n *node) child(i int) base.PageNumber {
+	if i == n.len() {
+		return n.page.Right()
+	}
+
+	child, _ := decodeInternal(n.cell(i))
+
+	return child
+}
+
+func (n *node) setChild(i int, pn base.PageNumber) {
+	if i == n.len() {
+		n.page.SetRight(pn)
+		return
+	}
+
+	// the child pointer has a fixed size, so it is patched in place
+	binary.LittleEndian.PutUint64(n.cell(i), uint64(pn))
+}
+
+// searchLeaf returns the position of the first key >= key and whether it matched
+func (n *node) searchLeaf(key []byte) (int, bool) {
+	i := sort.Search(n.len(), func(i int) bool {
+		return bytes.Compare(n.key(i), key) >= 0
+	})
+
+	return i, i < n.len() && bytes.Equal(n.key(i), key)
+}
+
+// searchInternal returns the position of the child that covers key.
+// Separators are the first key of their right subtree.
+func (n *node) searchInternal(key []byte) int {
+	return sort.Search(n.len(), func(i int) bool {
+		return bytes.Compare(n.key(i), key) > 0
+	})
+}
+
+// cells copies every cell out of the node
+func (n *node) cells() [][]byte {
+	out := make([][]byte, n.len())
+
+	for i := range out {
+		out[i] = bytes.Clone(n.cell(i))
+	}
+
+	return out
+}
+
+// rebuild replaces the cells of the node, keeping its header links
+func (n *node) rebuild(cells [][]byte) {
+	n.page.Reset()
+
+	for i, cell := range cells {
+		// callers only rebuild with cells that were checked to fit
+		_ = n.page.InsertAt(base.SlotID(i), cell)
+	}
+}
+
+func sizeOf(cells [][]byte) int {
+	total := 0
+
+	for _, cell := range cells {
+		total += pages.CellSize(len(cell))
+	}
+
+	return total
+}
+
+// splitPoint returns the index that splits cells in two halves of about the same size
+func splitPoint(cells [][]byte) int {
+	var (
+		half = sizeOf(cells) / 2
+		used = 0
+	)
+
+	for i, cell := range cells {
+		used += pages.CellSize(len(cell))
+
+		if used >= half {
+			return max(1, min(i+1, len(cells)-1))
+		}
+	}
+
+	return len(cells) - 1
+}
@@ -0,0 +1,17 @@
+package btree
+
+import (
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/frame"
+	"github.com/dark-vinci/nildb/interfaces"
+)
+
+// Pager is the part of pager.Pager the tree needs to store its nodes.
+// Pages handed out pinned must be given back through ReleasePage.
+type Pager interface {
+	GetPage(pn base.PageNumber, pin bool) (*frame.Frame, error)
+	GetNewPage(pin bool) (*faces.PageHandle, base.PageNumber, error)
+	ReleasePage(pn base.PageNumber)
+	FreePage(pn base.PageNumber) error
+	MarkDirty(pn base.PageNumber)
+}
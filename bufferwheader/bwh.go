@@ -36,7 +36,8 @@ func Allocate[H any](size int) []byte {
 		panic(fmt.Sprintf("Attempt to allocate size: %v that does not match PageAlignment: %v", size, constants.PageAlignment))
 	}
 
-	return make([]byte, size)
+	// aligned so direct I/O reads and writes the page in place
+	return utils.AlignedBuffer(size, constants.PageAlignment)
 }
 
 func NewBufferWithHeader[H any](size int) *BufferWithHeader[H] {
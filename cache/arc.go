@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"container/list"
+
+	"github.com/dark-vinci/nildb/base"
+)
+
+// arc splits the cache between pages used once (t1) and pages used again
+// (t2), and remembers the pages each of them evicted lately (b1, b2). A
+// page asked for again after leaving t1 grows the share of t1, one that
+// left t2 grows the share of t2.
+type arc struct {
+	t1, t2 *list.List // resident pages, most recent at the front
+	b1, b2 *list.List // ghosts of the pages evicted from t1 and t2
+	frames map[base.FrameID]*list.Element
+	ghosts map[base.PageNumber]*list.Element
+	size   int
+	target int // pages t1 should hold
+}
+
+func newARC(size int) *arc {
+	return &arc{
+		t1:     list.New(),
+		t2:     list.New(),
+		b1:     list.New(),
+		b2:     list.New(),
+		frames: make(map[base.FrameID]*list.Element),
+		ghosts: make(map[base.PageNumber]*list.Element),
+		size:   size,
+	}
+}
+
+func (a *arc) placed(frameID base.FrameID, pageNumber base.PageNumber, cold bool) {
+	e := &entry{frame: frameID, page: pageNumber, cold: cold}
+
+	// a page read ahead proves nothing until it is used
+	if !cold && a.adapt(pageNumber) {
+		e.list = a.t2
+	} else {
+		e.list = a.t1
+	}
+
+	a.frames[frameID] = e.list.PushFront(e)
+}
+
+func (a *arc) accessed(frameID base.FrameID) {
+	var (
+		elem = a.frames[frameID]
+		e    = elem.Value.(*entry)
+	)
+
+	if e.cold {
+		e.cold = false
+
+		if !a.adapt(e.page) {
+			a.t1.MoveToFront(elem)
+			return
+		}
+	}
+
+	a.move(elem, a.t2)
+}
+
+func (a *arc) removed(frameID base.FrameID, pageNumber base.PageNumber, evicted bool) {
+	var (
+		elem = a.frames[frameID]
+		e    = elem.Value.(*entry)
+	)
+
+	e.list.Remove(elem)
+	delete(a.frames, frameID)
+
+	if !evicted || e.cold {
+		return
+	}
+
+	ghosts := a.b1
+	if e.list == a.t2 {
+		ghosts = a.b2
+	}
+
+	a.ghosts[pageNumber] = ghosts.PushFront(&entry{page: pageNumber, list: ghosts})
+
+	// t1 and b1 never remember more than the cache holds, all lists twice that
+	for a.t1.Len()+a.b1.Len() > a.size && a.b1.Len() > 0 {
+		a.forget(a.b1.Back())
+	}
+
+	for a.t1.Len()+a.t2.Len()+a.b1.Len()+a.b2.Len() > 2*a.size && a.b2.Len() > 0 {
+		a.forget(a.b2.Back())
+	}
+}
+
+func (a *arc) pinned(base.FrameID, bool) {}
+
+func (a *arc) hot(frameID base.FrameID) bool {
+	return a.frames[frameID].Value.(*entry).list == a.t2
+}
+
+// victim takes the least recently used page of t1 while it is over its
+// share, of t2 otherwise
+func (a *arc) victim(evictable func(base.FrameID) bool) (base.FrameID, bool) {
+	first, second := a.t2, a.t1
+
+	if a.t1.Len() > 0 && a.t1.Len() > a.target {
+		first, second = a.t1, a.t2
+	}
+
+	if frameID, ok := oldest(first, evictable); ok {
+		return frameID, true
+	}
+
+	return oldest(second, evictable)
+}
+
+// adapt moves the share of t1 towards the list that evicted pageNumber
+// lately and reports whether one did
+func (a *arc) adapt(pageNumber base.PageNumber) bool {
+	elem, ok := a.ghosts[pageNumber]
+	if !ok {
+		return false
+	}
+
+	if elem.Value.(*entry).list == a.b1 {
+		a.target = min(a.size, a.target+max(1, a.b2.Len()/a.b1.Len()))
+	} else {
+		a.target = max(0, a.target-max(1, a.b1.Len()/a.b2.Len()))
+	}
+
+	a.forget(elem)
+
+	return true
+}
+
+// forget drops a ghost
+func (a *arc) forget(elem *list.Element) {
+	e := elem.Value.(*entry)
+
+	e.list.Remove(elem)
+	delete(a.ghosts, e.page)
+}
+
+// move puts the page of elem at the front of to
+func (a *arc) move(elem *list.Element, to *list.List) {
+	e := elem.Value.(*entry)
+
+	e.list.Remove(elem)
+	e.list = to
+	a.frames[e.frame] = to.PushFront(e)
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/dark-vinci/nildb/base"
 	"github.com/dark-vinci/nildb/constants"
@@ -14,6 +15,8 @@ type Builder struct {
 	PinPercentageLimit float32
 	lruK               uint
 	crp                uint64
+	replacement        Replacement
+	shards             uint
 }
 
 func NewBuilder() *Builder {
@@ -23,6 +26,8 @@ func NewBuilder() *Builder {
 		PinPercentageLimit: constants.DefaultPinPercentageLimit,
 		lruK:               constants.DefaultLruK,
 		crp:                constants.DefaultCRP,
+		replacement:        LRUK,
+		shards:             constants.DefaultCacheShards,
 	}
 }
 
@@ -65,8 +70,30 @@ func (b *Builder) CorrelatedReferencePeriod(crp uint64) *Builder {
 	return b
 }
 
+// SetReplacement sets the policy picking the page a full cache gives up
+func (b *Builder) SetReplacement(replacement Replacement) *Builder {
+	if !replacement.Valid() {
+		panic(fmt.Sprintf("unknown replacement policy %d", replacement))
+	}
+
+	b.replacement = replacement
+
+	return b
+}
+
+// SetShards sets the number of shards BuildPool splits the frames into
+func (b *Builder) SetShards(shards uint) *Builder {
+	if shards == 0 {
+		panic("a pool needs at least one shard")
+	}
+
+	b.shards = shards
+
+	return b
+}
+
 func (b *Builder) Build() *Cache {
-	return &Cache{
+	c := &Cache{
 		Buffer:             make([]*frame.Frame, 0, b.MaxSize),
 		Pages:              make(map[base.PageNumber]base.FrameID, b.MaxSize),
 		MaxSize:            b.MaxSize,
@@ -76,5 +103,36 @@ func (b *Builder) Build() *Cache {
 		K:                  b.lruK,
 		CRP:                b.crp,
 		CurrentTime:        0,
+		Replacement:        b.replacement,
 	}
+
+	c.policy = newPolicy(b.replacement, c)
+	c.loaded = sync.NewCond(&c.lock)
+
+	return c
+}
+
+// BuildPool builds a Pool of the configured number of shards sharing
+// MaxSize frames, each shard is a Cache built with the other settings
+func (b *Builder) BuildPool() *Pool {
+	if b.MaxSize/b.shards < constants.MinCacheSize {
+		panic(fmt.Sprintf("every shard needs at least %d frames, %d frames make %d shards of %d",
+			constants.MinCacheSize, b.MaxSize, b.shards, b.MaxSize/b.shards))
+	}
+
+	p := &Pool{shards: make([]*Cache, b.shards)}
+
+	for i := range p.shards {
+		shard := *b
+		shard.MaxSize = b.MaxSize / b.shards
+
+		// the frames left over go to the first shards
+		if uint(i) < b.MaxSize%b.shards {
+			shard.MaxSize++
+		}
+
+		p.shards[i] = shard.Build()
+	}
+
+	return p
 }
@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"sync"
+
 	"github.com/dark-vinci/nildb/base"
 	"github.com/dark-vinci/nildb/frame"
 )
@@ -15,6 +17,11 @@ type Cache struct {
 	K                  uint
 	CRP                uint64
 	CurrentTime        uint64
+	Replacement        Replacement
+	policy             policy
+	free               []base.FrameID // invalidated frames, reused before any victim
+	lock               sync.RWMutex   // taken by the callers sharing the cache, like Pool
+	loaded             *sync.Cond     // signalled under lock when a page stops loading or being written
 }
 
 func NewCache() *Cache {
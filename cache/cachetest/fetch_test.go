@@ -0,0 +1,163 @@
+package cachetest
+
+import (
+	"testing"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/cache"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/faces"
+)
+
+// fill fetches and loads pages 1 to n, dirty when asked
+func fill(t *testing.T, c *cache.Cache, n int, dirty bool) {
+	t.Helper()
+
+	for pn := base.PageNumber(1); pn <= base.PageNumber(n); pn++ {
+		if _, lookup := c.Fetch(pn, false); lookup != faces.Missed {
+			t.Fatalf("expected page %d missed, got %d", pn, lookup)
+		}
+
+		c.Loaded(pn, false)
+
+		if dirty {
+			c.MarkDirty(pn)
+		}
+	}
+}
+
+// TestFetch verifies every policy maps a page once, keeps pages being
+// loaded and hands dirty victims out to be written back instead of
+// evicting them
+func TestFetch(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, c *cache.Cache)
+	}{
+		{
+			name: "A page loads once",
+			run: func(t *testing.T, c *cache.Cache) {
+				frameID, lookup := c.Fetch(7, false)
+				if lookup != faces.Missed {
+					t.Fatalf("expected a miss, got %d", lookup)
+				}
+
+				if _, lookup := c.Fetch(7, false); lookup != faces.Loading {
+					t.Fatalf("expected the page loading, got %d", lookup)
+				}
+
+				c.Loaded(7, false)
+
+				if got, lookup := c.Fetch(7, false); lookup != faces.Hit || got != frameID {
+					t.Errorf("expected a hit in frame %d, got %d in frame %d", frameID, lookup, got)
+				}
+			},
+		},
+		{
+			name: "Loading pages stay",
+			run: func(t *testing.T, c *cache.Cache) {
+				for pn := base.PageNumber(1); pn <= 10; pn++ {
+					c.Fetch(pn, false)
+				}
+
+				if _, lookup := c.Fetch(11, false); lookup != faces.NoFrame {
+					t.Errorf("expected no frame while every page loads, got %d", lookup)
+				}
+			},
+		},
+		{
+			name: "Dirty victims are written back first",
+			run: func(t *testing.T, c *cache.Cache) {
+				fill(t, c, 10, true)
+
+				victim, lookup := c.Fetch(11, false)
+				if lookup != faces.Dirty {
+					t.Fatalf("expected a dirty victim, got %d", lookup)
+				}
+
+				fr := c.Buffer[victim]
+
+				if fr.IsSet(constants.DirtyFlag) || !fr.IsSet(constants.PinnedFlag) {
+					t.Fatalf("expected the victim clean and held, flags %#x", fr.Flags)
+				}
+
+				if other, _ := c.Fetch(11, false); other == victim {
+					t.Fatalf("a held victim was handed out twice")
+				}
+
+				// written back pages are released, the next miss evicts one of them
+				written := map[base.PageNumber]bool{fr.PageNumber: true}
+				c.Written(fr.PageNumber)
+
+				for range 10 {
+					frameID, lookup := c.Fetch(12, false)
+
+					switch lookup {
+					case faces.Missed:
+						for pn := base.PageNumber(1); pn <= 10; pn++ {
+							if !c.Contains(pn) && !written[pn] {
+								t.Errorf("dirty page %d was evicted", pn)
+							}
+						}
+
+						return
+					case faces.Dirty:
+						written[c.Buffer[frameID].PageNumber] = true
+						c.Written(c.Buffer[frameID].PageNumber)
+					default:
+						t.Fatalf("expected a miss or a dirty victim, got %d", lookup)
+					}
+				}
+
+				t.Errorf("the page was not mapped once its victims were written back")
+			},
+		},
+		{
+			name: "Pins stop at the limit",
+			run: func(t *testing.T, c *cache.Cache) {
+				fill(t, c, 10, false)
+
+				for pn := base.PageNumber(1); pn <= 5; pn++ {
+					if _, lookup := c.Fetch(pn, true); lookup != faces.Hit {
+						t.Fatalf("expected page %d pinned, got %d", pn, lookup)
+					}
+				}
+
+				if _, lookup := c.Fetch(6, true); lookup != faces.PinLimit {
+					t.Errorf("expected the pin limit, got %d", lookup)
+				}
+			},
+		},
+		{
+			name: "Flushing takes dirty pages once",
+			run: func(t *testing.T, c *cache.Cache) {
+				fill(t, c, 2, true)
+				c.Pin(2)
+
+				if _, ok := c.Flushing(1, false); !ok {
+					t.Fatalf("a dirty page was not flushed")
+				}
+
+				if _, ok := c.Flushing(1, false); ok {
+					t.Errorf("a page being flushed was flushed again")
+				}
+
+				if _, ok := c.Flushing(2, false); ok {
+					t.Errorf("a pinned page was flushed")
+				}
+
+				if _, ok := c.Flushing(2, true); !ok {
+					t.Errorf("a pinned page was not flushed when asked")
+				}
+			},
+		},
+	}
+
+	for _, r := range policies {
+		for _, tt := range tests {
+			t.Run(r.String()+"/"+tt.name, func(t *testing.T) {
+				tt.run(t, newCache(r, 10))
+			})
+		}
+	}
+}
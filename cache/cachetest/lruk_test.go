@@ -0,0 +1,118 @@
+package cachetest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/cache"
+	"github.com/dark-vinci/nildb/constants"
+)
+
+// scanVictim is the LRU-K victim found by walking every frame twice, the
+// way the cache did before it kept a heap
+func scanVictim(c *cache.Cache) (base.FrameID, bool) {
+	var (
+		victim = ^base.FrameID(0)
+		minVal = uint64(math.MaxUint64)
+	)
+
+	older := func(id int) bool {
+		fr := c.Buffer[id]
+		historyK := fr.History[c.K-1]
+
+		if historyK != minVal || victim == ^base.FrameID(0) {
+			return historyK < minVal
+		}
+
+		return fr.History[0] < c.Buffer[victim].History[0]
+	}
+
+	evictable := func(id int) bool {
+		return mapped(c, base.FrameID(id)) && !c.Buffer[id].IsSet(constants.PinnedFlag)
+	}
+
+	for _, outsideCRP := range []bool{true, false} {
+		for id, fr := range c.Buffer {
+			if !evictable(id) || outsideCRP && c.CurrentTime-fr.Last <= c.CRP {
+				continue
+			}
+
+			if older(id) {
+				minVal = fr.History[c.K-1]
+				victim = base.FrameID(id)
+			}
+		}
+
+		if victim != ^base.FrameID(0) {
+			return victim, true
+		}
+	}
+
+	return victim, false
+}
+
+// mapped reports whether frameID holds a page rather than waiting to be reused
+func mapped(c *cache.Cache, frameID base.FrameID) bool {
+	id, ok := c.Pages[c.Buffer[frameID].PageNumber]
+
+	return ok && id == frameID
+}
+
+// TestLRUKEvictionOrder verifies the LRU-K heap picks the victims the scan
+// over every frame picked, through hits, misses, pins and invalidations
+func TestLRUKEvictionOrder(t *testing.T) {
+	tests := []struct {
+		k   uint
+		crp uint64
+	}{
+		{k: 1, crp: 0},
+		{k: 2, crp: 0},
+		{k: 2, crp: 5},
+		{k: 3, crp: 2},
+		{k: 4, crp: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("K=%d CRP=%d", tt.k, tt.crp), func(t *testing.T) {
+			var (
+				c = cache.NewBuilder().SetMaxSize(50).SetPinPercentageLimit(30).
+					LruK(tt.k).CorrelatedReferencePeriod(tt.crp).Build()
+				rng   = rand.New(rand.NewSource(int64(tt.k*100) + int64(tt.crp)))
+				trace = Zipf(200, 20000, 1.05, int64(tt.k))
+			)
+
+			for i, pn := range trace {
+				switch rng.Intn(10) {
+				case 0:
+					c.Pin(pn)
+				case 1:
+					c.Unpin(base.PageNumber(rng.Intn(200)))
+				case 2:
+					if rng.Intn(10) == 0 {
+						c.Invalidate(base.PageNumber(rng.Intn(200)))
+					}
+				}
+
+				if c.GetFrameID(pn) != nil || !c.Full(pn) {
+					c.Map(pn)
+					continue
+				}
+
+				want, ok := scanVictim(c)
+				if !ok {
+					continue
+				}
+
+				// an invalidated frame goes first, the scan only knows of mapped ones
+				if got := c.FindVictim(pn); mapped(c, got) && got != want {
+					t.Fatalf("access %d: expected frame %d, the heap picked %d", i, want, got)
+				}
+
+				c.Map(pn)
+			}
+		})
+	}
+}
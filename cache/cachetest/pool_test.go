@@ -0,0 +1,134 @@
+package cachetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/cache"
+	"github.com/dark-vinci/nildb/faces"
+	"github.com/dark-vinci/nildb/frame"
+)
+
+// holds reports whether the pool keeps pn in the frame it says it does
+func holds(p *cache.Pool, pn base.PageNumber) bool {
+	frameID := p.GetFrameID(pn)
+
+	return frameID != nil && p.GetFrame(*frameID).(*frame.Frame).PageNumber == pn
+}
+
+// TestPool verifies the pool keeps every page in a frame of its shard, and
+// that a full shard evicts its own pages only
+func TestPool(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, p *cache.Pool)
+	}{
+		{
+			name: "Frames of the pool hold their pages",
+			run: func(t *testing.T, p *cache.Pool) {
+				for pn := base.PageNumber(0); pn < 40; pn++ {
+					p.Map(pn)
+				}
+
+				for pn := base.PageNumber(0); pn < 40; pn++ {
+					if !holds(p, pn) {
+						t.Errorf("page %d is not in its frame", pn)
+					}
+				}
+
+				if got := len(p.Frames()); got != 40 {
+					t.Errorf("expected 40 frames, got %d", got)
+				}
+			},
+		},
+		{
+			name: "A full shard evicts its own pages",
+			run: func(t *testing.T, p *cache.Pool) {
+				for pn := base.PageNumber(1); pn < 40; pn += 4 {
+					p.Map(pn)
+				}
+
+				// shard 0 is full, the frames of the others are still free
+				for pn := base.PageNumber(0); pn < 200; pn += 4 {
+					if p.Full(pn) {
+						victim := p.FindVictim(pn)
+
+						if uint64(victim)%4 != 0 {
+							t.Fatalf("page %d would evict frame %d of another shard", pn, victim)
+						}
+
+						if frameID := p.Map(pn); frameID != victim {
+							t.Fatalf("expected page %d in frame %d, got %d", pn, victim, frameID)
+						}
+
+						continue
+					}
+
+					p.Map(pn)
+				}
+
+				for pn := base.PageNumber(1); pn < 40; pn += 4 {
+					if !holds(p, pn) {
+						t.Errorf("page %d of shard 1 was evicted", pn)
+					}
+				}
+
+				if got := p.Size(); got != 20 {
+					t.Errorf("expected 20 frames, got %d", got)
+				}
+			},
+		},
+		{
+			name: "Callers wait for a page loading",
+			run: func(t *testing.T, p *cache.Pool) {
+				if _, lookup := p.Fetch(3, false); lookup != faces.Missed {
+					t.Fatalf("expected a miss, got %d", lookup)
+				}
+
+				fetched := make(chan faces.Lookup)
+
+				go func() {
+					p.Wait(3)
+
+					_, lookup := p.Fetch(3, false)
+					fetched <- lookup
+				}()
+
+				select {
+				case <-fetched:
+					t.Fatalf("a caller did not wait for the page to load")
+				case <-time.After(20 * time.Millisecond):
+				}
+
+				p.Loaded(3, false)
+
+				if lookup := <-fetched; lookup != faces.Hit {
+					t.Errorf("expected a hit once loaded, got %d", lookup)
+				}
+			},
+		},
+		{
+			name: "Pinned pages stay",
+			run: func(t *testing.T, p *cache.Pool) {
+				p.Map(3)
+
+				if !p.Pin(3) {
+					t.Fatalf("pin failed")
+				}
+
+				Replay(p, Zipf(500, 5000, 1.1, 1))
+
+				if !holds(p, 3) {
+					t.Errorf("the pinned page was evicted")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, cache.NewBuilder().SetMaxSize(40).SetShards(4).BuildPool())
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package cachetest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/cache"
+)
+
+var policies = []cache.Replacement{cache.LRUK, cache.Clock, cache.TwoQ, cache.ARC}
+
+var traces = []struct {
+	name  string
+	trace Trace
+}{
+	{name: "loop-fits", trace: Loop(80, 20000)},
+	{name: "loop-too-large", trace: Loop(120, 20000)},
+	{name: "zipf", trace: Zipf(1000, 20000, 1.1, 1)},
+	{name: "scan-mix", trace: ScanMix(60, 20000, 50, 100, 1)},
+}
+
+func newCache(r cache.Replacement, size uint) *cache.Cache {
+	return cache.NewBuilder().SetMaxSize(size).SetReplacement(r).Build()
+}
+
+// TestVictim verifies every policy reuses the frame FindVictim announced,
+// the pager writes that frame back before mapping the next page, and that
+// peeking at a page leaves the victim alone
+func TestVictim(t *testing.T) {
+	for _, r := range policies {
+		for _, tr := range traces {
+			t.Run(fmt.Sprintf("%v/%s", r, tr.name), func(t *testing.T) {
+				c := newCache(r, 100)
+
+				for i, pn := range tr.trace {
+					if c.GetFrameID(pn) != nil {
+						continue
+					}
+
+					if uint(c.Size()) < c.GetMaxSize() {
+						c.Map(pn)
+						continue
+					}
+
+					victim := c.FindVictim(pn)
+
+					// looking the victim up, as a flush does, must not save it
+					c.Peek(c.Buffer[victim].PageNumber)
+
+					if again := c.FindVictim(pn); again != victim {
+						t.Fatalf("access %d: peeking moved the victim from frame %d to %d", i, victim, again)
+					}
+
+					if frameID := c.Map(pn); frameID != victim {
+						t.Fatalf("access %d: expected page %d in frame %d, got %d", i, pn, victim, frameID)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestReplacement verifies what every policy must keep: pinned pages until
+// their last pin, pages that fit, and the pages of other frames when one
+// was invalidated
+func TestReplacement(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, c *cache.Cache)
+	}{
+		{
+			name: "Pages that fit are only missed once",
+			run: func(t *testing.T, c *cache.Cache) {
+				if r := Replay(c, Loop(10, 1000)); r.Misses != 10 {
+					t.Errorf("expected 10 misses, got %d", r.Misses)
+				}
+			},
+		},
+		{
+			name: "Pinned pages stay",
+			run: func(t *testing.T, c *cache.Cache) {
+				c.Map(1000)
+				c.Pin(1000)
+
+				Replay(c, Zipf(500, 5000, 1.1, 1))
+
+				if !c.Contains(1000) {
+					t.Errorf("the pinned page was evicted")
+				}
+			},
+		},
+		{
+			name: "Pages stay until every pin is released",
+			run: func(t *testing.T, c *cache.Cache) {
+				c.Map(1000)
+				c.Pin(1000)
+				c.Pin(1000)
+				c.Unpin(1000)
+
+				Replay(c, Zipf(500, 5000, 1.1, 1))
+
+				if !c.Contains(1000) {
+					t.Errorf("the page still pinned was evicted")
+				}
+
+				c.Unpin(1000)
+
+				if c.PinnedPages != 0 {
+					t.Errorf("expected no pinned page, got %d", c.PinnedPages)
+				}
+			},
+		},
+		{
+			name: "Invalidated frames are reused first",
+			run: func(t *testing.T, c *cache.Cache) {
+				Replay(c, Loop(10, 10))
+				c.Invalidate(3)
+				c.Map(100)
+
+				for pn := base.PageNumber(0); pn < 10; pn++ {
+					if pn != 3 && !c.Contains(pn) {
+						t.Errorf("page %d was evicted while a frame was free", pn)
+					}
+				}
+
+				if c.Size() != 10 {
+					t.Errorf("expected 10 frames, got %d", c.Size())
+				}
+			},
+		},
+	}
+
+	for _, r := range policies {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%v/%s", r, tt.name), func(t *testing.T) {
+				tt.run(t, newCache(r, 10))
+			})
+		}
+	}
+}
+
+// TestScanResistance verifies the policies that tell pages used once from
+// pages used again keep a hot set through scans better than CLOCK
+func TestScanResistance(t *testing.T) {
+	var (
+		trace = ScanMix(60, 20000, 50, 100, 1)
+		clock = Replay(newCache(cache.Clock, 100), trace)
+	)
+
+	for _, r := range []cache.Replacement{cache.LRUK, cache.TwoQ, cache.ARC} {
+		if got := Replay(newCache(r, 100), trace); got.HitRatio() <= clock.HitRatio() {
+			t.Errorf("%v: expected a hit ratio above %.3f, got %.3f", r, clock.HitRatio(), got.HitRatio())
+		}
+	}
+}
+
+// BenchmarkReplay replays every trace against every policy and reports
+// the hit ratio of each
+func BenchmarkReplay(b *testing.B) {
+	for _, tr := range traces {
+		for _, r := range policies {
+			b.Run(fmt.Sprintf("%s/%v", tr.name, r), func(b *testing.B) {
+				var result Result
+
+				for range b.N {
+					result = Replay(newCache(r, 100), tr.trace)
+				}
+
+				b.ReportMetric(100*result.HitRatio(), "hit%")
+			})
+		}
+	}
+}
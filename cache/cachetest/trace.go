@@ -0,0 +1,98 @@
+// Package cachetest replays page-access traces against the cache, so the
+// replacement policies can be compared on a workload.
+package cachetest
+
+import (
+	"math/rand"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/interfaces"
+)
+
+// Trace is the order in which pages are asked for
+type Trace []base.PageNumber
+
+// Result counts the pages a replay found in the cache and the ones it missed
+type Result struct {
+	Hits   int
+	Misses int
+}
+
+// HitRatio returns the share of the accesses served from the cache
+func (r Result) HitRatio() float64 {
+	if r.Hits+r.Misses == 0 {
+		return 0
+	}
+
+	return float64(r.Hits) / float64(r.Hits+r.Misses)
+}
+
+// Replay asks c for every page of trace like the pager does, a page that
+// is not cached is mapped into it
+func Replay(c faces.Cache, trace Trace) Result {
+	var r Result
+
+	for _, pn := range trace {
+		if c.GetFrameID(pn) != nil {
+			r.Hits++
+			continue
+		}
+
+		c.Map(pn)
+		r.Misses++
+	}
+
+	return r
+}
+
+// Loop scans pages 0 to pages-1 again and again, n accesses in all
+func Loop(pages, n int) Trace {
+	trace := make(Trace, n)
+
+	for i := range trace {
+		trace[i] = base.PageNumber(i % pages)
+	}
+
+	return trace
+}
+
+// Zipf asks n times for pages 0 to pages-1, page i about 1/(i+1)^s as often
+// as page 0
+func Zipf(pages, n int, s float64, seed int64) Trace {
+	var (
+		rng   = rand.New(rand.NewSource(seed))
+		zipf  = rand.NewZipf(rng, s, 1, uint64(pages-1))
+		trace = make(Trace, n)
+	)
+
+	for i := range trace {
+		trace[i] = base.PageNumber(zipf.Uint64())
+	}
+
+	return trace
+}
+
+// ScanMix asks n times for pages of a hot set at random, and every
+// scanEvery accesses scans scanLength pages never seen before
+func ScanMix(hot, n, scanEvery, scanLength int, seed int64) Trace {
+	var (
+		rng   = rand.New(rand.NewSource(seed))
+		trace = make(Trace, 0, n+n/scanEvery*scanLength)
+		next  = base.PageNumber(hot)
+	)
+
+	for i := 1; i <= n; i++ {
+		trace = append(trace, base.PageNumber(rng.Intn(hot)))
+
+		if i%scanEvery != 0 {
+			continue
+		}
+
+		for range scanLength {
+			trace = append(trace, next)
+			next++
+		}
+	}
+
+	return trace
+}
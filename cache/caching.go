@@ -1,8 +1,6 @@
 package cache
 
 import (
-	"math"
-
 	"github.com/dark-vinci/nildb/base"
 	"github.com/dark-vinci/nildb/constants"
 	"github.com/dark-vinci/nildb/faces"
@@ -35,57 +33,8 @@ func (c *Cache) MustEvictDirtyPage() bool {
 }
 
 func (c *Cache) findVictim() base.FrameID {
-	var (
-		t             = c.CurrentTime
-		minVal        = uint64(math.MaxUint64)
-		victim        = ^base.FrameID(0) // base.FrameID(uint64(math.MaxUint64))
-		foundEligible = false
-	)
-
-	for id := 0; id < len(c.Buffer); id++ {
-		var (
-			fid = base.FrameID(id)
-			fr  = c.Buffer[id]
-		)
-
-		if t-fr.Last <= c.CRP {
-			continue
-		}
-
-		if !c.isEvictable(fid) {
-			continue
-		}
-
-		historyK := fr.History[c.K-1]
-
-		if historyK < minVal {
-			minVal = historyK
-			victim = fid
-			foundEligible = true
-		}
-	}
-
-	if foundEligible {
-		return victim
-	}
-
-	minVal = uint64(math.MaxUint64)
-	for id := 0; id < len(c.Buffer); id++ {
-		fid := base.FrameID(id)
-		fr := c.Buffer[id]
-
-		if !c.isEvictable(fid) {
-			continue
-		}
-
-		historyK := fr.History[c.K-1]
-		if historyK < minVal {
-			minVal = historyK
-			victim = fid
-		}
-	}
-
-	if victim == ^base.FrameID(0) {
+	victim, ok := c.victim()
+	if !ok {
 		panic("No evictable frame found")
 	}
 
@@ -96,7 +45,7 @@ func (c *Cache) findVictim() base.FrameID {
 func (c *Cache) isEvictable(frameID base.FrameID) bool {
 	fram := c.Buffer[frameID]
 
-	return !fram.IsSet(constants.PinnedFlag) && !fram.IsOverflow()
+	return !fram.IsSet(constants.PinnedFlag|constants.LoadingFlag) && !fram.IsOverflow()
 }
 
 // setFlags sets the specified flags for a page
@@ -114,64 +63,192 @@ func (c *Cache) Map(pageNumber base.PageNumber) base.FrameID {
 		return frameID
 	}
 
-	var (
-		frameID base.FrameID
-		f       = &frame.Frame{}
-	)
+	return c.place(pageNumber, false)
+}
 
-	// Buffer is not full, allocate a new page
-	if uint(len(c.Buffer)) < c.MaxSize {
-		frameID = base.FrameID(len(c.Buffer))
-		f = frame.NewFrame(pageNumber, pages.Alloc(int(c.PageSize)))
+// MapCold maps a page that nobody asked for yet, like one read ahead. Its
+// first use counts as the first reference, and it only takes a free frame
+// or a clean one the policy does not consider hot. The page is loading
+// like a Missed one until Loaded or Invalidate. It reports false when the
+// page is cached or no such frame is left.
+func (c *Cache) MapCold(pageNumber base.PageNumber) (base.FrameID, bool) {
+	if _, exists := c.Pages[pageNumber]; exists {
+		return 0, false
+	}
 
-		c.Buffer = append(c.Buffer, f)
-	} else {
-		// Buffer full, find a victim to evict
-		victimID := c.findVictim()
+	if uint(len(c.Buffer)) >= c.MaxSize && len(c.free) == 0 {
+		victimID, ok := c.victim()
+		if !ok {
+			return 0, false
+		}
 
-		f = c.Buffer[victimID]
+		if c.Buffer[victimID].IsSet(constants.DirtyFlag) || c.policy.hot(victimID) {
+			return 0, false
+		}
+	}
+
+	frameID := c.place(pageNumber, true)
+	c.Buffer[frameID].Set(constants.LoadingFlag)
+
+	return frameID, true
+}
+
+// Fetch looks pageNumber up and maps it when it is not cached, in one step.
+// A cached page is a Hit: the access is recorded and the page pinned when
+// pin is set, a refused pin makes it a PinLimit. A page another caller is
+// reading in is Loading and left alone, so is a page being written back
+// when pin is set, it is not changed under the write. Any other page takes an
+// invalidated frame, a new one or a clean victim and is Missed, it stays
+// loading, neither evicted nor handed out, until Loaded or Invalidate. A
+// dirty victim is not evicted but marked clean and held as by Flushing, it
+// is returned as Dirty for the caller to write back before fetching again.
+func (c *Cache) Fetch(pageNumber base.PageNumber, pin bool) (base.FrameID, faces.Lookup) {
+	if frameID, exists := c.Pages[pageNumber]; exists {
+		if fram := c.Buffer[frameID]; fram.IsSet(constants.LoadingFlag) || (pin && fram.IsSet(constants.WritingFlag)) {
+			return frameID, faces.Loading
+		}
+
+		c.policy.accessed(frameID)
+
+		if pin && !c.Pin(pageNumber) {
+			return frameID, faces.PinLimit
+		}
 
-		delete(c.Pages, f.PageNumber)
+		return frameID, faces.Hit
+	}
+
+	if uint(len(c.Buffer)) >= c.MaxSize && len(c.free) == 0 {
+		victimID, ok := c.victim()
+		if !ok {
+			return 0, faces.NoFrame
+		}
 
-		f.PageNumber = pageNumber
-		f.Flags = 0
+		if c.Buffer[victimID].IsSet(constants.DirtyFlag) {
+			c.writing(victimID)
+			return victimID, faces.Dirty
+		}
 	}
 
-	// Update history for the new or evicted frame
-	c.updateHistory(frameID)
+	frameID := c.place(pageNumber, false)
+	c.Buffer[frameID].Set(constants.LoadingFlag)
 
-	c.Pages[pageNumber] = frameID
-	return frameID
+	return frameID, faces.Missed
+}
+
+// Loaded ends the loading of a page Fetch reported Missed and pins it when
+// pin is set. It reports false when the pin is refused, the page stays
+// cached unpinned.
+func (c *Cache) Loaded(pageNumber base.PageNumber, pin bool) bool {
+	if !c.unsetFlags(pageNumber, constants.LoadingFlag) {
+		return false
+	}
+
+	return !pin || c.Pin(pageNumber)
 }
 
-func (c *Cache) updateHistory(frameID base.FrameID) {
+// Wait returns at once, a Cache is not shared and no page loads meanwhile.
+// A Pool waits.
+func (c *Cache) Wait(base.PageNumber) {}
+
+// busy reports whether pageNumber is mapped and being read in or written back
+func (c *Cache) busy(pageNumber base.PageNumber) bool {
+	frameID, exists := c.Pages[pageNumber]
+
+	return exists && c.Buffer[frameID].IsSet(constants.LoadingFlag|constants.WritingFlag)
+}
+
+// Flushing marks a dirty page clean and holds it while it is written back,
+// so the frame is not reused and the page is only dirty again once it
+// changes. The hold is granted past the pin limit and dropped with
+// Written, MarkDirty puts back a page that could not be written. Pinned
+// pages are skipped unless pinned is set. It reports false when the page
+// is not cached, clean or already being written.
+func (c *Cache) Flushing(pageNumber base.PageNumber, pinned bool) (base.FrameID, bool) {
+	frameID, exists := c.Pages[pageNumber]
+	if !exists {
+		return 0, false
+	}
+
 	fram := c.Buffer[frameID]
 
-	c.CurrentTime++
+	if !fram.IsSet(constants.DirtyFlag) || fram.IsSet(constants.WritingFlag) || (!pinned && fram.IsSet(constants.PinnedFlag)) {
+		return 0, false
+	}
 
-	t := c.CurrentTime
+	c.writing(frameID)
 
-	if len(fram.History) == 0 {
-		fram.History = make([]uint64, c.K)
-		fram.History[0] = t
+	return frameID, true
+}
 
-		// history[1:] remains 0
-		fram.Last = t
+// writing marks a dirty frame clean and holds it, see Flushing
+func (c *Cache) writing(frameID base.FrameID) {
+	fram := c.Buffer[frameID]
 
-		return
+	fram.Unset(constants.DirtyFlag)
+	fram.Set(constants.WritingFlag)
+	c.hold(frameID)
+}
+
+// Written ends the write back Fetch or Flushing started and drops its hold
+func (c *Cache) Written(pageNumber base.PageNumber) {
+	if c.unsetFlags(pageNumber, constants.WritingFlag) {
+		c.Unpin(pageNumber)
 	}
+}
 
-	if t-fram.Last > c.CRP {
-		corrPeriod := fram.Last - fram.History[0]
+// EachFrame calls fn with every frame, fn must not call the cache. The
+// frames keep their page and flags meanwhile.
+func (c *Cache) EachFrame(fn func(frame any)) {
+	for _, fram := range c.Buffer {
+		fn(fram)
+	}
+}
 
-		for i := int(c.K) - 1; i >= 1; i-- {
-			fram.History[i] = fram.History[i-1] + corrPeriod
-		}
+// victim returns the frame the next page goes to: an invalidated one, or
+// the victim of the policy, false when every frame is pinned or loading
+func (c *Cache) victim() (base.FrameID, bool) {
+	if len(c.free) > 0 {
+		return c.free[len(c.free)-1], true
+	}
+
+	return c.policy.victim(c.isEvictable)
+}
+
+// place gives pageNumber an invalidated frame, a new one or the frame of a
+// victim
+func (c *Cache) place(pageNumber base.PageNumber, cold bool) base.FrameID {
+	var frameID base.FrameID
+
+	switch {
+	case len(c.free) > 0:
+		frameID = c.free[len(c.free)-1]
+		c.free = c.free[:len(c.free)-1]
+	case uint(len(c.Buffer)) < c.MaxSize:
+		// Buffer is not full, allocate a new page
+		frameID = base.FrameID(len(c.Buffer))
+		c.Buffer = append(c.Buffer, frame.NewFrame(pageNumber, pages.Alloc(int(c.PageSize))))
+	default:
+		// Buffer full, find a victim to evict
+		frameID = c.findVictim()
+		victim := c.Buffer[frameID]
 
-		fram.History[0] = t
+		delete(c.Pages, victim.PageNumber)
+		c.policy.removed(frameID, victim.PageNumber, true)
 	}
 
-	fram.Last = t
+	f := c.Buffer[frameID]
+
+	f.PageNumber = pageNumber
+	f.History = nil
+	f.Flags = 0
+	f.Pins = 0
+	f.LSN = 0
+	f.RecLSN = 0
+
+	c.Pages[pageNumber] = frameID
+	c.policy.placed(frameID, pageNumber, cold)
+
+	return frameID
 }
 
 // unsetFlags clears the specified flags for a page
@@ -194,42 +271,81 @@ func (c *Cache) MarkClean(pageNumber base.PageNumber) bool {
 	return c.unsetFlags(pageNumber, constants.DirtyFlag)
 }
 
-// Pin marks a page as unevictable
+// Pin marks a page as unevictable until every pin is released by Unpin
 func (c *Cache) Pin(pageNumber base.PageNumber) bool {
-	pinnedPercentage := float32(c.PinnedPages) / float32(c.MaxSize) * 100.0
-
-	if pinnedPercentage >= c.PinPercentageLimit {
+	frameID, exists := c.Pages[pageNumber]
+	if !exists {
 		return false
 	}
 
-	pinned := c.setFlags(pageNumber, constants.PinnedFlag)
-	if pinned {
-		c.PinnedPages++
+	// pinning twice only counts once against the limit
+	if c.Buffer[frameID].Pins == 0 {
+		pinnedPercentage := float32(c.PinnedPages) / float32(c.MaxSize) * 100.0
+
+		if pinnedPercentage >= c.PinPercentageLimit {
+			return false
+		}
+	}
+
+	c.hold(frameID)
+
+	return true
+}
+
+// hold adds a pin to a frame whatever the pin limit, the first one makes
+// it unevictable
+func (c *Cache) hold(frameID base.FrameID) {
+	fram := c.Buffer[frameID]
+
+	fram.Pins++
+
+	if fram.Pins > 1 {
+		return
 	}
 
-	return pinned
+	fram.Set(constants.PinnedFlag)
+	c.PinnedPages++
+	c.policy.pinned(frameID, true)
 }
 
-// Unpin marks a page as evictable
+// Unpin releases one pin of a page, the last one makes it evictable
 func (c *Cache) Unpin(pageNumber base.PageNumber) bool {
-	unpinned := c.unsetFlags(pageNumber, constants.PinnedFlag)
+	frameID, exists := c.Pages[pageNumber]
+	if !exists {
+		return false
+	}
 
-	if unpinned {
+	switch fram := c.Buffer[frameID]; fram.Pins {
+	case 0:
+	case 1:
+		fram.Pins = 0
+		fram.Unset(constants.PinnedFlag)
 		c.PinnedPages--
+		c.policy.pinned(frameID, false)
+	default:
+		fram.Pins--
 	}
 
-	return unpinned
+	return true
 }
 
 // Invalidate removes a page from the cache
 func (c *Cache) Invalidate(pageNumber base.PageNumber) {
 	if frameId, ok := c.Pages[pageNumber]; ok {
+		if c.Buffer[frameId].IsSet(constants.PinnedFlag) {
+			c.PinnedPages--
+		}
+
 		c.Buffer[frameId].Flags = 0
+		c.Buffer[frameId].Pins = 0
 		delete(c.Pages, pageNumber)
+
+		c.policy.removed(frameId, pageNumber, false)
+		c.free = append(c.free, frameId)
 	}
 }
 
-// GetFrame retrieves the MemPage for a given FrameId
-func (c *Cache) GetFrame(frameID base.FrameID) *faces.PageHandle {
-	return &c.Buffer[frameID].Page
+// GetFrame retrieves the *frame.Frame for a given FrameId
+func (c *Cache) GetFrame(frameID base.FrameID) any {
+	return c.Buffer[frameID]
 }
@@ -0,0 +1,60 @@
+package cache
+
+import "github.com/dark-vinci/nildb/base"
+
+// clock sweeps the frames with a hand, a page used since the hand last
+// passed it loses its reference bit and gets a second chance
+type clock struct {
+	frames []clockFrame // by frame id
+	hand   int
+}
+
+type clockFrame struct {
+	resident   bool
+	referenced bool
+}
+
+func (c *clock) placed(frameID base.FrameID, _ base.PageNumber, cold bool) {
+	for int(frameID) >= len(c.frames) {
+		c.frames = append(c.frames, clockFrame{})
+	}
+
+	c.frames[frameID] = clockFrame{resident: true, referenced: !cold}
+}
+
+func (c *clock) accessed(frameID base.FrameID) {
+	c.frames[frameID].referenced = true
+}
+
+func (c *clock) removed(frameID base.FrameID, _ base.PageNumber, _ bool) {
+	c.frames[frameID] = clockFrame{}
+}
+
+func (c *clock) pinned(base.FrameID, bool) {}
+
+func (c *clock) hot(frameID base.FrameID) bool {
+	return c.frames[frameID].referenced
+}
+
+// victim moves the hand to the first evictable frame without its
+// reference bit and leaves it there, two turns clear every bit
+func (c *clock) victim(evictable func(base.FrameID) bool) (base.FrameID, bool) {
+	for range 2 * len(c.frames) {
+		var (
+			frameID = base.FrameID(c.hand)
+			f       = &c.frames[c.hand]
+		)
+
+		if f.resident && evictable(frameID) {
+			if !f.referenced {
+				return frameID, true
+			}
+
+			f.referenced = false
+		}
+
+		c.hand = (c.hand + 1) % len(c.frames)
+	}
+
+	return 0, false
+}
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"container/heap"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/constants"
+)
+
+// lruK evicts the page whose K-th most recent use is the oldest. The
+// history of every page is kept in its frame, references closer than the
+// correlated reference period count as one. The unpinned frames wait in a
+// heap ordered by K-th reference, so a victim costs O(log n).
+type lruK struct {
+	c     *Cache
+	heap  []base.FrameID // unpinned frames, the oldest K-th reference first
+	index []int          // position of every frame in heap, -1 when out of it
+}
+
+func (l *lruK) placed(frameID base.FrameID, _ base.PageNumber, cold bool) {
+	l.c.updateHistory(frameID)
+
+	if cold {
+		l.c.Buffer[frameID].Set(constants.PrefetchedFlag)
+	}
+
+	for int(frameID) >= len(l.index) {
+		l.index = append(l.index, -1)
+	}
+
+	l.add(frameID)
+}
+
+func (l *lruK) accessed(frameID base.FrameID) {
+	l.c.updateHistory(frameID)
+
+	if i := l.index[frameID]; i >= 0 {
+		heap.Fix(l, i)
+	}
+}
+
+func (l *lruK) removed(frameID base.FrameID, _ base.PageNumber, _ bool) {
+	if i := l.index[frameID]; i >= 0 {
+		heap.Remove(l, i)
+	}
+}
+
+func (l *lruK) pinned(frameID base.FrameID, pinned bool) {
+	if pinned {
+		l.removed(frameID, 0, false)
+	} else {
+		l.add(frameID)
+	}
+}
+
+func (l *lruK) hot(frameID base.FrameID) bool {
+	return l.c.Buffer[frameID].History[l.c.K-1] != 0
+}
+
+// victim returns the frame with the oldest K-th reference, frames used
+// within the correlated reference period go last. Frames are taken off the
+// heap in order until one fits and put back, at most one per tick of the
+// period is passed over.
+func (l *lruK) victim(evictable func(base.FrameID) bool) (base.FrameID, bool) {
+	var (
+		c      = l.c
+		t      = c.CurrentTime
+		popped []base.FrameID
+		oldest = ^base.FrameID(0)
+	)
+
+	defer func() {
+		for _, frameID := range popped {
+			heap.Push(l, frameID)
+		}
+	}()
+
+	for l.Len() > 0 {
+		frameID := heap.Pop(l).(base.FrameID)
+		popped = append(popped, frameID)
+
+		// overflow pages are not pinned yet never evicted
+		if !evictable(frameID) {
+			continue
+		}
+
+		if t-c.Buffer[frameID].Last > c.CRP {
+			return frameID, true
+		}
+
+		if oldest == ^base.FrameID(0) {
+			oldest = frameID
+		}
+	}
+
+	return oldest, oldest != ^base.FrameID(0)
+}
+
+// add puts frameID in the heap unless it is there
+func (l *lruK) add(frameID base.FrameID) {
+	if l.index[frameID] < 0 {
+		heap.Push(l, frameID)
+	}
+}
+
+func (l *lruK) Len() int {
+	return len(l.heap)
+}
+
+// Less orders frames by K-th reference, then by last reference for the
+// frames used less than K times, then by frame
+func (l *lruK) Less(i, j int) bool {
+	var (
+		a = l.c.Buffer[l.heap[i]]
+		b = l.c.Buffer[l.heap[j]]
+		k = l.c.K - 1
+	)
+
+	if a.History[k] != b.History[k] {
+		return a.History[k] < b.History[k]
+	}
+
+	if a.History[0] != b.History[0] {
+		return a.History[0] < b.History[0]
+	}
+
+	return l.heap[i] < l.heap[j]
+}
+
+func (l *lruK) Swap(i, j int) {
+	l.heap[i], l.heap[j] = l.heap[j], l.heap[i]
+	l.index[l.heap[i]] = i
+	l.index[l.heap[j]] = j
+}
+
+func (l *lruK) Push(x any) {
+	frameID := x.(base.FrameID)
+
+	l.index[frameID] = len(l.heap)
+	l.heap = append(l.heap, frameID)
+}
+
+func (l *lruK) Pop() any {
+	last := len(l.heap) - 1
+	frameID := l.heap[last]
+
+	l.heap = l.heap[:last]
+	l.index[frameID] = -1
+
+	return frameID
+}
+
+func (c *Cache) updateHistory(frameID base.FrameID) {
+	fram := c.Buffer[frameID]
+
+	c.CurrentTime++
+
+	t := c.CurrentTime
+
+	// the first use of a page read ahead is its first reference
+	if len(fram.History) == 0 || fram.IsSet(constants.PrefetchedFlag) {
+		fram.Unset(constants.PrefetchedFlag)
+		fram.History = make([]uint64, c.K)
+		fram.History[0] = t
+
+		// history[1:] remains 0
+		fram.Last = t
+
+		return
+	}
+
+	if t-fram.Last > c.CRP {
+		corrPeriod := fram.Last - fram.History[0]
+
+		for i := int(c.K) - 1; i >= 1; i-- {
+			fram.History[i] = fram.History[i-1] + corrPeriod
+		}
+
+		fram.History[0] = t
+	}
+
+	fram.Last = t
+}
@@ -1,6 +1,11 @@
 package cache
 
-import "github.com/dark-vinci/nildb/base"
+import (
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/faces"
+)
+
+var _ faces.Cache = (*Cache)(nil)
 
 func (c *Cache) GetMaxSize() uint {
 	return c.MaxSize
@@ -10,6 +15,11 @@ func (c *Cache) GetPageSize() uint {
 	return c.PageSize
 }
 
+// Size returns the number of frames allocated so far
+func (c *Cache) Size() int {
+	return len(c.Buffer)
+}
+
 func (c *Cache) Contains(pageNumber base.PageNumber) bool {
 	_, exists := c.Pages[pageNumber]
 	return exists
@@ -17,7 +27,7 @@ func (c *Cache) Contains(pageNumber base.PageNumber) bool {
 
 func (c *Cache) refPage(pageNumber base.PageNumber) *base.FrameID {
 	if frameID, exists := c.Pages[pageNumber]; exists {
-		c.updateHistory(frameID)
+		c.policy.accessed(frameID)
 		return &frameID
 	}
 
@@ -27,3 +37,64 @@ func (c *Cache) refPage(pageNumber base.PageNumber) *base.FrameID {
 func (c *Cache) Get(pageNumber base.PageNumber) *base.FrameID {
 	return c.refPage(pageNumber)
 }
+
+// GetFrameID returns the frame holding the page and records the access,
+// nil when the page is not cached
+func (c *Cache) GetFrameID(pageNumber base.PageNumber) *base.FrameID {
+	return c.refPage(pageNumber)
+}
+
+// Peek returns the frame holding the page without recording an access,
+// nil when the page is not cached
+func (c *Cache) Peek(pageNumber base.PageNumber) *base.FrameID {
+	if frameID, exists := c.Pages[pageNumber]; exists {
+		return &frameID
+	}
+
+	return nil
+}
+
+// Full reports whether every frame is allocated, the next page takes the
+// frame of another one
+func (c *Cache) Full(_ base.PageNumber) bool {
+	return uint(len(c.Buffer)) >= c.MaxSize
+}
+
+// Frames returns every frame allocated so far
+func (c *Cache) Frames() []base.FrameID {
+	frameIDs := make([]base.FrameID, len(c.Buffer))
+
+	for id := range frameIDs {
+		frameIDs[id] = base.FrameID(id)
+	}
+
+	return frameIDs
+}
+
+// FindVictim returns the frame Map would reuse for the next page, any page
+// goes to the same one
+func (c *Cache) FindVictim(_ base.PageNumber) base.FrameID {
+	return c.findVictim()
+}
+
+// Victim is FindVictim for a caller that can do without a frame, it
+// reports false instead of panicking when none can be evicted
+func (c *Cache) Victim(_ base.PageNumber) (base.FrameID, bool) {
+	return c.victim()
+}
+
+func (c *Cache) Lock() {
+	c.lock.Lock()
+}
+
+func (c *Cache) Unlock() {
+	c.lock.Unlock()
+}
+
+func (c *Cache) RLock() {
+	c.lock.RLock()
+}
+
+func (c *Cache) RUnlock() {
+	c.lock.RUnlock()
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"container/list"
+
+	"github.com/dark-vinci/nildb/base"
+)
+
+// Replacement names the policy that picks the page a full cache gives up
+type Replacement uint8
+
+const (
+	LRUK  Replacement = iota // the page whose K-th last use is the oldest
+	Clock                    // a second chance for pages used since the hand passed them
+	TwoQ                     // pages used once wait in a queue, pages used again in an LRU list
+	ARC                      // balances recency and frequency from the pages evicted lately
+)
+
+// Valid reports whether r is a known policy
+func (r Replacement) Valid() bool {
+	return r <= ARC
+}
+
+func (r Replacement) String() string {
+	switch r {
+	case LRUK:
+		return "lru-k"
+	case Clock:
+		return "clock"
+	case TwoQ:
+		return "2q"
+	case ARC:
+		return "arc"
+	default:
+		return "unknown"
+	}
+}
+
+// policy keeps the replacement state of a cache. The cache tells it about
+// every page placed in a frame, every hit and every page leaving, and asks
+// it for victims among the evictable frames. A victim stays the answer
+// until the cache changes, the pager writes it back before mapping the
+// page that replaces it.
+type policy interface {
+	// placed records that frameID holds pageNumber, cold when the page was
+	// read ahead and its first use is still to come
+	placed(frameID base.FrameID, pageNumber base.PageNumber, cold bool)
+	accessed(frameID base.FrameID)
+	// removed records that the page of frameID left the cache, evicted
+	// rather than invalidated
+	removed(frameID base.FrameID, pageNumber base.PageNumber, evicted bool)
+	victim(evictable func(base.FrameID) bool) (base.FrameID, bool)
+	// pinned records that the page of frameID was pinned or unpinned
+	pinned(frameID base.FrameID, pinned bool)
+	// hot reports whether the page of frameID proved to be reused, a page
+	// read ahead never replaces it
+	hot(frameID base.FrameID) bool
+}
+
+func newPolicy(r Replacement, c *Cache) policy {
+	switch r {
+	case Clock:
+		return &clock{}
+	case TwoQ:
+		return newTwoQ(int(c.MaxSize))
+	case ARC:
+		return newARC(int(c.MaxSize))
+	default:
+		return &lruK{c: c}
+	}
+}
+
+// entry is a page on one of the lists of a policy, a ghost when it only
+// remembers a page evicted lately
+type entry struct {
+	frame base.FrameID
+	page  base.PageNumber
+	list  *list.List
+	cold  bool // read ahead and not used yet
+}
+
+// oldest returns the evictable frame closest to the back of l
+func oldest(l *list.List, evictable func(base.FrameID) bool) (base.FrameID, bool) {
+	for e := l.Back(); e != nil; e = e.Prev() {
+		if frameID := e.Value.(*entry).frame; evictable(frameID) {
+			return frameID, true
+		}
+	}
+
+	return 0, false
+}
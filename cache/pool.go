@@ -0,0 +1,366 @@
+package cache
+
+import (
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/faces"
+)
+
+var _ faces.Cache = (*Pool)(nil)
+
+// Pool is a cache safe for concurrent use. Pages are spread over shards by
+// page number, every shard is a Cache with its own latch, frames and
+// replacement state, so goroutines asking for pages of different shards
+// never wait for each other. Frame n of shard s is frame n*shards+s of
+// the pool.
+type Pool struct {
+	shards []*Cache
+}
+
+// NewPool shares c between goroutines, as a Pool of a single shard
+func NewPool(c *Cache) *Pool {
+	return &Pool{shards: []*Cache{c}}
+}
+
+// shard returns the shard of pageNumber and its index
+func (p *Pool) shard(pageNumber base.PageNumber) (*Cache, base.FrameID) {
+	i := uint64(pageNumber) % uint64(len(p.shards))
+
+	return p.shards[i], base.FrameID(i)
+}
+
+// global turns a frame of shard i into a frame of the pool
+func (p *Pool) global(i, frameID base.FrameID) base.FrameID {
+	return frameID*base.FrameID(len(p.shards)) + i
+}
+
+// local returns the shard of a frame of the pool and the frame in it
+func (p *Pool) local(frameID base.FrameID) (*Cache, base.FrameID) {
+	n := base.FrameID(len(p.shards))
+
+	return p.shards[frameID%n], frameID / n
+}
+
+func (p *Pool) GetMaxSize() uint {
+	var size uint
+
+	for _, c := range p.shards {
+		size += c.MaxSize
+	}
+
+	return size
+}
+
+func (p *Pool) GetPageSize() uint {
+	return p.shards[0].PageSize
+}
+
+// Size returns the number of frames allocated so far
+func (p *Pool) Size() int {
+	size := 0
+
+	for _, c := range p.shards {
+		c.RLock()
+		size += c.Size()
+		c.RUnlock()
+	}
+
+	return size
+}
+
+// Frames returns every frame allocated so far
+func (p *Pool) Frames() []base.FrameID {
+	var frameIDs []base.FrameID
+
+	for i, c := range p.shards {
+		c.RLock()
+
+		for _, frameID := range c.Frames() {
+			frameIDs = append(frameIDs, p.global(base.FrameID(i), frameID))
+		}
+
+		c.RUnlock()
+	}
+
+	return frameIDs
+}
+
+func (p *Pool) Contains(pageNumber base.PageNumber) bool {
+	c, _ := p.shard(pageNumber)
+
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.Contains(pageNumber)
+}
+
+// Full reports whether every frame of the shard of pageNumber is allocated
+func (p *Pool) Full(pageNumber base.PageNumber) bool {
+	c, _ := p.shard(pageNumber)
+
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.Full(pageNumber)
+}
+
+// GetFrameID returns the frame holding the page and records the access,
+// nil when the page is not cached
+func (p *Pool) GetFrameID(pageNumber base.PageNumber) *base.FrameID {
+	c, i := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	frameID := c.GetFrameID(pageNumber)
+	if frameID == nil {
+		return nil
+	}
+
+	*frameID = p.global(i, *frameID)
+
+	return frameID
+}
+
+// Peek returns the frame holding the page without recording an access
+func (p *Pool) Peek(pageNumber base.PageNumber) *base.FrameID {
+	c, i := p.shard(pageNumber)
+
+	c.RLock()
+	defer c.RUnlock()
+
+	frameID := c.Peek(pageNumber)
+	if frameID == nil {
+		return nil
+	}
+
+	*frameID = p.global(i, *frameID)
+
+	return frameID
+}
+
+// GetFrame returns a frame of the pool. It may be reused for another page
+// as soon as the shard is unlatched, unless the caller pinned, holds or
+// loads it.
+func (p *Pool) GetFrame(frameID base.FrameID) any {
+	c, local := p.local(frameID)
+
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.GetFrame(local)
+}
+
+func (p *Pool) Map(pageNumber base.PageNumber) base.FrameID {
+	c, i := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	return p.global(i, c.Map(pageNumber))
+}
+
+func (p *Pool) MapCold(pageNumber base.PageNumber) (base.FrameID, bool) {
+	c, i := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	frameID, ok := c.MapCold(pageNumber)
+
+	return p.global(i, frameID), ok
+}
+
+func (p *Pool) Load(pageNumber base.PageNumber, page *faces.PageHandle) *faces.PageHandle {
+	c, _ := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.Load(pageNumber, page)
+}
+
+// Invalidate removes a page from the cache, the callers waiting for it to
+// load give up
+func (p *Pool) Invalidate(pageNumber base.PageNumber) {
+	c, _ := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.Invalidate(pageNumber)
+	c.loaded.Broadcast()
+}
+
+// Pin marks a page as unevictable, a shard pins at most its share of the
+// pin limit
+func (p *Pool) Pin(pageNumber base.PageNumber) bool {
+	c, _ := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.Pin(pageNumber)
+}
+
+func (p *Pool) Unpin(pageNumber base.PageNumber) bool {
+	c, _ := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.Unpin(pageNumber)
+}
+
+func (p *Pool) MarkDirty(pageNumber base.PageNumber) bool {
+	c, _ := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.MarkDirty(pageNumber)
+}
+
+func (p *Pool) MarkClean(pageNumber base.PageNumber) bool {
+	c, _ := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.MarkClean(pageNumber)
+}
+
+// MustEvictDirtyPage checks if the next page evicted from any shard is dirty
+func (p *Pool) MustEvictDirtyPage() bool {
+	for _, c := range p.shards {
+		c.Lock()
+		dirty := c.MustEvictDirtyPage()
+		c.Unlock()
+
+		if dirty {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FindVictim returns the frame Map would reuse for pageNumber
+func (p *Pool) FindVictim(pageNumber base.PageNumber) base.FrameID {
+	c, i := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	return p.global(i, c.FindVictim(pageNumber))
+}
+
+// Victim is FindVictim for a caller that can do without a frame, it
+// reports false instead of panicking when none can be evicted
+func (p *Pool) Victim(pageNumber base.PageNumber) (base.FrameID, bool) {
+	c, i := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	frameID, ok := c.Victim(pageNumber)
+
+	return p.global(i, frameID), ok
+}
+
+// Fetch looks pageNumber up and maps it when it is not cached, with the
+// shard latched throughout, see Cache.Fetch
+func (p *Pool) Fetch(pageNumber base.PageNumber, pin bool) (base.FrameID, faces.Lookup) {
+	c, i := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	frameID, lookup := c.Fetch(pageNumber, pin)
+
+	return p.global(i, frameID), lookup
+}
+
+// Loaded ends the loading of a page and wakes the callers waiting for it
+func (p *Pool) Loaded(pageNumber base.PageNumber, pin bool) bool {
+	c, _ := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	pinned := c.Loaded(pageNumber, pin)
+	c.loaded.Broadcast()
+
+	return pinned
+}
+
+// Wait returns once pageNumber is loaded, invalidated or written back, or
+// when it was neither loading nor being written
+func (p *Pool) Wait(pageNumber base.PageNumber) {
+	c, _ := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	for c.busy(pageNumber) {
+		c.loaded.Wait()
+	}
+}
+
+func (p *Pool) Flushing(pageNumber base.PageNumber, pinned bool) (base.FrameID, bool) {
+	c, i := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	frameID, ok := c.Flushing(pageNumber, pinned)
+
+	return p.global(i, frameID), ok
+}
+
+// Written ends a write back and wakes the callers waiting to pin the page
+func (p *Pool) Written(pageNumber base.PageNumber) {
+	c, _ := p.shard(pageNumber)
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.Written(pageNumber)
+	c.loaded.Broadcast()
+}
+
+// EachFrame calls fn with the frames of one shard at a time, the shard
+// stays latched meanwhile
+func (p *Pool) EachFrame(fn func(frame any)) {
+	for _, c := range p.shards {
+		c.RLock()
+		c.EachFrame(fn)
+		c.RUnlock()
+	}
+}
+
+// Lock latches every shard, for a caller working on the whole pool. The
+// other methods latch shards themselves and must not be called meanwhile.
+func (p *Pool) Lock() {
+	for _, c := range p.shards {
+		c.Lock()
+	}
+}
+
+func (p *Pool) Unlock() {
+	for i := len(p.shards) - 1; i >= 0; i-- {
+		p.shards[i].Unlock()
+	}
+}
+
+// RLock latches every shard for reading, see Lock
+func (p *Pool) RLock() {
+	for _, c := range p.shards {
+		c.RLock()
+	}
+}
+
+func (p *Pool) RUnlock() {
+	for i := len(p.shards) - 1; i >= 0; i-- {
+		p.shards[i].RUnlock()
+	}
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"container/list"
+
+	"github.com/dark-vinci/nildb/base"
+)
+
+// twoQ keeps pages used once in a FIFO queue. A page evicted from the
+// queue is remembered for a while, if it is asked for again it goes to an
+// LRU list of hot pages, so a scan only ever flushes the queue.
+type twoQ struct {
+	in     *list.List // pages used once, newest at the front
+	hotLRU *list.List // pages used again after leaving the queue, most recent at the front
+	out    *list.List // ghosts of the pages evicted from in
+	frames map[base.FrameID]*list.Element
+	ghosts map[base.PageNumber]*list.Element
+	kin    int // pages the queue holds before it gives up its oldest
+	kout   int // ghosts remembered
+}
+
+func newTwoQ(size int) *twoQ {
+	return &twoQ{
+		in:     list.New(),
+		hotLRU: list.New(),
+		out:    list.New(),
+		frames: make(map[base.FrameID]*list.Element),
+		ghosts: make(map[base.PageNumber]*list.Element),
+		kin:    max(1, size/4),
+		kout:   max(1, size/2),
+	}
+}
+
+func (q *twoQ) placed(frameID base.FrameID, pageNumber base.PageNumber, cold bool) {
+	e := &entry{frame: frameID, page: pageNumber, cold: cold}
+
+	// a page read ahead proves nothing until it is used
+	if !cold && q.forget(pageNumber) {
+		e.list = q.hotLRU
+	} else {
+		e.list = q.in
+	}
+
+	q.frames[frameID] = e.list.PushFront(e)
+}
+
+func (q *twoQ) accessed(frameID base.FrameID) {
+	var (
+		elem = q.frames[frameID]
+		e    = elem.Value.(*entry)
+	)
+
+	switch {
+	case e.cold:
+		e.cold = false
+
+		if q.forget(e.page) {
+			q.move(elem, q.hotLRU)
+		}
+	case e.list == q.hotLRU:
+		q.hotLRU.MoveToFront(elem)
+	}
+}
+
+func (q *twoQ) removed(frameID base.FrameID, pageNumber base.PageNumber, evicted bool) {
+	var (
+		elem = q.frames[frameID]
+		e    = elem.Value.(*entry)
+	)
+
+	e.list.Remove(elem)
+	delete(q.frames, frameID)
+
+	if !evicted || e.cold || e.list != q.in {
+		return
+	}
+
+	q.ghosts[pageNumber] = q.out.PushFront(&entry{page: pageNumber, list: q.out})
+
+	if q.out.Len() > q.kout {
+		q.forget(q.out.Back().Value.(*entry).page)
+	}
+}
+
+func (q *twoQ) pinned(base.FrameID, bool) {}
+
+func (q *twoQ) hot(frameID base.FrameID) bool {
+	return q.frames[frameID].Value.(*entry).list == q.hotLRU
+}
+
+// victim takes the oldest page of the queue once it is over its share,
+// the least recently used hot page otherwise
+func (q *twoQ) victim(evictable func(base.FrameID) bool) (base.FrameID, bool) {
+	first, second := q.hotLRU, q.in
+
+	if q.in.Len() > q.kin {
+		first, second = q.in, q.hotLRU
+	}
+
+	if frameID, ok := oldest(first, evictable); ok {
+		return frameID, true
+	}
+
+	return oldest(second, evictable)
+}
+
+// forget drops the ghost of pageNumber and reports whether there was one
+func (q *twoQ) forget(pageNumber base.PageNumber) bool {
+	elem, ok := q.ghosts[pageNumber]
+	if ok {
+		q.out.Remove(elem)
+		delete(q.ghosts, pageNumber)
+	}
+
+	return ok
+}
+
+// move puts the page of elem at the front of to
+func (q *twoQ) move(elem *list.Element, to *list.List) {
+	e := elem.Value.(*entry)
+
+	e.list.Remove(elem)
+	e.list = to
+	q.frames[e.frame] = to.PushFront(e)
+}
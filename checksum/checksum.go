@@ -0,0 +1,94 @@
+// Package checksum protects pages on disk. Every page keeps its checksum
+// in the first HeaderSize bytes, the disk worker fills them when the page
+// is written and checks them when it is read back.
+package checksum
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/dark-vinci/nildb/errors"
+)
+
+// Algorithm names the function that checksums the pages of a database,
+// it is chosen when the database is created
+type Algorithm uint8
+
+const (
+	None Algorithm = iota
+	CRC32C
+	XXHash32
+)
+
+// HeaderSize is the room every page header keeps at its start: the sum,
+// the algorithm that computed it and three reserved bytes
+const HeaderSize = 8
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Valid reports whether a is a known algorithm
+func (a Algorithm) Valid() bool {
+	return a <= XXHash32
+}
+
+func (a Algorithm) String() string {
+	switch a {
+	case None:
+		return "none"
+	case CRC32C:
+		return "crc32c"
+	case XXHash32:
+		return "xxhash32"
+	default:
+		return "unknown"
+	}
+}
+
+// Sum returns the checksum of data
+func (a Algorithm) Sum(data []byte) uint32 {
+	switch a {
+	case CRC32C:
+		return crc32.Checksum(data, castagnoli)
+	case XXHash32:
+		return xxHash32(data, 0)
+	default:
+		return 0
+	}
+}
+
+// Seal stores the checksum of page in its header. The sum covers every
+// byte after it, the algorithm included.
+func Seal(page []byte, a Algorithm) {
+	page[4] = byte(a)
+	clear(page[5:HeaderSize])
+	binary.LittleEndian.PutUint32(page, a.Sum(page[4:]))
+}
+
+// Verify checks the checksum stored in page pn. Pages that were never
+// written are all zeros and pass, so do all pages when a is None.
+func Verify(page []byte, a Algorithm, pn uint64) error {
+	if a == None || isZero(page) {
+		return nil
+	}
+
+	var (
+		stored = binary.LittleEndian.Uint32(page)
+		found  = a.Sum(page[4:])
+	)
+
+	if Algorithm(page[4]) != a || stored != found {
+		return &errors.PageCorruptedError{Page: pn, Expected: stored, Found: found}
+	}
+
+	return nil
+}
+
+func isZero(page []byte) bool {
+	for _, b := range page {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
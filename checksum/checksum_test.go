@@ -0,0 +1,71 @@
+package checksum
+
+import (
+	goerrors "errors"
+	"testing"
+
+	"github.com/dark-vinci/nildb/errors"
+)
+
+// TestXXHash32 verifies the hash against the reference values
+func TestXXHash32(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint32
+	}{
+		{input: "", expected: 0x02cc5d05},
+		{input: "abc", expected: 0x32d153ff},
+		{input: "Nobody inspects the spammish repetition", expected: 0xe2293b2f},
+	}
+
+	for _, tt := range tests {
+		if got := xxHash32([]byte(tt.input), 0); got != tt.expected {
+			t.Errorf("xxHash32(%q): expected %#x, got %#x", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestVerify verifies sealed pages pass and damaged ones are reported with their page number
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm Algorithm
+		damage    func(page []byte)
+		corrupted bool
+	}{
+		{name: "CRC32C intact", algorithm: CRC32C, damage: func([]byte) {}},
+		{name: "XXHash32 intact", algorithm: XXHash32, damage: func([]byte) {}},
+		{name: "Flipped bit", algorithm: CRC32C, damage: func(p []byte) { p[100] ^= 0x01 }, corrupted: true},
+		{name: "Torn write", algorithm: XXHash32, damage: func(p []byte) { clear(p[2048:]) }, corrupted: true},
+		{name: "Other algorithm", algorithm: CRC32C, damage: func(p []byte) { Seal(p, XXHash32) }, corrupted: true},
+		{name: "Never written", algorithm: CRC32C, damage: func(p []byte) { clear(p) }},
+		{name: "Unchecked", algorithm: None, damage: func(p []byte) { p[100] ^= 0x01 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := make([]byte, 4096)
+			for i := HeaderSize; i < len(page); i++ {
+				page[i] = byte(i * 7)
+			}
+
+			Seal(page, tt.algorithm)
+			tt.damage(page)
+
+			err := Verify(page, tt.algorithm, 42)
+
+			if !tt.corrupted {
+				if err != nil {
+					t.Fatalf("expected the page to pass, got %v", err)
+				}
+
+				return
+			}
+
+			var corrupted *errors.PageCorruptedError
+			if !goerrors.Is(err, errors.ErrPageCorrupted) || !goerrors.As(err, &corrupted) || corrupted.Page != 42 {
+				t.Errorf("expected ErrPageCorrupted for page 42, got %v", err)
+			}
+		})
+	}
+}
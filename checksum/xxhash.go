@@ -0,0 +1,66 @@
+package checksum
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	prime32x1 uint32 = 2654435761
+	prime32x2 uint32 = 2246822519
+	prime32x3 uint32 = 3266489917
+	prime32x4 uint32 = 668265263
+	prime32x5 uint32 = 374761393
+)
+
+func xxRound(acc, lane uint32) uint32 {
+	return bits.RotateLeft32(acc+lane*prime32x2, 13) * prime32x1
+}
+
+// xxHash32 is the 32-bit xxHash of data
+func xxHash32(data []byte, seed uint32) uint32 {
+	var (
+		le = binary.LittleEndian
+		n  = len(data)
+		h  uint32
+	)
+
+	if n >= 16 {
+		v1 := seed + prime32x1 + prime32x2
+		v2 := seed + prime32x2
+		v3 := seed
+		v4 := seed - prime32x1
+
+		for ; len(data) >= 16; data = data[16:] {
+			v1 = xxRound(v1, le.Uint32(data[0:]))
+			v2 = xxRound(v2, le.Uint32(data[4:]))
+			v3 = xxRound(v3, le.Uint32(data[8:]))
+			v4 = xxRound(v4, le.Uint32(data[12:]))
+		}
+
+		h = bits.RotateLeft32(v1, 1) + bits.RotateLeft32(v2, 7) +
+			bits.RotateLeft32(v3, 12) + bits.RotateLeft32(v4, 18)
+	} else {
+		h = seed + prime32x5
+	}
+
+	h += uint32(n)
+
+	for ; len(data) >= 4; data = data[4:] {
+		h += le.Uint32(data) * prime32x3
+		h = bits.RotateLeft32(h, 17) * prime32x4
+	}
+
+	for _, b := range data {
+		h += uint32(b) * prime32x5
+		h = bits.RotateLeft32(h, 11) * prime32x1
+	}
+
+	h ^= h >> 15
+	h *= prime32x2
+	h ^= h >> 13
+	h *= prime32x3
+	h ^= h >> 16
+
+	return h
+}
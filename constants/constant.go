@@ -4,4 +4,14 @@ const (
 	OverFlowPage = "OVERFLOW"
 	PageZero     = "ZERO"
 	BTreePage    = "B+TREE"
+	FreeListPage = "FREELIST"
+
+	DatabaseMagic = "nildb\x00\x00\x00" // first bytes of every database file
+	FormatVersion = 2
+
+	LogMagic   = "nildbwal" // first bytes of every write-ahead log
+	LogVersion = 1
+
+	DoubleWriteMagic   = "nildbdwb" // first bytes of every double-write area
+	DoubleWriteVersion = 1
 )
@@ -9,12 +9,21 @@ const (
 	DefaultPinPercentageLimit = 50.0
 	DefaultLruK               = 2
 	DefaultCRP                = uint64(0)
+	DefaultCacheShards        = 16 // shards of a cache.Pool
 	DirtyFlag                 = 0x02
 	PinnedFlag                = 0x04
-	BatchSize                 = 100
-	BatchTimeout              = time.Millisecond * 10
+	PrefetchedFlag            = 0x08 // read ahead and not used yet
+	LoadingFlag               = 0x10 // being read from disk, not usable yet
+	WritingFlag               = 0x20 // being written back, not pinned until written
+	BatchSize                 = 100  // requests a disk worker serves together at most
+	DefaultDiskWorkers        = 4
+	DefaultQueueDepth         = 100 // requests queued per disk worker goroutine
+	DefaultReadAhead          = 8   // pages read ahead of a sequential scan
 	PageAlignment             = 4096
 	MinPageSize               = 512   // Minimum page size.
 	MaxPageSize               = 65536 // Maximum page size.
 	CellAlignment             = 8
+	DefaultLogSegmentSize     = 16 << 20 // bytes after which the log starts a new segment
+	DefaultCheckpointInterval = time.Minute
+	DefaultCheckpointLogSize  = 64 << 20 // log size that triggers a checkpoint early
 )
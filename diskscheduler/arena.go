@@ -0,0 +1,64 @@
+package diskscheduler
+
+import (
+	"unsafe"
+
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/utils"
+)
+
+// arena holds the sealed copies of the pages a worker writes. Its memory
+// lives as long as the worker, so a ring can register it once and write
+// from it with the fixed ops.
+type arena struct {
+	memory   []byte
+	pageSize int
+	free     chan *[]byte
+}
+
+// newArena carves count buffers of pageSize bytes out of one allocation
+func newArena(pageSize, count int) *arena {
+	a := &arena{
+		memory:   utils.AlignedBuffer(pageSize*count, constants.PageAlignment),
+		pageSize: pageSize,
+		free:     make(chan *[]byte, count),
+	}
+
+	for i := range count {
+		buf := a.memory[i*pageSize : (i+1)*pageSize : (i+1)*pageSize]
+		a.free <- &buf
+	}
+
+	return a
+}
+
+// get returns a free buffer of the arena, or one of its own when they are
+// all in use
+func (a *arena) get() *[]byte {
+	select {
+	case buf := <-a.free:
+		return buf
+	default:
+	}
+
+	buf := utils.AlignedBuffer(a.pageSize, constants.PageAlignment)
+
+	return &buf
+}
+
+// put hands back a buffer of get, the ones outside the arena are left to the GC
+func (a *arena) put(buf *[]byte) {
+	if a.holds(*buf) {
+		a.free <- buf
+	}
+}
+
+// holds reports whether data lies in the arena
+func (a *arena) holds(data []byte) bool {
+	var (
+		addr  = uintptr(unsafe.Pointer(unsafe.SliceData(data)))
+		start = uintptr(unsafe.Pointer(&a.memory[0]))
+	)
+
+	return addr >= start && addr < start+uintptr(len(a.memory))
+}
@@ -0,0 +1,135 @@
+package diskscheduler
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dark-vinci/nildb/blocks"
+	"github.com/dark-vinci/nildb/checksum"
+	"github.com/dark-vinci/nildb/constants"
+)
+
+type Builder struct {
+	PageSize    uint
+	Checksum    checksum.Algorithm // sealed on every write and checked on every read
+	DoubleWrite *DoubleWrite       // protects writes against torn pages when set
+	Workers     int                // goroutines serving requests
+	QueueDepth  int                // requests each goroutine queues before callers block
+	IOUring     bool               // submit batches through io_uring where the kernel allows it
+}
+
+func NewBuilder() *Builder {
+	return &Builder{
+		PageSize:    constants.DefaultPageSize,
+		Checksum:    checksum.None,
+		DoubleWrite: nil,
+		Workers:     constants.DefaultDiskWorkers,
+		QueueDepth:  constants.DefaultQueueDepth,
+		IOUring:     false,
+	}
+}
+
+func (b *Builder) SetPageSize(pageSize uint) *Builder {
+	b.PageSize = pageSize
+	return b
+}
+
+func (b *Builder) SetChecksum(sum checksum.Algorithm) *Builder {
+	b.Checksum = sum
+	return b
+}
+
+func (b *Builder) SetDoubleWrite(doubleWrite *DoubleWrite) *Builder {
+	b.DoubleWrite = doubleWrite
+	return b
+}
+
+func (b *Builder) SetWorkers(workers int) *Builder {
+	if workers < 1 {
+		panic(fmt.Sprintf("a disk worker needs at least one goroutine, got %d", workers))
+	}
+
+	b.Workers = workers
+	return b
+}
+
+func (b *Builder) SetQueueDepth(depth int) *Builder {
+	if depth < 1 {
+		panic(fmt.Sprintf("queue depth must be at least 1, got %d", depth))
+	}
+
+	b.QueueDepth = depth
+	return b
+}
+
+// SetIOUring makes every goroutine submit its batches through its own
+// io_uring instance, pages move in place and their memory is registered
+// with it once. When one goroutine is refused io_uring or the file has no
+// descriptor, they all keep the block layer, IOUring tells which one they
+// use.
+func (b *Builder) SetIOUring(enabled bool) *Builder {
+	b.IOUring = enabled
+	return b
+}
+
+// Build starts the goroutines of a worker reading and writing block
+func (b *Builder) Build(block blocks.Block) *DiskWorker {
+	worker := &DiskWorker{
+		shards:      make([]*shard, b.Workers),
+		blockIO:     block,
+		pageSize:    b.PageSize,
+		checksum:    b.Checksum,
+		doubleWrite: b.DoubleWrite,
+		// a goroutine seals a batch of writes at most at a time
+		buffers:   newArena(int(b.PageSize), b.Workers*constants.BatchSize),
+		stopChan:  make(chan struct{}),
+		waitGroup: sync.WaitGroup{},
+	}
+
+	var rings []pageIO
+
+	if b.IOUring {
+		rings = newRings(block, int(b.PageSize), b.Workers, worker.buffers)
+		worker.uring = rings != nil
+	}
+
+	for i := range worker.shards {
+		s := &shard{
+			queue: make(chan *queued, b.QueueDepth),
+			pages: &blockIO{block: block},
+		}
+
+		if rings != nil {
+			s.pages = rings[i]
+		}
+
+		worker.shards[i] = s
+		worker.waitGroup.Add(1)
+
+		go worker.serve(s)
+	}
+
+	return worker
+}
+
+// newRings sets up one ring per goroutine, or none once one is refused so
+// every goroutine of a worker reaches the file the same way. Each ring
+// registers the arena of the worker.
+func newRings(block blocks.Block, pageSize, count int, buffers *arena) []pageIO {
+	rings := make([]pageIO, 0, count)
+
+	for range count {
+		ring, err := newRingIO(block, pageSize, buffers)
+		if err != nil {
+			for _, r := range rings {
+				_ = r.close()
+			}
+
+			return nil
+		}
+
+		rings = append(rings, ring)
+	}
+
+	return rings
+}
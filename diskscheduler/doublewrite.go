@@ -0,0 +1,207 @@
+package diskscheduler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"math"
+	"time"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/blocks"
+	"github.com/dark-vinci/nildb/checksum"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/interfaces"
+)
+
+const (
+	// doubleWriteHeaderSize holds magic, version, page size, batch, count and crc
+	doubleWriteHeaderSize = 32
+	// doubleWriteEntrySize is what goes in front of every page: number, batch and crc
+	doubleWriteEntrySize = 24
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// DoubleWrite is the scratch area a batch of pages goes through before
+// the pages are written in place. A crash can tear a page in the data
+// file but not its copy here, Restore puts the copies back on open.
+type DoubleWrite struct {
+	file     faces.IOOperator
+	pageSize int
+	batch    uint64 // id of the last batch, entries of older ones are ignored
+	buf      []byte
+	held     error // why the last batch must stay for Restore
+}
+
+// NewDoubleWrite uses file as the double-write area of pages of pageSize bytes
+func NewDoubleWrite(file faces.IOOperator, pageSize int) *DoubleWrite {
+	return &DoubleWrite{
+		file:     file,
+		pageSize: pageSize,
+		// ids start from the clock so a reopened area never reuses one
+		batch: uint64(time.Now().UnixNano()),
+	}
+}
+
+// Write stores a batch in the area and syncs it, pages[i] belongs to page
+// numbers[i]. Everything goes out in a single sequential write.
+func (d *DoubleWrite) Write(numbers []base.PageNumber, pages [][]byte) error {
+	if d.held != nil {
+		return d.held
+	}
+
+	d.batch++
+
+	var (
+		le   = binary.LittleEndian
+		size = doubleWriteHeaderSize + len(pages)*(doubleWriteEntrySize+d.pageSize)
+	)
+
+	if cap(d.buf) < size {
+		d.buf = make([]byte, size)
+	}
+
+	buf := d.buf[:size]
+
+	copy(buf, constants.DoubleWriteMagic)
+	le.PutUint32(buf[8:], constants.DoubleWriteVersion)
+	le.PutUint32(buf[12:], uint32(d.pageSize))
+	le.PutUint64(buf[16:], d.batch)
+	le.PutUint32(buf[24:], uint32(len(pages)))
+	le.PutUint32(buf[28:], crc32.Checksum(buf[:28], castagnoli))
+
+	at := doubleWriteHeaderSize
+
+	for i, page := range pages {
+		entry := buf[at : at+doubleWriteEntrySize+d.pageSize]
+
+		le.PutUint64(entry, uint64(numbers[i]))
+		le.PutUint64(entry[8:], d.batch)
+		copy(entry[doubleWriteEntrySize:], page)
+		le.PutUint32(entry[16:], entryChecksum(entry))
+
+		at += len(entry)
+	}
+
+	if _, err := d.file.WriteAt(buf, 0); err != nil {
+		return err
+	}
+
+	return d.file.Sync()
+}
+
+// Hold keeps the last batch in the area after its pages failed to reach
+// their place, they may be torn and only Restore can repair them. Every
+// later batch is refused with err.
+func (d *DoubleWrite) Hold(err error) {
+	if d.held == nil {
+		d.held = err
+	}
+}
+
+// entryChecksum covers the page number, the batch and the page of an entry
+func entryChecksum(entry []byte) uint32 {
+	sum := crc32.Checksum(entry[:16], castagnoli)
+
+	return crc32.Update(sum, castagnoli, entry[doubleWriteEntrySize:])
+}
+
+// Restore writes back the pages of the last batch that are torn in place,
+// syncs the data file and empties the area. The batch may have been
+// interrupted anywhere, pages that fail their checksum, or are missing, are
+// rewritten whole. It returns the number of pages restored.
+func (d *DoubleWrite) Restore(block *blocks.Block) (int, error) {
+	var (
+		le     = binary.LittleEndian
+		header = make([]byte, doubleWriteHeaderSize)
+		area   = io.NewSectionReader(d.file, 0, math.MaxInt64)
+	)
+
+	// an empty area, or one torn before its sync, has nothing the data file misses
+	if _, err := io.ReadFull(area, header); err != nil ||
+		string(header[:8]) != constants.DoubleWriteMagic ||
+		le.Uint32(header[28:]) != crc32.Checksum(header[:28], castagnoli) {
+		return 0, nil
+	}
+
+	if version := le.Uint32(header[8:]); version != constants.DoubleWriteVersion {
+		return 0, &errors.HeaderMismatchError{Field: "double-write version", Expected: constants.DoubleWriteVersion, Found: uint64(version)}
+	}
+
+	if pageSize := le.Uint32(header[12:]); int(pageSize) != d.pageSize {
+		return 0, &errors.HeaderMismatchError{Field: "double-write page size", Expected: uint64(d.pageSize), Found: uint64(pageSize)}
+	}
+
+	var (
+		batch    = le.Uint64(header[16:])
+		count    = int(le.Uint32(header[24:]))
+		entry    = make([]byte, doubleWriteEntrySize+d.pageSize)
+		page     = make([]byte, d.pageSize)
+		restored int
+	)
+
+	for i := 0; i < count; i++ {
+		if _, err := io.ReadFull(area, entry); err != nil {
+			break
+		}
+
+		if le.Uint64(entry[8:]) != batch || le.Uint32(entry[16:]) != entryChecksum(entry) {
+			continue
+		}
+
+		pn, image := int(le.Uint64(entry)), entry[doubleWriteEntrySize:]
+
+		if !torn(block, pn, image, page) {
+			continue
+		}
+
+		if err := block.Write(pn, image); err != nil {
+			return restored, err
+		}
+
+		restored++
+	}
+
+	if restored > 0 {
+		if err := block.Sync(); err != nil {
+			return restored, err
+		}
+	}
+
+	// pages written later without the area must not be reverted by a second restore
+	return restored, d.reset()
+}
+
+// torn reports whether the page at pn in the data file may not hold image.
+// The page is checked with the algorithm image was sealed with, unchecked
+// pages can only be compared with it.
+func torn(block *blocks.Block, pn int, image, page []byte) bool {
+	if err := block.Read(pn, page); err != nil {
+		return true
+	}
+
+	if bytes.Equal(page, image) {
+		return false
+	}
+
+	sum := checksum.Algorithm(image[4])
+
+	// a page never written passes its checksum but is not the copy
+	if sum == checksum.None || len(bytes.TrimLeft(page, "\x00")) == 0 {
+		return true
+	}
+
+	return checksum.Verify(page, sum, uint64(pn)) != nil
+}
+
+// reset empties the area once the pages of its batch are durable in place
+func (d *DoubleWrite) reset() error {
+	if _, err := d.file.WriteAt(make([]byte, doubleWriteHeaderSize), 0); err != nil {
+		return err
+	}
+
+	return d.file.Sync()
+}
@@ -1,33 +1,153 @@
 package diskscheduler
 
 import (
+	"context"
+
 	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/errors"
 	"github.com/dark-vinci/nildb/interfaces"
 )
 
+// Read queues a foreground read of pageNumber into page
 func (w *DiskWorker) Read(pageNumber base.PageNumber, page faces.PageHandle) chan faces.DiskResult {
-	resultChan := make(chan faces.DiskResult, 1)
+	return w.ReadContext(context.Background(), pageNumber, page)
+}
 
-	w.queue <- faces.DiskRequest{
+// ReadContext is Read for a caller that may give up, see SubmitContext
+func (w *DiskWorker) ReadContext(ctx context.Context, pageNumber base.PageNumber, page faces.PageHandle) chan faces.DiskResult {
+	return w.SubmitContext(ctx, faces.DiskRequest{
 		Type:       base.ReadOp,
 		PageNumber: pageNumber,
 		Page:       page,
-		ResultChan: resultChan,
-	}
-
-	return resultChan
+		Priority:   base.ForegroundRead,
+	})
 }
 
+// Write queues an eviction write of page to pageNumber
 func (w *DiskWorker) Write(pageNumber base.PageNumber, page faces.PageHandle) chan faces.DiskResult {
-	resultChan := make(chan faces.DiskResult, 1)
+	return w.WriteContext(context.Background(), pageNumber, page)
+}
 
-	w.queue <- faces.DiskRequest{
+// WriteContext is Write for a caller that may give up, see SubmitContext
+func (w *DiskWorker) WriteContext(ctx context.Context, pageNumber base.PageNumber, page faces.PageHandle) chan faces.DiskResult {
+	return w.SubmitContext(ctx, faces.DiskRequest{
 		Type:       base.WriteOp,
 		PageNumber: pageNumber,
 		Page:       page,
-		ResultChan: resultChan,
+		Priority:   base.EvictionWrite,
+	})
+}
+
+// Submit queues a read or write, its result arrives on the returned channel
+func (w *DiskWorker) Submit(req faces.DiskRequest) chan faces.DiskResult {
+	return w.SubmitContext(context.Background(), req)
+}
+
+// SubmitContext queues a read or write until ctx is done. A request
+// cancelled before a worker takes it fails at once with the error of ctx
+// and its page is never touched, one already being served runs to the
+// end. The deadline of ctx is the deadline of a request without one.
+func (w *DiskWorker) SubmitContext(ctx context.Context, req faces.DiskRequest) chan faces.DiskResult {
+	if req.Type == base.SyncOp {
+		return w.Sync()
+	}
+
+	req.ResultChan = make(chan faces.DiskResult, 1)
+
+	if req.Priority >= base.PriorityClasses {
+		req.ResultChan <- faces.DiskResult{PageNumber: req.PageNumber, Page: req.Page, Error: errors.ErrInvalidPriority}
+		return req.ResultChan
+	}
+
+	if err := ctx.Err(); err != nil {
+		req.ResultChan <- faces.DiskResult{PageNumber: req.PageNumber, Page: req.Page, Error: err}
+		return req.ResultChan
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && req.Deadline.IsZero() {
+		req.Deadline = deadline
+	}
+
+	q := &queued{DiskRequest: req}
+
+	w.queued[req.Priority].Add(1)
+
+	if ctx.Done() != nil {
+		q.stop = context.AfterFunc(ctx, func() {
+			if q.state.CompareAndSwap(waiting, dropped) {
+				w.queued[req.Priority].Add(-1)
+				req.ResultChan <- faces.DiskResult{PageNumber: req.PageNumber, Page: req.Page, Error: ctx.Err()}
+			}
+		})
 	}
 
+	select {
+	case w.queueFor(req.PageNumber) <- q:
+	case <-ctx.Done():
+		// the request never reached a queue, the callback answers it
+	}
+
+	return req.ResultChan
+}
+
+// TrySubmit is Submit for a request that can do without being served,
+// such as a read ahead. It never waits for room in a queue: when the queue
+// of the page is full the request is dropped and false is returned. Syncs
+// and requests of no class are handed to Submit.
+func (w *DiskWorker) TrySubmit(req faces.DiskRequest) (chan faces.DiskResult, bool) {
+	if req.Type == base.SyncOp || req.Priority >= base.PriorityClasses {
+		return w.Submit(req), true
+	}
+
+	req.ResultChan = make(chan faces.DiskResult, 1)
+	q := &queued{DiskRequest: req}
+
+	w.queued[req.Priority].Add(1)
+
+	select {
+	case w.queueFor(req.PageNumber) <- q:
+		return req.ResultChan, true
+	default:
+		w.queued[req.Priority].Add(-1)
+		return nil, false
+	}
+}
+
+// QueueLength returns the number of requests of class not taken by a batch yet
+func (w *DiskWorker) QueueLength(class base.Priority) int {
+	if class >= base.PriorityClasses {
+		return 0
+	}
+
+	return int(w.queued[class].Load())
+}
+
+// Sync queues a barrier behind the writes of every worker and syncs the
+// file once all of them reached it. Syncs waiting at the same time share
+// one fsync, each is answered once the fsync covering it is done.
+func (w *DiskWorker) Sync() chan faces.DiskResult {
+	var (
+		resultChan = make(chan faces.DiskResult, 1)
+		barriers   = make([]chan faces.DiskResult, len(w.shards))
+	)
+
+	for i, s := range w.shards {
+		barriers[i] = make(chan faces.DiskResult, 1)
+
+		s.queue <- &queued{DiskRequest: faces.DiskRequest{
+			Type:       base.SyncOp,
+			ResultChan: barriers[i],
+		}}
+	}
+
+	go func() {
+		for _, barrier := range barriers {
+			<-barrier
+		}
+
+		w.groupSync(resultChan)
+	}()
+
 	return resultChan
 }
 
@@ -0,0 +1,74 @@
+package diskscheduler
+
+import (
+	"sort"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/blocks"
+)
+
+// pageOp is one whole page read or written by a batch
+type pageOp struct {
+	write bool
+	page  base.PageNumber
+	data  []byte
+}
+
+// pageIO moves the pages of a batch between memory and the data file, each
+// goroutine of a worker has its own
+type pageIO interface {
+	// transfer runs ops, never two on the same page, and returns the error
+	// of each. A read past the end of the file fails with io.EOF.
+	transfer(ops []pageOp) []error
+	close() error
+}
+
+// blockIO runs the reads, then the writes, through the block layer. Each
+// are sorted by page, so consecutive pages move in one call to the file.
+type blockIO struct {
+	block blocks.Block
+}
+
+func (b *blockIO) transfer(ops []pageOp) []error {
+	errs := make([]error, len(ops))
+
+	for _, write := range []bool{false, true} {
+		var indexes []int
+
+		for i, op := range ops {
+			if op.write == write {
+				indexes = append(indexes, i)
+			}
+		}
+
+		sort.Slice(indexes, func(i, j int) bool {
+			return ops[indexes[i]].page < ops[indexes[j]].page
+		})
+
+		var (
+			numbers = make([]int, len(indexes))
+			buffs   = make([][]byte, len(indexes))
+			done    []error
+		)
+
+		for k, i := range indexes {
+			numbers[k], buffs[k] = int(ops[i].page), ops[i].data
+		}
+
+		if write {
+			done = b.block.WritePages(numbers, buffs)
+		} else {
+			done = b.block.ReadPages(numbers, buffs)
+		}
+
+		for k, i := range indexes {
+			errs[i] = done[k]
+		}
+	}
+
+	return errs
+}
+
+func (b *blockIO) close() error {
+	return nil
+}
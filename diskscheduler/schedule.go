@@ -0,0 +1,94 @@
+package diskscheduler
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/interfaces"
+)
+
+const (
+	waiting int32 = iota
+	taken         // a worker serves it
+	dropped       // the caller gave up first
+)
+
+// queued is a request in the queue of a worker. Its state tells whether
+// the worker or a cancelled caller got to it first.
+type queued struct {
+	faces.DiskRequest
+	state atomic.Int32
+	stop  func() bool // unregisters the cancellation callback, nil without one
+}
+
+// take claims q for a worker, false when its caller gave up
+func (q *queued) take() bool {
+	if !q.state.CompareAndSwap(waiting, taken) {
+		return false
+	}
+
+	if q.stop != nil {
+		q.stop()
+	}
+
+	return true
+}
+
+// urgency orders requests: late ones first, then by class, then by deadline
+type urgency struct {
+	late     bool
+	class    base.Priority
+	deadline time.Time // zero for none, it comes after every deadline
+}
+
+func urgencyOf(req *queued, now time.Time) urgency {
+	return urgency{
+		late:     !req.Deadline.IsZero() && !now.Before(req.Deadline),
+		class:    req.Priority,
+		deadline: req.Deadline,
+	}
+}
+
+func (u urgency) before(other urgency) bool {
+	if u.late != other.late {
+		return u.late
+	}
+
+	if u.class != other.class {
+		return u.class < other.class
+	}
+
+	if u.deadline.IsZero() || other.deadline.IsZero() {
+		return !u.deadline.IsZero() && other.deadline.IsZero()
+	}
+
+	return u.deadline.Before(other.deadline)
+}
+
+// schedule picks the next batch among pending requests. A page is as
+// urgent as its most urgent request and its requests keep their order,
+// so a foreground read lifts the write queued before it on the same page.
+// The requests left keep the per page order for the next call.
+func schedule(pending []*queued, now time.Time) (batch, rest []*queued) {
+	pages := make(map[base.PageNumber]urgency, len(pending))
+
+	for _, req := range pending {
+		u := urgencyOf(req, now)
+
+		if current, ok := pages[req.PageNumber]; !ok || u.before(current) {
+			pages[req.PageNumber] = u
+		}
+	}
+
+	// stable, so requests of a page, which share their urgency, stay in order
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pages[pending[i].PageNumber].before(pages[pending[j].PageNumber])
+	})
+
+	n := min(len(pending), constants.BatchSize)
+
+	return pending[:n:n], pending[n:]
+}
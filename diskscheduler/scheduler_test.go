@@ -1 +1,839 @@
 package diskscheduler
+
+import (
+	"bytes"
+	"context"
+	goerrors "errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/blocks"
+	"github.com/dark-vinci/nildb/checksum"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/files"
+	"github.com/dark-vinci/nildb/interfaces"
+	"github.com/dark-vinci/nildb/pages"
+)
+
+// gateFile holds every read until want of them are in flight, or a second
+// passed, and records how many it saw at once
+type gateFile struct {
+	*files.MemFile
+	want     int
+	lock     sync.Mutex
+	inFlight int
+	most     int
+	arrived  chan struct{}
+}
+
+func (g *gateFile) ReadAt(p []byte, off int64) (int, error) {
+	g.lock.Lock()
+	g.inFlight++
+	g.most = max(g.most, g.inFlight)
+
+	if g.inFlight == g.want {
+		close(g.arrived)
+	}
+	g.lock.Unlock()
+
+	select {
+	case <-g.arrived:
+	case <-time.After(time.Second):
+	}
+
+	g.lock.Lock()
+	g.inFlight--
+	g.lock.Unlock()
+
+	return g.MemFile.ReadAt(p, off)
+}
+
+func newWorker(file faces.IOOperator, workers int, uring bool) *DiskWorker {
+	return newBuilder(workers).SetIOUring(uring).Build(*blocks.NewBlock(file, constants.DefaultPageSize, constants.DefaultPageSize))
+}
+
+func newBuilder(workers int) *Builder {
+	return NewBuilder().SetChecksum(checksum.CRC32C).SetWorkers(workers)
+}
+
+// diskFile creates a file in a temporary directory
+func diskFile(t *testing.T) faces.IOOperator {
+	file, err := files.NewFile(filepath.Join(t.TempDir(), "pages")).Create()
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	t.Cleanup(func() { _ = file.Close() })
+
+	return file
+}
+
+// filled returns a page whose content is value
+func filled(t *testing.T, value byte) faces.PageHandle {
+	page := pages.Alloc(constants.DefaultPageSize)
+
+	data, err := pageBytes(page)
+	if err != nil {
+		t.Fatalf("page has no bytes: %v", err)
+	}
+
+	for i := checksum.HeaderSize; i < len(data); i++ {
+		data[i] = value
+	}
+
+	return page
+}
+
+// TestPageOrder verifies requests queued for a page without waiting are
+// served in order, whatever the number of workers and the way they do I/O
+func TestPageOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		uring   bool
+		file    func(t *testing.T) faces.IOOperator
+	}{
+		{name: "Single worker", workers: 1, file: func(*testing.T) faces.IOOperator { return &files.MemFile{} }},
+		{name: "Pool", workers: 4, file: func(*testing.T) faces.IOOperator { return &files.MemFile{} }},
+		{name: "io_uring", workers: 4, uring: true, file: diskFile},
+		{name: "io_uring without a descriptor", workers: 1, uring: true, file: func(*testing.T) faces.IOOperator { return &files.MemFile{} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worker := newWorker(tt.file(t), tt.workers, tt.uring)
+			defer worker.Stop()
+
+			if !tt.uring && worker.IOUring() {
+				t.Fatalf("expected the block layer")
+			}
+
+			t.Logf("io_uring in use: %v", worker.IOUring())
+
+			var (
+				writes []chan faces.DiskResult
+				reads  []chan faces.DiskResult
+				want   []byte
+			)
+
+			for round := 0; round < 5; round++ {
+				for pn := base.PageNumber(0); pn < 8; pn++ {
+					value := byte(round*8) + byte(pn) + 1
+
+					writes = append(writes, worker.Write(pn, filled(t, value)))
+					reads = append(reads, worker.Read(pn, pages.Alloc(constants.DefaultPageSize)))
+					want = append(want, value)
+				}
+			}
+
+			for i, result := range writes {
+				if r := <-result; r.Error != nil {
+					t.Fatalf("write %d failed: %v", i, r.Error)
+				}
+			}
+
+			for i, result := range reads {
+				r := <-result
+				if r.Error != nil {
+					t.Fatalf("read %d failed: %v", i, r.Error)
+				}
+
+				data, _ := pageBytes(r.Page)
+				if got := data[len(data)-1]; got != want[i] {
+					t.Errorf("read %d of page %d saw %d, expected the write before it: %d", i, r.PageNumber, got, want[i])
+				}
+			}
+
+			if r := <-worker.Sync(); r.Error != nil {
+				t.Fatalf("sync failed: %v", r.Error)
+			}
+		})
+	}
+}
+
+// TestRingMemory verifies pages written and read through io_uring land in
+// their own memory, with more writes queued than the arena holds
+func TestRingMemory(t *testing.T) {
+	const count = 1500
+
+	worker := newWorker(diskFile(t), 1, true)
+	defer worker.Stop()
+
+	t.Logf("io_uring in use: %v", worker.IOUring())
+
+	var (
+		writes = make([]chan faces.DiskResult, count)
+		reads  = make([]chan faces.DiskResult, count)
+	)
+
+	for pn := range count {
+		writes[pn] = worker.Write(base.PageNumber(pn), filled(t, byte(pn)))
+	}
+
+	for pn, result := range writes {
+		if r := <-result; r.Error != nil {
+			t.Fatalf("write of page %d failed: %v", pn, r.Error)
+		}
+	}
+
+	for pn := range count {
+		reads[pn] = worker.Read(base.PageNumber(pn), pages.Alloc(constants.DefaultPageSize))
+	}
+
+	for pn, result := range reads {
+		r := <-result
+		if r.Error != nil {
+			t.Fatalf("read of page %d failed: %v", pn, r.Error)
+		}
+
+		data, _ := pageBytes(r.Page)
+		if got := data[len(data)-1]; got != byte(pn) {
+			t.Fatalf("page %d read %d, expected %d", pn, got, byte(pn))
+		}
+	}
+}
+
+// TestShortLastPage verifies the last page of a file cut short reads with
+// its missing part as zeros, and the page after it as a page never written
+func TestShortLastPage(t *testing.T) {
+	for _, uring := range []bool{false, true} {
+		t.Run(fmt.Sprintf("io_uring %v", uring), func(t *testing.T) {
+			var (
+				file = diskFile(t)
+				page = make([]byte, constants.DefaultPageSize)
+				half = len(page) / 2
+			)
+
+			for i := checksum.HeaderSize; i < half; i++ {
+				page[i] = 7
+			}
+
+			checksum.Seal(page, checksum.CRC32C)
+
+			if _, err := file.WriteAt(page[:half], constants.DefaultPageSize); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+
+			worker := newWorker(file, 1, uring)
+			defer worker.Stop()
+
+			tests := []struct {
+				pn   base.PageNumber
+				want []byte
+			}{
+				{pn: 1, want: page},
+				{pn: 2, want: make([]byte, len(page))},
+			}
+
+			for _, tt := range tests {
+				r := <-worker.Read(tt.pn, pages.Alloc(constants.DefaultPageSize))
+				if r.Error != nil {
+					t.Fatalf("read of page %d failed: %v", tt.pn, r.Error)
+				}
+
+				if data, _ := pageBytes(r.Page); !slices.Equal(data, tt.want) {
+					t.Errorf("page %d read different bytes than expected", tt.pn)
+				}
+			}
+		})
+	}
+}
+
+// TestParallelReads verifies reads of pages owned by different workers are in flight together
+func TestParallelReads(t *testing.T) {
+	const workers = 4
+
+	file := &gateFile{MemFile: &files.MemFile{}, want: workers, arrived: make(chan struct{})}
+
+	worker := newWorker(file, workers, false)
+	defer worker.Stop()
+
+	results := make([]chan faces.DiskResult, workers)
+
+	for pn := range results {
+		results[pn] = worker.Read(base.PageNumber(pn), pages.Alloc(constants.DefaultPageSize))
+	}
+
+	for _, result := range results {
+		if r := <-result; r.Error != nil {
+			t.Fatalf("read failed: %v", r.Error)
+		}
+	}
+
+	if file.most != workers {
+		t.Errorf("expected %d reads in flight together, saw %d", workers, file.most)
+	}
+}
+
+// blockedFile holds every read until release is closed and tells started
+// when the first one arrives
+type blockedFile struct {
+	*files.MemFile
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (b *blockedFile) ReadAt(p []byte, off int64) (int, error) {
+	b.once.Do(func() { close(b.started) })
+	<-b.release
+
+	return b.MemFile.ReadAt(p, off)
+}
+
+func request(op base.DiskOperation, pn base.PageNumber, class base.Priority, deadline time.Time) *queued {
+	return &queued{DiskRequest: faces.DiskRequest{Type: op, PageNumber: pn, Priority: class, Deadline: deadline}}
+}
+
+// TestSchedule verifies batches go by lateness, class and deadline, and a
+// page keeps the order of its requests
+func TestSchedule(t *testing.T) {
+	var (
+		now  = time.Now()
+		soon = now.Add(time.Millisecond)
+		late = now.Add(-time.Millisecond)
+	)
+
+	tests := []struct {
+		name    string
+		pending []*queued
+		want    []string // operation and page of the batch in order
+	}{
+		{
+			name: "By class",
+			pending: []*queued{
+				request(base.ReadOp, 1, base.PrefetchRead, time.Time{}),
+				request(base.WriteOp, 2, base.CheckpointWrite, time.Time{}),
+				request(base.WriteOp, 3, base.EvictionWrite, time.Time{}),
+				request(base.ReadOp, 4, base.ForegroundRead, time.Time{}),
+			},
+			want: []string{"r4", "w3", "w2", "r1"},
+		},
+		{
+			name: "Deadlines inside a class",
+			pending: []*queued{
+				request(base.ReadOp, 1, base.ForegroundRead, time.Time{}),
+				request(base.ReadOp, 2, base.ForegroundRead, now.Add(time.Second)),
+				request(base.ReadOp, 3, base.ForegroundRead, soon),
+			},
+			want: []string{"r3", "r2", "r1"},
+		},
+		{
+			name: "Late requests first",
+			pending: []*queued{
+				request(base.ReadOp, 1, base.ForegroundRead, time.Time{}),
+				request(base.ReadOp, 2, base.PrefetchRead, late),
+			},
+			want: []string{"r2", "r1"},
+		},
+		{
+			name: "A read lifts the write before it",
+			pending: []*queued{
+				request(base.WriteOp, 1, base.CheckpointWrite, time.Time{}),
+				request(base.WriteOp, 2, base.EvictionWrite, time.Time{}),
+				request(base.WriteOp, 3, base.CheckpointWrite, time.Time{}),
+				request(base.ReadOp, 3, base.ForegroundRead, time.Time{}),
+			},
+			want: []string{"w3", "r3", "w2", "w1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch, rest := schedule(tt.pending, now)
+
+			if len(rest) != 0 {
+				t.Fatalf("expected a single batch, %d requests left", len(rest))
+			}
+
+			got := make([]string, len(batch))
+
+			for i, req := range batch {
+				got[i] = fmt.Sprintf("%c%d", req.Type[0], req.PageNumber)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestQueueLength verifies requests are counted per class until a batch takes them
+func TestQueueLength(t *testing.T) {
+	file := &blockedFile{MemFile: &files.MemFile{}, started: make(chan struct{}), release: make(chan struct{})}
+
+	worker := newWorker(file, 1, false)
+	defer worker.Stop()
+
+	results := []chan faces.DiskResult{worker.Read(0, pages.Alloc(constants.DefaultPageSize))}
+
+	// the worker is stuck in the first read, the rest stays queued
+	<-file.started
+
+	results = append(results,
+		worker.Write(1, filled(t, 1)),
+		worker.Write(2, filled(t, 2)),
+		worker.Submit(faces.DiskRequest{Type: base.ReadOp, PageNumber: 3, Page: pages.Alloc(constants.DefaultPageSize), Priority: base.PrefetchRead}),
+	)
+
+	want := map[base.Priority]int{base.ForegroundRead: 0, base.EvictionWrite: 2, base.CheckpointWrite: 0, base.PrefetchRead: 1}
+
+	for class, n := range want {
+		if got := worker.QueueLength(class); got != n {
+			t.Errorf("expected %d queued %s requests, got %d", n, class, got)
+		}
+	}
+
+	close(file.release)
+
+	for _, result := range results {
+		if r := <-result; r.Error != nil {
+			t.Fatalf("request failed: %v", r.Error)
+		}
+	}
+
+	for class := range want {
+		if got := worker.QueueLength(class); got != 0 {
+			t.Errorf("expected no queued %s requests once served, got %d", class, got)
+		}
+	}
+
+	if r := <-worker.Submit(faces.DiskRequest{Type: base.ReadOp, Priority: base.PriorityClasses}); r.Error == nil {
+		t.Errorf("expected an unknown priority to be refused")
+	}
+}
+
+// TestCancel verifies a request given up before a worker takes it fails at
+// once with the error of its context and leaves its page alone
+func TestCancel(t *testing.T) {
+	tests := []struct {
+		name   string
+		depth  int
+		submit func(w *DiskWorker, page faces.PageHandle) (chan faces.DiskResult, context.CancelFunc)
+		want   error
+	}{
+		{
+			name:  "Cancelled before queueing",
+			depth: 10,
+			submit: func(w *DiskWorker, page faces.PageHandle) (chan faces.DiskResult, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				return w.ReadContext(ctx, 1, page), cancel
+			},
+			want: context.Canceled,
+		},
+		{
+			name:  "Cancelled while queued",
+			depth: 10,
+			submit: func(w *DiskWorker, page faces.PageHandle) (chan faces.DiskResult, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				result := w.ReadContext(ctx, 1, page)
+
+				if w.QueueLength(base.ForegroundRead) != 1 {
+					t.Errorf("expected the read to be queued")
+				}
+
+				cancel()
+
+				return result, cancel
+			},
+			want: context.Canceled,
+		},
+		{
+			name:  "Queue full past the deadline",
+			depth: 1,
+			submit: func(w *DiskWorker, page faces.PageHandle) (chan faces.DiskResult, context.CancelFunc) {
+				// fills the only slot of the queue
+				w.Write(2, filled(t, 2))
+
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+
+				return w.WriteContext(ctx, 1, page), cancel
+			},
+			want: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				file   = &blockedFile{MemFile: &files.MemFile{}, started: make(chan struct{}), release: make(chan struct{})}
+				block  = blocks.NewBlock(file, constants.DefaultPageSize, constants.DefaultPageSize)
+				worker = newBuilder(1).SetQueueDepth(tt.depth).Build(*block)
+				page   = filled(t, 7)
+			)
+
+			defer worker.Stop()
+
+			// the worker is stuck in a read, everything else waits in its queue
+			first := worker.Read(0, pages.Alloc(constants.DefaultPageSize))
+			<-file.started
+
+			result, cancel := tt.submit(worker, page)
+			defer cancel()
+
+			select {
+			case r := <-result:
+				if !goerrors.Is(r.Error, tt.want) {
+					t.Fatalf("expected %v, got %v", tt.want, r.Error)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("the request did not fail while the worker was busy")
+			}
+
+			if n := worker.QueueLength(base.ForegroundRead); n != 0 {
+				t.Errorf("expected the cancelled request out of the queue length, got %d", n)
+			}
+
+			close(file.release)
+			<-first
+
+			if r := <-worker.Sync(); r.Error != nil {
+				t.Fatalf("sync failed: %v", r.Error)
+			}
+
+			if data, _ := pageBytes(page); data[len(data)-1] != 7 {
+				t.Errorf("the worker touched the page of a cancelled request")
+			}
+		})
+	}
+}
+
+// TestTrySubmit verifies a request is dropped instead of waiting for room
+// in a full queue, and queued once there is room again
+func TestTrySubmit(t *testing.T) {
+	var (
+		file   = &blockedFile{MemFile: &files.MemFile{}, started: make(chan struct{}), release: make(chan struct{})}
+		block  = blocks.NewBlock(file, constants.DefaultPageSize, constants.DefaultPageSize)
+		worker = newBuilder(1).SetQueueDepth(1).Build(*block)
+		read   = faces.DiskRequest{Type: base.ReadOp, PageNumber: 1, Page: pages.Alloc(constants.DefaultPageSize), Priority: base.PrefetchRead}
+	)
+
+	defer worker.Stop()
+
+	// the worker is stuck in a read and the write fills the only slot of the queue
+	first := worker.Read(0, pages.Alloc(constants.DefaultPageSize))
+	<-file.started
+
+	written := worker.Write(2, filled(t, 2))
+
+	if _, ok := worker.TrySubmit(read); ok {
+		t.Fatalf("expected the read dropped while the queue is full")
+	}
+
+	if n := worker.QueueLength(base.PrefetchRead); n != 0 {
+		t.Errorf("expected the dropped read out of the queue length, got %d", n)
+	}
+
+	close(file.release)
+
+	for _, result := range []chan faces.DiskResult{first, written, worker.Sync()} {
+		if r := <-result; r.Error != nil {
+			t.Fatalf("request failed: %v", r.Error)
+		}
+	}
+
+	result, ok := worker.TrySubmit(read)
+	if !ok {
+		t.Fatalf("expected the read queued once there is room")
+	}
+
+	if r := <-result; r.Error != nil {
+		t.Errorf("read failed: %v", r.Error)
+	}
+}
+
+// stallFile holds every read of page stall until release receives, and
+// counts the other calls
+type stallFile struct {
+	*files.MemFile
+	stall   base.PageNumber
+	started chan struct{}
+	release chan struct{}
+	lock    sync.Mutex
+	reads   int
+	writes  int
+}
+
+func (s *stallFile) ReadAt(p []byte, off int64) (int, error) {
+	if off == int64(s.stall)*constants.DefaultPageSize {
+		s.started <- struct{}{}
+		<-s.release
+	} else {
+		s.lock.Lock()
+		s.reads++
+		s.lock.Unlock()
+	}
+
+	return s.MemFile.ReadAt(p, off)
+}
+
+func (s *stallFile) WriteAt(p []byte, off int64) (int, error) {
+	s.lock.Lock()
+	s.writes++
+	s.lock.Unlock()
+
+	return s.MemFile.WriteAt(p, off)
+}
+
+// batch queues requests for pages while the worker is stalled, so they are
+// served as one batch, and returns the calls they made to the file
+func (s *stallFile) batch(t *testing.T, w *DiskWorker, pns []base.PageNumber, submit func(pn base.PageNumber) chan faces.DiskResult) (int, int) {
+	t.Helper()
+
+	first := w.Read(s.stall, pages.Alloc(constants.DefaultPageSize))
+	<-s.started
+
+	s.lock.Lock()
+	s.reads, s.writes = 0, 0
+	s.lock.Unlock()
+
+	var results []chan faces.DiskResult
+
+	for _, pn := range pns {
+		results = append(results, submit(pn))
+	}
+
+	s.release <- struct{}{}
+	<-first
+
+	for _, result := range results {
+		r := <-result
+		if r.Error != nil {
+			t.Fatalf("page %d failed: %v", r.PageNumber, r.Error)
+		}
+
+		if data, _ := pageBytes(r.Page); data[len(data)-1] != byte(r.PageNumber) {
+			t.Errorf("page %d holds %d", r.PageNumber, data[len(data)-1])
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.reads, s.writes
+}
+
+// TestCoalesce verifies consecutive pages of a batch are read and written
+// with one call to the file
+func TestCoalesce(t *testing.T) {
+	tests := []struct {
+		name      string
+		blockSize int
+		pages     []base.PageNumber
+		want      int // calls for the reads, and for the writes
+	}{
+		{name: "Consecutive pages", blockSize: constants.DefaultPageSize, pages: []base.PageNumber{1, 2, 3, 4, 5, 6, 7, 8}, want: 1},
+		{name: "Gaps split runs", blockSize: constants.DefaultPageSize, pages: []base.PageNumber{1, 2, 3, 7, 8, 12}, want: 3},
+		{name: "Out of order", blockSize: constants.DefaultPageSize, pages: []base.PageNumber{5, 3, 4, 1, 2}, want: 1},
+		{name: "Pages smaller than blocks", blockSize: 4 * constants.DefaultPageSize, pages: []base.PageNumber{1, 2, 3, 4, 5, 6}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				file   = &stallFile{MemFile: &files.MemFile{}, stall: 100, started: make(chan struct{}), release: make(chan struct{})}
+				block  = blocks.NewBlock(file, tt.blockSize, constants.DefaultPageSize)
+				worker = newBuilder(1).Build(*block)
+			)
+
+			defer worker.Stop()
+
+			_, writes := file.batch(t, worker, tt.pages, func(pn base.PageNumber) chan faces.DiskResult {
+				return worker.Write(pn, filled(t, byte(pn)))
+			})
+
+			if writes != tt.want {
+				t.Errorf("expected %d writes, got %d", tt.want, writes)
+			}
+
+			reads, _ := file.batch(t, worker, tt.pages, func(pn base.PageNumber) chan faces.DiskResult {
+				return worker.Read(pn, pages.Alloc(constants.DefaultPageSize))
+			})
+
+			if reads != tt.want {
+				t.Errorf("expected %d reads, got %d", tt.want, reads)
+			}
+		})
+	}
+}
+
+// heldSync holds every sync until release receives and tells started
+type heldSync struct {
+	*files.MemFile
+	started chan struct{}
+	release chan error
+	syncs   atomic.Int32
+}
+
+func (h *heldSync) Sync() error {
+	h.syncs.Add(1)
+	h.started <- struct{}{}
+
+	return <-h.release
+}
+
+// TestGroupSync verifies syncs waiting for an fsync in progress share the
+// next one, and hear of it only once it is done
+func TestGroupSync(t *testing.T) {
+	const waiters = 5
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "Durable", err: nil},
+		{name: "Failed fsync", err: goerrors.New("disk gone")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				file   = &heldSync{MemFile: &files.MemFile{}, started: make(chan struct{}), release: make(chan error)}
+				worker = newWorker(file, 4, false)
+			)
+
+			defer worker.Stop()
+
+			first := worker.Sync()
+			<-file.started
+
+			var results []chan faces.DiskResult
+
+			for i := 0; i < waiters; i++ {
+				results = append(results, worker.Sync())
+			}
+
+			// every sync reached its barriers and waits behind the fsync in progress
+			for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+				worker.syncs.lock.Lock()
+				n := len(worker.syncs.waiting)
+				worker.syncs.lock.Unlock()
+
+				if n == waiters {
+					break
+				}
+
+				if time.Now().After(deadline) {
+					t.Fatalf("expected %d syncs waiting for the fsync, got %d", waiters, n)
+				}
+			}
+
+			file.release <- nil
+
+			if r := <-first; r.Error != nil {
+				t.Fatalf("first sync failed: %v", r.Error)
+			}
+
+			<-file.started
+
+			for i, result := range results {
+				select {
+				case <-result:
+					t.Fatalf("sync %d answered before its fsync was done", i)
+				default:
+				}
+			}
+
+			file.release <- tt.err
+
+			for i, result := range results {
+				if r := <-result; !goerrors.Is(r.Error, tt.err) {
+					t.Errorf("sync %d: expected %v, got %v", i, tt.err, r.Error)
+				}
+			}
+
+			if n := file.syncs.Load(); n != 2 {
+				t.Errorf("expected 2 fsyncs, got %d", n)
+			}
+		})
+	}
+}
+
+// sealedPage returns a page of pageSize bytes filled with value and sealed with CRC32C
+func sealedPage(value byte) []byte {
+	page := make([]byte, constants.DefaultPageSize)
+
+	for i := checksum.HeaderSize; i < len(page); i++ {
+		page[i] = value
+	}
+
+	checksum.Seal(page, checksum.CRC32C)
+
+	return page
+}
+
+// TestRestore verifies only the pages torn in place are put back from the
+// double-write area, and that the area is empty once a batch is durable
+func TestRestore(t *testing.T) {
+	var (
+		data  = &files.MemFile{}
+		area  = &files.MemFile{}
+		block = blocks.NewBlock(data, constants.DefaultPageSize, constants.DefaultPageSize)
+		dw    = NewDoubleWrite(area, constants.DefaultPageSize)
+	)
+
+	images := [][]byte{sealedPage(1), sealedPage(2), sealedPage(3), sealedPage(4)}
+
+	if err := dw.Write([]base.PageNumber{1, 2, 3, 4}, images); err != nil {
+		t.Fatalf("double-write failed: %v", err)
+	}
+
+	// page 1 made it, page 2 was not written yet, page 3 is torn and page 4 is missing
+	torn := sealedPage(0)
+	copy(torn, images[2][:len(torn)/2])
+
+	for pn, page := range map[int][]byte{1: images[0], 2: sealedPage(9), 3: torn} {
+		if err := block.Write(pn, page); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	restored, err := NewDoubleWrite(area, constants.DefaultPageSize).Restore(block)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+
+	if restored != 2 {
+		t.Errorf("expected 2 pages restored, got %d", restored)
+	}
+
+	tests := []struct {
+		pn   int
+		want []byte
+	}{
+		{pn: 1, want: images[0]},
+		{pn: 2, want: sealedPage(9)},
+		{pn: 3, want: images[2]},
+		{pn: 4, want: images[3]},
+	}
+
+	page := make([]byte, constants.DefaultPageSize)
+
+	for _, tt := range tests {
+		if err := block.Read(tt.pn, page); err != nil || !slices.Equal(page, tt.want) {
+			t.Errorf("page %d: expected its content to be %d, got %d, %v", tt.pn, tt.want[checksum.HeaderSize], page[checksum.HeaderSize], err)
+		}
+	}
+
+	worker := newBuilder(1).SetDoubleWrite(dw).Build(*block)
+	defer worker.Stop()
+
+	if r := <-worker.Write(5, filled(t, 5)); r.Error != nil {
+		t.Fatalf("write failed: %v", r.Error)
+	}
+
+	header := make([]byte, doubleWriteHeaderSize)
+
+	if _, err := area.ReadAt(header, 0); err != nil || len(bytes.TrimLeft(header, "\x00")) != 0 {
+		t.Errorf("expected the area to be empty after a durable batch, got %v, %v", header, err)
+	}
+}
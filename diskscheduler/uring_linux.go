@@ -0,0 +1,324 @@
+//go:build linux
+
+package diskscheduler
+
+import (
+	"io"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/dark-vinci/nildb/blocks"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+)
+
+// io_uring ABI, see include/uapi/linux/io_uring.h
+const (
+	sysIOUringSetup    = 425
+	sysIOUringEnter    = 426
+	sysIOUringRegister = 427
+
+	opReadFixed  = 4
+	opWriteFixed = 5
+	opRead       = 22
+	opWrite      = 23
+
+	enterGetEvents  = 1 << 0
+	registerBuffers = 0
+	featSingleMmap  = 1 << 0
+
+	offSQRing = 0
+	offCQRing = 0x8000000
+	offSQEs   = 0x10000000
+
+	sqeSize = 64
+	cqeSize = 16
+)
+
+type sqRingOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type cqRingOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  sqRingOffsets
+	cqOff                                                                  cqRingOffsets
+}
+
+// ringIO submits the ops of a batch through an io_uring instance. Pages
+// move straight between the file and their own memory. The arena of the
+// worker is registered with the ring so the kernel does not map the pages
+// written from it again on every transfer, other memory is not the
+// worker's to keep registered.
+type ringIO struct {
+	fd       int
+	file     uintptr // descriptor of the data file
+	pageSize int
+	entries  int // submission entries, ops in flight at most
+
+	sqRing, cqRing, sqes []byte
+	single               bool // the completion ring shares the mapping of the submission ring
+
+	sqTail  *uint32
+	sqMask  uint32
+	sqArray []uint32
+	cqHead  *uint32
+	cqTail  *uint32
+	cqMask  uint32
+	cqes    unsafe.Pointer
+
+	fixed *arena // registered as buffer zero, nil when the kernel refused it
+}
+
+// newRingIO sets up a ring for the file under block, it fails where the
+// kernel or a sandbox refuses io_uring or the file has no descriptor
+func newRingIO(block blocks.Block, pageSize int, buffers *arena) (pageIO, error) {
+	file, ok := block.IOOperator().(interface{ Fd() uintptr })
+	if !ok {
+		return nil, errors.ErrNoFileDescriptor
+	}
+
+	var params uringParams
+
+	fd, _, errno := syscall.Syscall(sysIOUringSetup, uintptr(constants.BatchSize), uintptr(unsafe.Pointer(&params)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	r := &ringIO{fd: int(fd), file: file.Fd(), pageSize: pageSize, entries: int(params.sqEntries)}
+
+	if err := r.mapRings(&params); err != nil {
+		_ = r.close()
+		return nil, err
+	}
+
+	r.register(buffers)
+
+	return r, nil
+}
+
+func (r *ringIO) mapRings(params *uringParams) error {
+	var (
+		sqSize = int(params.sqOff.array + params.sqEntries*4)
+		cqSize = int(params.cqOff.cqes + params.cqEntries*cqeSize)
+		err    error
+	)
+
+	r.single = params.features&featSingleMmap != 0
+
+	if r.single {
+		sqSize = max(sqSize, cqSize)
+	}
+
+	prot, flags := syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_POPULATE
+
+	if r.sqRing, err = syscall.Mmap(r.fd, offSQRing, sqSize, prot, flags); err != nil {
+		return err
+	}
+
+	if r.single {
+		r.cqRing = r.sqRing
+	} else if r.cqRing, err = syscall.Mmap(r.fd, offCQRing, cqSize, prot, flags); err != nil {
+		return err
+	}
+
+	if r.sqes, err = syscall.Mmap(r.fd, offSQEs, int(params.sqEntries)*sqeSize, prot, flags); err != nil {
+		return err
+	}
+
+	sq, cq := params.sqOff, params.cqOff
+
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[sq.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqRing[sq.ringMask]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqRing[sq.array])), params.sqEntries)
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[cq.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[cq.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqRing[cq.ringMask]))
+	r.cqes = unsafe.Pointer(&r.cqRing[cq.cqes])
+
+	return nil
+}
+
+// register makes the memory of buffers the fixed buffer zero of the ring.
+// Kernels refusing it leave the memory unregistered, the ops still use it
+// in place.
+func (r *ringIO) register(buffers *arena) {
+	iovecs := []syscall.Iovec{{Base: &buffers.memory[0]}}
+	iovecs[0].SetLen(len(buffers.memory))
+
+	_, _, errno := syscall.Syscall6(sysIOUringRegister, uintptr(r.fd), registerBuffers,
+		uintptr(unsafe.Pointer(&iovecs[0])), uintptr(len(iovecs)), 0, 0)
+	if errno != 0 {
+		return
+	}
+
+	r.fixed = buffers
+}
+
+func (r *ringIO) transfer(ops []pageOp) []error {
+	errs := make([]error, len(ops))
+
+	for start := 0; start < len(ops); start += r.entries {
+		end := min(start+r.entries, len(ops))
+		r.submit(ops[start:end], errs[start:end])
+	}
+
+	return errs
+}
+
+// submit runs at most one op per submission entry and waits for all of
+// them, the rest of a short read or write is submitted again
+func (r *ringIO) submit(ops []pageOp, errs []error) {
+	var (
+		moved = make([]int, len(ops)) // bytes moved so far by each op
+		tail  = atomic.LoadUint32(r.sqTail)
+	)
+
+	for i, op := range ops {
+		r.prepare(tail, i, op, 0)
+		tail++
+	}
+
+	// the kernel sees the entries once the tail moves
+	atomic.StoreUint32(r.sqTail, tail)
+
+	var (
+		toSubmit = len(ops)
+		waiting  = len(ops)
+	)
+
+	for waiting > 0 {
+		submitted, _, errno := syscall.Syscall6(sysIOUringEnter, uintptr(r.fd), uintptr(toSubmit),
+			uintptr(1), enterGetEvents, 0, 0)
+
+		if errno == syscall.EINTR || errno == syscall.EAGAIN || errno == syscall.EBUSY {
+			continue
+		}
+
+		if errno != 0 {
+			// nothing more completes, the ops left fail together
+			for i := range errs {
+				if errs[i] == nil {
+					errs[i] = errno
+				}
+			}
+
+			return
+		}
+
+		toSubmit -= int(submitted)
+
+		done, again := r.reap(ops, moved, errs)
+		waiting -= done
+
+		for _, i := range again {
+			r.prepare(tail, i, ops[i], moved[i])
+			tail++
+		}
+
+		atomic.StoreUint32(r.sqTail, tail)
+		toSubmit += len(again)
+	}
+}
+
+// prepare fills the submission entry at tail with op i, from offset on.
+// Memory of the arena goes through the fixed variant of the op.
+func (r *ringIO) prepare(tail uint32, i int, op pageOp, offset int) {
+	var (
+		index  = tail & r.sqMask
+		sqe    = r.sqes[int(index)*sqeSize : int(index+1)*sqeSize]
+		data   = op.data[offset:]
+		fixed  = r.fixed != nil && r.fixed.holds(op.data)
+		opcode = byte(opRead)
+	)
+
+	switch {
+	case op.write && fixed:
+		opcode = opWriteFixed
+	case op.write:
+		opcode = opWrite
+	case fixed:
+		opcode = opReadFixed
+	}
+
+	// the cleared buffer index is zero, the one of the arena
+	clear(sqe)
+	sqe[0] = opcode
+	*(*int32)(unsafe.Pointer(&sqe[4])) = int32(r.file)
+	*(*uint64)(unsafe.Pointer(&sqe[8])) = uint64(op.page)*uint64(r.pageSize) + uint64(offset)
+	*(*uint64)(unsafe.Pointer(&sqe[16])) = uint64(uintptr(unsafe.Pointer(&data[0])))
+	*(*uint32)(unsafe.Pointer(&sqe[24])) = uint32(len(data))
+	*(*uint64)(unsafe.Pointer(&sqe[32])) = uint64(i)
+
+	r.sqArray[index] = index
+}
+
+// reap collects the completed ops, it returns how many are done and the
+// ones left short, to be submitted again
+func (r *ringIO) reap(ops []pageOp, moved []int, errs []error) (int, []int) {
+	var (
+		head  = atomic.LoadUint32(r.cqHead)
+		tail  = atomic.LoadUint32(r.cqTail)
+		done  int
+		again []int
+	)
+
+	for ; head != tail; head++ {
+		var (
+			cqe = unsafe.Add(r.cqes, int(head&r.cqMask)*cqeSize)
+			i   = int(*(*uint64)(cqe))
+			res = int(*(*int32)(unsafe.Add(cqe, 8)))
+			op  = ops[i]
+		)
+
+		switch {
+		case res < 0:
+			errs[i] = syscall.Errno(-res)
+		case res == 0 && op.write:
+			errs[i] = io.ErrShortWrite
+		case res == 0 && moved[i] == 0:
+			errs[i] = io.EOF
+		case res == 0:
+			// the last page of the file may be short, the missing part reads as zeros
+			clear(op.data[moved[i]:])
+		case moved[i]+res < len(op.data):
+			moved[i] += res
+			again = append(again, i)
+
+			continue
+		}
+
+		done++
+	}
+
+	atomic.StoreUint32(r.cqHead, head)
+
+	return done, again
+}
+
+func (r *ringIO) close() error {
+	if r.sqes != nil {
+		_ = syscall.Munmap(r.sqes)
+	}
+
+	if r.cqRing != nil && !r.single {
+		_ = syscall.Munmap(r.cqRing)
+	}
+
+	if r.sqRing != nil {
+		_ = syscall.Munmap(r.sqRing)
+	}
+
+	// the kernel drops the registration with the ring
+	r.fixed = nil
+
+	return syscall.Close(r.fd)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package diskscheduler
+
+import (
+	"github.com/dark-vinci/nildb/blocks"
+	"github.com/dark-vinci/nildb/errors"
+)
+
+// newRingIO always fails outside Linux, workers keep the block layer
+func newRingIO(blocks.Block, int, *arena) (pageIO, error) {
+	return nil, errors.ErrIOUringUnsupported
+}
@@ -1,90 +1,168 @@
 package diskscheduler
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dark-vinci/nildb/base"
 	"github.com/dark-vinci/nildb/blocks"
-	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/checksum"
 	"github.com/dark-vinci/nildb/interfaces"
 )
 
+// DiskWorker serves page requests with a pool of goroutines. Requests are
+// sharded by page number: a page always goes to the same goroutine and
+// keeps its FIFO order, different pages are served concurrently.
 type DiskWorker struct {
-	queue     chan faces.DiskRequest
-	blockIO   blocks.Block
-	lock      sync.RWMutex
-	stopChan  chan struct{}
-	waitGroup sync.WaitGroup
-	pageSize  uint
+	shards      []*shard
+	blockIO     blocks.Block
+	stopChan    chan struct{}
+	waitGroup   sync.WaitGroup
+	pageSize    uint
+	checksum    checksum.Algorithm
+	buffers     *arena       // sealed copies of pages being written
+	doubleWrite *DoubleWrite // nil when pages are written in place directly
+	writeLock   sync.Mutex   // one batch at a time goes through the double-write area
+	uring       bool         // the goroutines submit their batches through io_uring, all or none
+	queued      [base.PriorityClasses]atomic.Int64
+	syncs       syncGroup
 }
 
-var _ faces.DiskWorkerOps = (*DiskWorker)(nil)
+// syncGroup lets the syncs waiting together share one fsync
+type syncGroup struct {
+	lock    sync.Mutex
+	running bool                    // an fsync is in progress
+	waiting []chan faces.DiskResult // syncs for the fsync after it
+}
 
-func NewDiskWorker(block blocks.Block) *DiskWorker {
-	worker := &DiskWorker{
-		queue:     make(chan faces.DiskRequest, 100),
-		blockIO:   block,
-		stopChan:  make(chan struct{}),
-		lock:      sync.RWMutex{},
-		waitGroup: sync.WaitGroup{},
-	}
+var _ faces.DiskWorkerOps = (*DiskWorker)(nil)
 
-	worker.waitGroup.Add(1)
+// shard is one goroutine of the pool, its queue and the way it reaches the file
+type shard struct {
+	queue chan *queued
+	pages pageIO
+}
 
-	go worker.start()
+// queueFor returns the queue of the goroutine serving pageNumber
+func (w *DiskWorker) queueFor(pageNumber base.PageNumber) chan *queued {
+	return w.shards[uint64(pageNumber)%uint64(len(w.shards))].queue
+}
 
-	return worker
+// IOUring reports whether the worker submits its batches through io_uring
+func (w *DiskWorker) IOUring() bool {
+	return w.uring
 }
 
-func (w *DiskWorker) start() {
+// serve runs one goroutine of the pool. Whatever is queued is admitted
+// without waiting for more and served most urgent first, an idle worker
+// serves a request at once. A sync stops admission until everything
+// queued before it is served.
+func (w *DiskWorker) serve(s *shard) {
 	defer w.waitGroup.Done()
+	defer s.pages.close()
 
 	var (
-		batch  = make([]faces.DiskRequest, 0, constants.BatchSize)
-		ticker = time.NewTicker(constants.BatchTimeout)
+		pending []*queued
+		barrier *queued // a sync waiting for pending to be served
 	)
 
-	for {
-		select {
-		case <-w.stopChan:
-			//: Process request before shutting down
-			w.processBatch(batch)
-			return
+	admit := func(req *queued) {
+		if req.Type == base.SyncOp {
+			barrier = req
+		} else {
+			pending = append(pending, req)
+		}
+	}
 
-		case <-ticker.C:
-			if len(batch) > 0 {
-				w.processBatch(batch)
+	for {
+		if len(pending) == 0 && barrier == nil {
+			select {
+			case req := <-s.queue:
+				admit(req)
+			case <-w.stopChan:
+				// requests queued before Stop are still served
+				select {
+				case req := <-s.queue:
+					admit(req)
+				default:
+					return
+				}
+			}
+		}
 
-				//reset batch
-				batch = batch[:0]
+	drain:
+		for barrier == nil {
+			select {
+			case req := <-s.queue:
+				admit(req)
+			default:
+				break drain
 			}
+		}
 
-		case req := <-w.queue:
-			batch = append(batch, req)
-			if len(batch) >= constants.BatchSize {
-				w.processBatch(batch)
+		if len(pending) == 0 {
+			barrier.ResultChan <- faces.DiskResult{}
+			barrier = nil
+
+			continue
+		}
 
-				// reset batch
-				batch = batch[:0]
+		var (
+			scheduled []*queued
+			batch     []faces.DiskRequest
+		)
 
-				//reset ticker
-				ticker.Reset(constants.BatchTimeout)
+		scheduled, pending = schedule(pending, time.Now())
+
+		// requests cancelled while queued were answered by their caller
+		for _, req := range scheduled {
+			if req.take() {
+				w.queued[req.Priority].Add(-1)
+				batch = append(batch, req.DiskRequest)
 			}
 		}
+
+		w.processBatch(s.pages, batch)
 	}
 }
 
-func (w *DiskWorker) processBatch(batch []faces.DiskRequest) {
-	// Separate reads and writes
+// processBatch serves a batch in its order. Requests are gathered in
+// groups where no page appears twice, so a group can be transferred at
+// once in any order.
+func (w *DiskWorker) processBatch(pages pageIO, batch []faces.DiskRequest) {
 	var (
 		reads  []faces.DiskRequest
 		writes []faces.DiskRequest
+		seen   = make(map[base.PageNumber]struct{})
 	)
 
+	flush := func() {
+		if len(reads)+len(writes) == 0 {
+			return
+		}
+
+		sort.Slice(writes, func(i, j int) bool {
+			return writes[i].PageNumber < writes[j].PageNumber
+		})
+
+		w.processGroup(pages, reads, writes)
+
+		reads, writes = reads[:0], writes[:0]
+		clear(seen)
+	}
+
 	for _, req := range batch {
+		if _, ok := seen[req.PageNumber]; ok {
+			flush()
+		}
+
+		seen[req.PageNumber] = struct{}{}
+
 		if req.Type == base.ReadOp {
 			reads = append(reads, req)
 		} else {
@@ -92,65 +170,224 @@ func (w *DiskWorker) processBatch(batch []faces.DiskRequest) {
 		}
 	}
 
-	// Process reads (no reordering needed)
-	for _, req := range reads {
-		w.processRead(req)
+	flush()
+}
+
+// pageBytes returns the memory backing a page, reads land in it directly
+func pageBytes(page faces.PageHandle) ([]byte, error) {
+	buffer, err := page.IntoBuffer()
+	if err != nil {
+		return nil, err
 	}
 
-	// Reorder writes by PageNumber
-	sort.Slice(writes, func(i, j int) bool {
-		return writes[i].PageNumber < writes[j].PageNumber
-	})
+	if raw, ok := buffer.([]byte); ok {
+		return raw, nil
+	}
 
-	for _, req := range writes {
-		w.processWrite(req)
+	if slicer, ok := buffer.(interface{ AsSlice() []byte }); ok {
+		return slicer.AsSlice(), nil
 	}
+
+	return nil, fmt.Errorf("unsupported page buffer %T", buffer)
 }
 
-func (w *DiskWorker) processRead(req faces.DiskRequest) {
-	data := make([]byte, w.pageSize)
+// pageData returns the memory of the page of req once it has the page size
+func (w *DiskWorker) pageData(req faces.DiskRequest) ([]byte, error) {
+	data, err := pageBytes(req.Page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access page %d: %w", req.PageNumber, err)
+	}
 
-	w.lock.RLock()
-	err := w.blockIO.Read(int(req.PageNumber), data)
-	w.lock.RUnlock()
+	if uint(len(data)) != w.pageSize {
+		return nil, fmt.Errorf("page %d holds %d bytes, expected %d", req.PageNumber, len(data), w.pageSize)
+	}
 
-	result := faces.DiskResult{PageNumber: req.PageNumber, Page: req.Page}
+	return data, nil
+}
 
+// seal copies the page of a write request and stores its checksum in the
+// copy, the cached page stays as the pager left it
+func (w *DiskWorker) seal(req faces.DiskRequest) (*[]byte, error) {
+	data, err := w.pageData(req)
 	if err != nil {
-		result.Error = fmt.Errorf("page %d not found on disk", req.PageNumber)
+		return nil, err
 	}
-	//} else {
-	//	if err := req.Page.FromBytes(data); err != nil {
-	//		result.Error = fmt.Errorf("failed to deserialize page %d: %v", req.PageNumber, err)
-	//	}
-	//}
 
-	req.ResultChan <- result
+	sealed := w.buffers.get()
+
+	copy(*sealed, data)
+	checksum.Seal(*sealed, w.checksum)
+
+	return sealed, nil
 }
 
-func (w *DiskWorker) processWrite(req faces.DiskRequest) {
-	data, err := req.Page.IntoBuffer()
+// processGroup transfers a group of reads and writes of distinct pages at
+// once. With a double-write area the written pages are made durable there
+// first, the data file is synced and the area emptied before it is reused.
+func (w *DiskWorker) processGroup(pages pageIO, reads, writes []faces.DiskRequest) {
+	if w.doubleWrite != nil && len(writes) > 0 {
+		w.writeLock.Lock()
+		defer w.writeLock.Unlock()
+	}
 
-	if err != nil {
-		req.ResultChan <- faces.DiskResult{
-			PageNumber: req.PageNumber,
-			Error:      fmt.Errorf("failed to serialize page %d: %v", req.PageNumber, err),
+	var (
+		served  []faces.DiskRequest
+		ops     []pageOp
+		buffers []*[]byte
+	)
+
+	defer func() {
+		for _, buf := range buffers {
+			w.buffers.put(buf)
+		}
+	}()
+
+	for _, req := range reads {
+		data, err := w.pageData(req)
+		if err != nil {
+			req.ResultChan <- faces.DiskResult{PageNumber: req.PageNumber, Page: req.Page, Error: err}
+			continue
+		}
+
+		served = append(served, req)
+		ops = append(ops, pageOp{page: req.PageNumber, data: data})
+	}
+
+	var (
+		readCount = len(ops)
+		pending   []faces.DiskRequest
+		numbers   []base.PageNumber
+		images    [][]byte
+	)
+
+	for _, req := range writes {
+		sealed, err := w.seal(req)
+		if err != nil {
+			req.ResultChan <- faces.DiskResult{PageNumber: req.PageNumber, Page: req.Page, Error: err}
+			continue
+		}
+
+		pending = append(pending, req)
+		numbers = append(numbers, req.PageNumber)
+		images = append(images, *sealed)
+		buffers = append(buffers, sealed)
+	}
+
+	if w.doubleWrite != nil && len(pending) > 0 {
+		if err := w.doubleWrite.Write(numbers, images); err != nil {
+			errs := make([]error, len(pending))
+
+			for i := range errs {
+				errs[i] = fmt.Errorf("failed to write page %d to the double-write area: %w", numbers[i], err)
+			}
+
+			w.reply(pending, errs)
+
+			pending = nil
+		}
+	}
+
+	for i, req := range pending {
+		served = append(served, req)
+		ops = append(ops, pageOp{write: true, page: req.PageNumber, data: images[i]})
+	}
+
+	errs := pages.transfer(ops)
+
+	for i, op := range ops[:readCount] {
+		// a page past the end of the file was never written, it reads as zeros
+		if errors.Is(errs[i], io.EOF) {
+			clear(op.data)
+			errs[i] = nil
+		}
+
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("failed to read page %d: %w", op.page, errs[i])
+		} else {
+			errs[i] = checksum.Verify(op.data, w.checksum, uint64(op.page))
+		}
+	}
+
+	writeErrs := errs[readCount:]
+
+	for i, op := range ops[readCount:] {
+		if writeErrs[i] != nil {
+			writeErrs[i] = fmt.Errorf("failed to write page %d: %w", op.page, writeErrs[i])
 		}
+	}
+
+	if w.doubleWrite != nil && len(pending) > 0 {
+		var (
+			err  = w.blockIO.Sync()
+			held bool
+		)
+
+		for i, op := range ops[readCount:] {
+			if writeErrs[i] == nil && err != nil {
+				writeErrs[i] = fmt.Errorf("failed to sync page %d: %w", op.page, err)
+			}
+
+			if writeErrs[i] != nil {
+				w.doubleWrite.Hold(writeErrs[i])
+				held = true
+			}
+		}
+
+		// a batch left behind is intact in place, Restore would skip its pages
+		if !held {
+			_ = w.doubleWrite.reset()
+		}
+	}
+
+	w.reply(served, errs)
+}
 
+func (w *DiskWorker) reply(requests []faces.DiskRequest, errs []error) {
+	for i, req := range requests {
+		req.ResultChan <- faces.DiskResult{PageNumber: req.PageNumber, Page: req.Page, Error: errs[i]}
+	}
+}
+
+// groupSync answers resultChan once every write done so far is durable.
+// The first caller runs fsyncs until nobody waits anymore, each one for
+// all the callers that came while the one before it ran.
+func (w *DiskWorker) groupSync(resultChan chan faces.DiskResult) {
+	g := &w.syncs
+
+	g.lock.Lock()
+	g.waiting = append(g.waiting, resultChan)
+
+	if g.running {
+		g.lock.Unlock()
 		return
 	}
 
-	pData := data.([]byte)
+	g.running = true
 
-	w.lock.Lock()
-	err = w.blockIO.Write(int(req.PageNumber), pData)
-	w.lock.Unlock()
+	for len(g.waiting) > 0 {
+		group := g.waiting
+		g.waiting = nil
 
-	result := faces.DiskResult{PageNumber: req.PageNumber, Page: req.Page}
+		g.lock.Unlock()
 
-	if err != nil {
-		result.Error = fmt.Errorf("page %d not found on disk", req.PageNumber)
+		result := w.sync()
+
+		for _, waiter := range group {
+			waiter <- result
+		}
+
+		g.lock.Lock()
+	}
+
+	g.running = false
+	g.lock.Unlock()
+}
+
+// sync makes every write done so far durable
+func (w *DiskWorker) sync() faces.DiskResult {
+	if err := w.blockIO.Sync(); err != nil {
+		return faces.DiskResult{Error: fmt.Errorf("failed to sync: %w", err)}
 	}
 
-	req.ResultChan <- faces.DiskResult{PageNumber: req.PageNumber, Page: req.Page}
+	return faces.DiskResult{}
 }
@@ -0,0 +1,9 @@
+package errors
+
+import "errors"
+
+var (
+	ErrKeyNotFound   = errors.New("key not found")
+	ErrEntryTooLarge = errors.New("entry is too large for a B+TREE node")
+	ErrNotANode      = errors.New("page is not a B+TREE node")
+)
@@ -0,0 +1,9 @@
+package errors
+
+import "errors"
+
+var (
+	ErrIOUringUnsupported = errors.New("io_uring is not available on this platform")
+	ErrNoFileDescriptor   = errors.New("file has no descriptor to submit I/O against")
+	ErrInvalidPriority    = errors.New("unknown disk request priority")
+)
@@ -0,0 +1,23 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotADatabase    = errors.New("file is not a nildb database")
+	ErrCorruptedHeader = errors.New("database header checksum does not match")
+)
+
+// HeaderMismatchError is returned when a database was created with
+// parameters that differ from the ones it is opened with
+type HeaderMismatchError struct {
+	Field    string
+	Expected uint64
+	Found    uint64
+}
+
+func (e *HeaderMismatchError) Error() string {
+	return fmt.Sprintf("database header %s mismatch: expected %d, found %d", e.Field, e.Expected, e.Found)
+}
@@ -0,0 +1,8 @@
+package errors
+
+import "errors"
+
+var (
+	ErrNotOverflowPage   = errors.New("page cannot be used as an overflow page")
+	ErrCorruptedOverflow = errors.New("overflow chain is corrupted")
+)
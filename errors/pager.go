@@ -0,0 +1,38 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidPageZero  = errors.New("page zero cannot be read as a database header")
+	ErrInvalidFreeList  = errors.New("free list is corrupted")
+	ErrInvalidFreePage  = errors.New("page is not in use and cannot be freed")
+	ErrInvalidPageSize  = errors.New("page size is out of range or not aligned")
+	ErrInvalidBlockSize = errors.New("block size must be a power of two")
+	ErrPageSizeMismatch = errors.New("page size differs between pager layers")
+	ErrInvalidChecksum  = errors.New("unknown page checksum algorithm")
+	ErrPinLimit         = errors.New("too many pages are pinned to pin another")
+	ErrNoFreeFrame      = errors.New("every frame is pinned, no page can be evicted")
+
+	ErrNoDoubleWriteFile  = errors.New("double-write is on but no file holds the area")
+	ErrInvalidDiskWorkers = errors.New("disk worker count and queue depth must be at least 1")
+)
+
+// ErrPageLatched is matched by every PageLatchedError
+var ErrPageLatched = errors.New("page is latched by a write guard")
+
+// PageLatchedError is returned by a flush that left dirty pages behind
+// because write guards held them
+type PageLatchedError struct {
+	Pages []uint64
+}
+
+func (e *PageLatchedError) Error() string {
+	return fmt.Sprintf("pages %v are latched by write guards and were not written back", e.Pages)
+}
+
+func (e *PageLatchedError) Is(target error) bool {
+	return target == ErrPageLatched
+}
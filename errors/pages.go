@@ -0,0 +1,31 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrPageFull     = errors.New("page does not have enough free space")
+	ErrInvalidSlot  = errors.New("slot does not exist")
+	ErrCellTooLarge = errors.New("cell cannot fit in an empty page")
+)
+
+// ErrPageCorrupted is matched by every PageCorruptedError
+var ErrPageCorrupted = errors.New("page checksum does not match")
+
+// PageCorruptedError is returned when a page read from disk does not
+// match the checksum written with it, after a torn write or bit rot
+type PageCorruptedError struct {
+	Page     uint64
+	Expected uint32
+	Found    uint32
+}
+
+func (e *PageCorruptedError) Error() string {
+	return fmt.Sprintf("page %d is corrupted: checksum %#x, computed %#x", e.Page, e.Expected, e.Found)
+}
+
+func (e *PageCorruptedError) Is(target error) bool {
+	return target == ErrPageCorrupted
+}
@@ -0,0 +1,12 @@
+package errors
+
+import "errors"
+
+var (
+	ErrNotALog         = errors.New("file is not a nildb write-ahead log")
+	ErrCorruptedRecord = errors.New("write-ahead log record is corrupted")
+	ErrLogClosed       = errors.New("write-ahead log is closed")
+	ErrNoLog           = errors.New("pager has no write-ahead log")
+	ErrTxActive        = errors.New("a transaction is already running")
+	ErrNoTx            = errors.New("no transaction is running")
+)
@@ -5,4 +5,6 @@ type BlockOperations interface {
 	Flush() error
 	Read(pageNumber int, buff []byte) error
 	Write(pageNumber int, buff []byte) error
+	ReadPages(pageNumbers []int, buffs [][]byte) []error
+	WritePages(pageNumbers []int, buffs [][]byte) []error
 }
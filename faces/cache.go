@@ -2,12 +2,22 @@ package faces
 
 import "github.com/dark-vinci/nildb/base"
 
+// Lookup is what Cache.Fetch did with a page
+type Lookup uint8
+
+const (
+	Hit      Lookup = iota // the page is cached
+	Missed                 // the page was mapped and is loading, the caller reads it in
+	Loading                // another caller is reading the page in or writing it back, Wait for it
+	Dirty                  // the frame is a dirty victim held for the caller to write back first
+	PinLimit               // the page is cached but could not be pinned
+	NoFrame                // every frame is pinned or loading, none can be evicted
+)
+
 type Cache interface {
-	Evict() (int, bool)
-	Remove(frameID int)
 	Size() int
-	SetEvictable(frameID int, evictable bool)
-	RecordAccess(frameID int)
+	Contains(pageNumber base.PageNumber) bool
+	Invalidate(pageNumber base.PageNumber)
 
 	Pin(pageNumber base.PageNumber) bool
 	Unpin(pageNumber base.PageNumber) bool
@@ -15,17 +25,37 @@ type Cache interface {
 	MarkClean(pageNumber base.PageNumber) bool
 	MarkDirty(pageNumber base.PageNumber) bool
 	Map(pageNumber base.PageNumber) base.FrameID
-	Load(pageNumber base.PageNumber, page *RepPage) *RepPage
+	MapCold(pageNumber base.PageNumber) (base.FrameID, bool)
+	Load(pageNumber base.PageNumber, page *PageHandle) *PageHandle
 	MustEvictDirtyPage() bool
-	GetPage(pageNumber base.PageNumber) *uint
 	GetFrameID(pageNumber base.PageNumber) *base.FrameID
+	// Peek is GetFrameID for bookkeeping, the access is not recorded
+	Peek(pageNumber base.PageNumber) *base.FrameID
 
 	RLock()
 	RUnlock()
 	Lock()
 	Unlock()
-	MaxSize() int
+	GetMaxSize() uint
+
+	// Full reports whether mapping pageNumber takes the frame of another page
+	Full(pageNumber base.PageNumber) bool
+	// Frames returns every frame allocated so far
+	Frames() []base.FrameID
+	FindVictim(pageNumber base.PageNumber) base.FrameID
+	Victim(pageNumber base.PageNumber) (base.FrameID, bool)
+	GetPageSize() uint
 
-	FindVictim() base.FrameID
-	PageSize() int
+	// Fetch looks a page up and maps it when it is not cached in one step
+	Fetch(pageNumber base.PageNumber, pin bool) (base.FrameID, Lookup)
+	// Loaded makes a page Fetch reported Missed or MapCold mapped usable, pinned when pin is set
+	Loaded(pageNumber base.PageNumber, pin bool) bool
+	// Wait returns once the page is not loading or being written back anymore
+	Wait(pageNumber base.PageNumber)
+	// Flushing marks a dirty page clean and holds it while it is written back
+	Flushing(pageNumber base.PageNumber, pinned bool) (base.FrameID, bool)
+	// Written ends the write back of a page held by Fetch or Flushing
+	Written(pageNumber base.PageNumber)
+	// EachFrame calls fn with every frame, the frames keep their page meanwhile
+	EachFrame(fn func(frame any))
 }
@@ -1,12 +1,19 @@
 package faces
 
-import "github.com/dark-vinci/nildb/base"
+import (
+	"context"
+	"time"
+
+	"github.com/dark-vinci/nildb/base"
+)
 
 type DiskRequest struct {
 	Type       base.DiskOperation
 	PageNumber base.PageNumber
 	Page       PageHandle
 	ResultChan chan DiskResult
+	Priority   base.Priority
+	Deadline   time.Time // zero for none, a late request goes before every class
 }
 
 type DiskResult struct {
@@ -18,5 +25,18 @@ type DiskResult struct {
 type DiskWorkerOps interface {
 	Write(pageNumber base.PageNumber, page PageHandle) chan DiskResult
 	Read(pageNumber base.PageNumber, page PageHandle) chan DiskResult
+	// Submit queues a read or write with its own priority and deadline
+	Submit(req DiskRequest) chan DiskResult
+	// ReadContext, WriteContext and SubmitContext fail with the error of ctx
+	// once it is done, unless the request is already being served
+	ReadContext(ctx context.Context, pageNumber base.PageNumber, page PageHandle) chan DiskResult
+	WriteContext(ctx context.Context, pageNumber base.PageNumber, page PageHandle) chan DiskResult
+	SubmitContext(ctx context.Context, req DiskRequest) chan DiskResult
+	// TrySubmit is Submit without waiting for room, false when the request was dropped
+	TrySubmit(req DiskRequest) (chan DiskResult, bool)
+	// Sync makes the writes queued before it durable
+	Sync() chan DiskResult
+	// QueueLength returns the number of requests of class waiting to be served
+	QueueLength(class base.Priority) int
 	Stop()
 }
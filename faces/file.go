@@ -9,6 +9,9 @@ type IOOperator interface {
 	io.Reader
 	io.Seeker
 	io.Closer
+	// ReaderAt and WriterAt do not move the cursor, they can run concurrently
+	io.ReaderAt
+	io.WriterAt
 
 	Remove() error
 	Truncate() error
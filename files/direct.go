@@ -0,0 +1,12 @@
+package files
+
+import "unsafe"
+
+// DirectAlignment is what direct I/O needs buffers, offsets and lengths
+// aligned to. It covers the logical block size of every common device.
+const DirectAlignment = 4096
+
+// isAligned reports whether p can be handed to a direct read or write as is
+func isAligned(p []byte) bool {
+	return len(p) == 0 || uintptr(unsafe.Pointer(&p[0]))%DirectAlignment == 0
+}
@@ -0,0 +1,8 @@
+//go:build linux
+
+package files
+
+import "syscall"
+
+// directFlag makes reads and writes skip the page cache
+const directFlag = syscall.O_DIRECT
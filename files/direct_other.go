@@ -0,0 +1,6 @@
+//go:build !linux
+
+package files
+
+// directFlag is 0 where O_DIRECT does not exist, files fall back to buffered I/O
+const directFlag = 0
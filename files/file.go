@@ -1,17 +1,23 @@
 package files
 
 import (
+	goerrors "errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"syscall"
 
 	"github.com/dark-vinci/nildb/errors"
 	"github.com/dark-vinci/nildb/faces"
+	"github.com/dark-vinci/nildb/utils"
 )
 
 type File struct {
-	path string
-	f    *os.File
+	path       string
+	f          *os.File
+	wantDirect bool // open with O_DIRECT
+	direct     bool // O_DIRECT is in effect, buffers must be aligned
 }
 
 var _ faces.IOOperator = (*File)(nil)
@@ -23,15 +29,33 @@ func NewFile(path string) *File {
 	}
 }
 
+// SetDirectIO makes Create and Open bypass the OS page cache with
+// O_DIRECT, so pages are not cached twice. Filesystems that refuse it get a
+// buffered file, IsDirect tells which one was opened.
+func (f *File) SetDirectIO(enabled bool) *File {
+	f.wantDirect = enabled
+	return f
+}
+
+// IsDirect reports whether the opened file uses direct I/O
+func (f *File) IsDirect() bool {
+	return f.direct
+}
+
 func (f *File) Write(p []byte) (n int, err error) {
 	if f.f == nil {
 		return 0, errors.ErrFileDoesNotExist
 	}
 
+	if f.direct && !isAligned(p) {
+		bounce := utils.AlignedBuffer(len(p), DirectAlignment)
+		copy(bounce, p)
+		p = bounce
+	}
+
 	write, err := f.f.Write(p)
 	if err != nil {
-		fmt.Println("Error: file cannot be written", err)
-		return 0, err
+		return 0, fmt.Errorf("file cannot be written: %w", err)
 	}
 
 	return write, nil
@@ -42,15 +66,85 @@ func (f *File) Read(p []byte) (n int, err error) {
 		return 0, errors.ErrFileNotOpened
 	}
 
+	if f.direct && !isAligned(p) {
+		bounce := utils.AlignedBuffer(len(p), DirectAlignment)
+		n, err := f.read(bounce)
+		copy(p, bounce[:n])
+
+		return n, err
+	}
+
+	return f.read(p)
+}
+
+func (f *File) read(p []byte) (n int, err error) {
 	val, err := f.f.Read(p)
+	if err == io.EOF {
+		return val, err
+	}
+
 	if err != nil {
-		fmt.Println("Error: file cannot be read", err)
-		return 0, err
+		return 0, fmt.Errorf("file cannot be read: %w", err)
 	}
 
 	return val, nil
 }
 
+// ReadAt reads len(p) bytes from off without moving the cursor
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if f.f == nil {
+		return 0, errors.ErrFileNotOpened
+	}
+
+	if f.direct && !isAligned(p) {
+		bounce := utils.AlignedBuffer(len(p), DirectAlignment)
+		n, err := f.readAt(bounce, off)
+		copy(p, bounce[:n])
+
+		return n, err
+	}
+
+	return f.readAt(p, off)
+}
+
+func (f *File) readAt(p []byte, off int64) (n int, err error) {
+	val, err := f.f.ReadAt(p, off)
+	if err == io.EOF {
+		return val, err
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("file cannot be read: %w", err)
+	}
+
+	return val, nil
+}
+
+// WriteAt writes p at off without moving the cursor
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	if f.f == nil {
+		return 0, errors.ErrFileDoesNotExist
+	}
+
+	if f.direct && !isAligned(p) {
+		bounce := utils.AlignedBuffer(len(p), DirectAlignment)
+		copy(bounce, p)
+		p = bounce
+	}
+
+	write, err := f.f.WriteAt(p, off)
+	if err != nil {
+		return 0, fmt.Errorf("file cannot be written: %w", err)
+	}
+
+	return write, nil
+}
+
+// Fd returns the descriptor of the opened file, for I/O submitted outside it
+func (f *File) Fd() uintptr {
+	return f.f.Fd()
+}
+
 func (f *File) Seek(offset int64, whence int) (int64, error) {
 	if f.f == nil {
 		return 0, errors.ErrFileNotOpened
@@ -58,8 +152,7 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 
 	n, err := f.f.Seek(offset, whence)
 	if err != nil {
-		fmt.Println("Error: file cannot be seeked", err)
-		return 0, err
+		return 0, fmt.Errorf("file cannot be seeked: %w", err)
 	}
 
 	return n, nil
@@ -71,21 +164,19 @@ func (f *File) Close() error {
 	}
 
 	if err := f.f.Close(); err != nil {
-		fmt.Println("Error: file cannot be closed", err)
-		return err
+		return fmt.Errorf("file cannot be closed: %w", err)
 	}
 
 	return nil
 }
 
 func (f *File) Remove() error {
-	if f.path != "" {
+	if f.path == "" {
 		return errors.ErrFilePathISNil
 	}
 
 	if err := os.Remove(f.path); err != nil {
-		fmt.Println("Error: file cannot be removed", err)
-		return err
+		return fmt.Errorf("file cannot be removed: %w", err)
 	}
 
 	return nil
@@ -97,8 +188,7 @@ func (f *File) Truncate() error {
 	}
 
 	if err := os.Truncate(f.path, 0); err != nil {
-		fmt.Println("Error: file cannot be truncated", err)
-		return err
+		return fmt.Errorf("file cannot be truncated: %w", err)
 	}
 
 	return nil
@@ -106,8 +196,7 @@ func (f *File) Truncate() error {
 
 func (f *File) Sync() error {
 	if err := f.f.Sync(); err != nil {
-		fmt.Println("Error: file cannot be synced", err)
-		return err
+		return fmt.Errorf("file cannot be synced: %w", err)
 	}
 
 	return nil
@@ -120,15 +209,13 @@ func (f *File) Create() (faces.IOOperator, error) {
 
 	if parent := filepath.Dir(f.path); parent != "" {
 		if err := os.MkdirAll(parent, 0755); err != nil {
-			fmt.Println("Error: directory cannot be created", err)
-			return nil, err
+			return nil, fmt.Errorf("directory cannot be created: %w", err)
 		}
 	}
 
-	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	file, err := f.openFile(os.O_CREATE | os.O_TRUNC | os.O_RDWR)
 	if err != nil {
-		fmt.Println("Error: file cannot be created", err)
-		return nil, err
+		return nil, fmt.Errorf("file cannot be created: %w", err)
 	}
 
 	f.f = file
@@ -145,13 +232,33 @@ func (f *File) Open() (faces.IOOperator, error) {
 		return f, nil
 	}
 
-	file, err := os.OpenFile(f.path, os.O_RDWR, 0644)
+	file, err := f.openFile(os.O_RDWR)
 	if err != nil {
-		fmt.Println("Error: file cannot be opened", err)
-		return nil, err
+		return nil, fmt.Errorf("file cannot be opened: %w", err)
 	}
 
 	f.f = file
 
 	return f, nil
 }
+
+// openFile opens the file with flag, adding O_DIRECT when it was asked for
+// and the filesystem accepts it
+func (f *File) openFile(flag int) (*os.File, error) {
+	f.direct = false
+
+	if f.wantDirect && directFlag != 0 {
+		file, err := os.OpenFile(f.path, flag|directFlag, 0644)
+		if err == nil {
+			f.direct = true
+			return file, nil
+		}
+
+		// tmpfs and some network filesystems refuse O_DIRECT with EINVAL
+		if !goerrors.Is(err, syscall.EINVAL) {
+			return nil, err
+		}
+	}
+
+	return os.OpenFile(f.path, flag, 0644)
+}
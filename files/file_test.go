@@ -1,10 +1,14 @@
 package files
 
 import (
+	"bytes"
 	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"unsafe"
+
+	"github.com/dark-vinci/nildb/utils"
 )
 
 func TestFileOperations(t *testing.T) {
@@ -234,3 +238,82 @@ func TestFileOperations(t *testing.T) {
 		})
 	}
 }
+
+// TestDirectIO verifies direct files round-trip aligned and unaligned
+// buffers, whether or not the filesystem accepted O_DIRECT
+func TestDirectIO(t *testing.T) {
+	tempDir := t.TempDir()
+
+	page := utils.AlignedBuffer(2*DirectAlignment, DirectAlignment)
+	for i := range page {
+		page[i] = byte(i * 7)
+	}
+
+	tests := []struct {
+		name   string
+		direct bool
+		buffer func() []byte // where the page is written from and read into
+	}{
+		{
+			name:   "Buffered file",
+			direct: false,
+			buffer: func() []byte { return make([]byte, len(page)) },
+		},
+		{
+			name:   "Aligned buffers",
+			direct: true,
+			buffer: func() []byte { return utils.AlignedBuffer(len(page), DirectAlignment) },
+		},
+		{
+			name:   "Unaligned buffers",
+			direct: true,
+			buffer: func() []byte { return utils.AlignedBuffer(len(page)+1, DirectAlignment)[1:] },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFile(filepath.Join(tempDir, tt.name)).SetDirectIO(tt.direct)
+
+			if _, err := f.Create(); err != nil {
+				t.Fatalf("failed to create file: %v", err)
+			}
+			defer f.Close()
+
+			if !tt.direct && f.IsDirect() {
+				t.Fatalf("expected a buffered file")
+			}
+
+			t.Logf("direct I/O in effect: %v", f.IsDirect())
+
+			out := tt.buffer()
+			copy(out, page)
+
+			if _, err := f.Write(out); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+
+			if err := f.Sync(); err != nil {
+				t.Fatalf("sync failed: %v", err)
+			}
+
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				t.Fatalf("seek failed: %v", err)
+			}
+
+			in := tt.buffer()
+
+			if _, err := io.ReadFull(f, in); err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+
+			if !bytes.Equal(in, page) {
+				t.Fatalf("read back a different page")
+			}
+		})
+	}
+
+	if ptr := uintptr(unsafe.Pointer(&page[0])); ptr%DirectAlignment != 0 {
+		t.Errorf("AlignedBuffer returned %#x, not aligned to %d", ptr, DirectAlignment)
+	}
+}
@@ -4,6 +4,7 @@ go 1.24.4
 
 
 require (
+	github.com/dark-vinci/nildb v0.0.0-20251018072022-ff423055cd16
 	github.com/dark-vinci/nildb/errors v0.0.0-20251018072022-ff423055cd16
 	github.com/dark-vinci/nildb/faces v0.0.0-20251018072022-ff423055cd16
 )
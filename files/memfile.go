@@ -3,12 +3,14 @@ package files
 import (
 	"bytes"
 	"io"
+	"sync"
 
 	"github.com/dark-vinci/nildb/errors"
 	"github.com/dark-vinci/nildb/faces"
 )
 
 type MemFile struct {
+	lock     sync.RWMutex // ReadAt runs concurrently with other calls
 	buf      *bytes.Buffer
 	position int
 }
@@ -17,22 +19,80 @@ type MemFile struct {
 var _ faces.IOOperator = (*MemFile)(nil)
 
 func (m *MemFile) Write(p []byte) (n int, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	n = m.writeAt(p, m.position)
+	m.position += n
+
+	return n, nil
+}
+
+// WriteAt writes p at off without moving the cursor
+func (m *MemFile) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.ErrInvalidPointerPosition
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.writeAt(p, int(off)), nil
+}
+
+func (m *MemFile) writeAt(p []byte, off int) int {
 	if m.buf == nil {
 		m.buf = new(bytes.Buffer)
 	}
 
-	return m.buf.Write(p)
+	// writing past the end fills the gap with zeros, like a sparse file
+	if end := off + len(p); end > m.buf.Len() {
+		m.buf.Write(make([]byte, end-m.buf.Len()))
+	}
+
+	return copy(m.buf.Bytes()[off:], p)
 }
 
 func (m *MemFile) Read(p []byte) (n int, err error) {
-	if m.buf == nil {
-		m.buf = new(bytes.Buffer)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.buf == nil || m.position >= m.buf.Len() {
+		return 0, io.EOF
 	}
 
-	return bytes.NewReader(m.buf.Bytes()[m.position:]).Read(p)
+	n = copy(p, m.buf.Bytes()[m.position:])
+	m.position += n
+
+	return n, nil
+}
+
+// ReadAt reads len(p) bytes from off without moving the cursor, it
+// returns io.EOF when the file ends first
+func (m *MemFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.ErrInvalidPointerPosition
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if m.buf == nil || off >= int64(m.buf.Len()) {
+		return 0, io.EOF
+	}
+
+	n = copy(p, m.buf.Bytes()[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
 }
 
 func (m *MemFile) Seek(offset int64, whence int) (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	if m.buf == nil {
 		m.buf = new(bytes.Buffer)
 	}
@@ -60,6 +120,9 @@ func (m *MemFile) Seek(offset int64, whence int) (int64, error) {
 }
 
 func (m *MemFile) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	if m.buf != nil {
 		m.buf = nil // drop reference so it's unusable
 	}
@@ -74,7 +137,10 @@ func (m *MemFile) Remove() error {
 }
 
 func (m *MemFile) Truncate() error {
-	if m.buf != nil {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.buf == nil {
 		m.buf = new(bytes.Buffer)
 	}
 
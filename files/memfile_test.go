@@ -60,6 +60,51 @@ func TestMemFileOperations(t *testing.T) {
 			},
 		},
 
+		{
+			name: "WriteAt past the end leaves the cursor alone",
+
+			setup: func() *MemFile {
+				return &MemFile{buf: bytes.NewBufferString("abc")}
+			},
+
+			action: func(t *testing.T, m *MemFile) error {
+				_, err := m.WriteAt([]byte("xyz"), 5)
+				return err
+			},
+
+			verify: func(t *testing.T, m *MemFile) {
+				if want := "abc\x00\x00xyz"; m.buf.String() != want {
+					t.Errorf("expected %q, got %q", want, m.buf.String())
+				}
+
+				if m.position != 0 {
+					t.Errorf("expected cursor at 0, got %d", m.position)
+				}
+			},
+		},
+
+		{
+			name: "ReadAt reports a short read with EOF",
+
+			setup: func() *MemFile {
+				return &MemFile{buf: bytes.NewBufferString("abcdefghij")}
+			},
+
+			action: func(t *testing.T, m *MemFile) error {
+				buf := make([]byte, 4)
+
+				if n, err := m.ReadAt(buf, 2); err != nil || string(buf[:n]) != "cdef" {
+					t.Errorf("expected \"cdef\", got %q (%v)", buf[:n], err)
+				}
+
+				if n, err := m.ReadAt(buf, 8); err != io.EOF || string(buf[:n]) != "ij" {
+					t.Errorf("expected \"ij\" and EOF, got %q (%v)", buf[:n], err)
+				}
+
+				return nil
+			},
+		},
+
 		{
 			name: "Seek and read correctly from middle",
 
@@ -133,6 +178,52 @@ func TestMemFileOperations(t *testing.T) {
 			},
 		},
 
+		{
+			name: "Write after seek overwrites in place",
+
+			setup: func() *MemFile {
+				return &MemFile{buf: bytes.NewBufferString("abcdefghij")}
+			},
+
+			action: func(t *testing.T, m *MemFile) error {
+				if _, err := m.Seek(2, io.SeekStart); err != nil {
+					return err
+				}
+
+				_, err := m.Write([]byte("XY"))
+				return err
+			},
+
+			verify: func(t *testing.T, m *MemFile) {
+				if got := m.buf.String(); got != "abXYefghij" {
+					t.Errorf("expected %q, got %q", "abXYefghij", got)
+				}
+			},
+		},
+
+		{
+			name: "Write past the end fills the gap with zeros",
+
+			setup: func() *MemFile {
+				return &MemFile{buf: bytes.NewBufferString("ab")}
+			},
+
+			action: func(t *testing.T, m *MemFile) error {
+				if _, err := m.Seek(4, io.SeekStart); err != nil {
+					return err
+				}
+
+				_, err := m.Write([]byte("c"))
+				return err
+			},
+
+			verify: func(t *testing.T, m *MemFile) {
+				if got := m.buf.String(); got != "ab\x00\x00c" {
+					t.Errorf("expected %q, got %q", "ab\x00\x00c", got)
+				}
+			},
+		},
+
 		{
 			name: "Seek with invalid whence should fail",
 
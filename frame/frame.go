@@ -1,6 +1,8 @@
 package frame
 
 import (
+	"sync"
+
 	"github.com/dark-vinci/nildb/base"
 	"github.com/dark-vinci/nildb/interfaces"
 )
@@ -11,6 +13,10 @@ type Frame struct {
 	History    []uint64
 	Last       uint64
 	Flags      uint8
+	LSN        base.LSN     // last log record that changed the page
+	RecLSN     base.LSN     // first log record that changed the page since it was last written
+	Pins       uint32       // holders of the page, it is not evicted while any is left
+	Latch      sync.RWMutex // held by the guards reading or writing the page
 }
 
 func NewFrame(pageNumber base.PageNumber, page faces.PageHandle) *Frame {
@@ -0,0 +1,176 @@
+// Package overflow stores payloads that do not fit in a single page as a
+// linked list of overflow pages.
+package overflow
+
+import (
+	"bytes"
+	goerrors "errors"
+	"io"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/frame"
+	"github.com/dark-vinci/nildb/interfaces"
+	"github.com/dark-vinci/nildb/pages"
+)
+
+// Pager is the part of pager.Pager needed to allocate, walk and free chains
+type Pager interface {
+	GetPage(pn base.PageNumber, pin bool) (*frame.Frame, error)
+	GetNewPage(pin bool) (*faces.PageHandle, base.PageNumber, error)
+	ReleasePage(pn base.PageNumber)
+	FreePage(pn base.PageNumber) error
+	MarkDirty(pn base.PageNumber)
+}
+
+// Write stores data in a new chain and returns its first page
+func Write(pager Pager, data []byte) (base.PageNumber, error) {
+	head, _, err := WriteFrom(pager, bytes.NewReader(data))
+
+	return head, err
+}
+
+// WriteFrom streams r into a new chain and returns its first page and the
+// number of bytes written. An empty payload still takes one page. On error
+// the pages written so far are freed, nothing is left to the caller.
+func WriteFrom(pager Pager, r io.Reader) (base.PageNumber, int64, error) {
+	head, written, err := writeChain(pager, r)
+	if err == nil {
+		return head, written, nil
+	}
+
+	if head != 0 {
+		if fErr := Free(pager, head); fErr != nil {
+			return 0, 0, goerrors.Join(err, fErr)
+		}
+	}
+
+	return 0, 0, err
+}
+
+// writeChain is WriteFrom without the clean up, the chain from head is
+// well formed whatever error stopped it
+func writeChain(pager Pager, r io.Reader) (base.PageNumber, int64, error) {
+	var (
+		head    base.PageNumber
+		prev    base.PageNumber
+		written int64
+	)
+
+	for {
+		handle, pn, err := pager.GetNewPage(true)
+		if err != nil {
+			return head, written, err
+		}
+
+		page, ok := pages.OverflowFrom(*handle)
+		if !ok {
+			pager.ReleasePage(pn)
+			return head, written, goerrors.Join(errors.ErrNotOverflowPage, pager.FreePage(pn))
+		}
+
+		page.Reset()
+		page.SetOffset(uint64(written))
+
+		n, err := io.ReadFull(r, page.Content())
+		page.SetLength(n)
+		pager.MarkDirty(pn)
+
+		// the previous chunk filled its page exactly, drop the empty tail
+		if n == 0 && head != 0 {
+			pager.ReleasePage(pn)
+
+			return head, written, pager.FreePage(pn)
+		}
+
+		if head == 0 {
+			head = pn
+		} else if err := link(pager, prev, pn); err != nil {
+			pager.ReleasePage(pn)
+			return head, written, goerrors.Join(err, pager.FreePage(pn))
+		}
+
+		pager.ReleasePage(pn)
+
+		written += int64(n)
+		prev = pn
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return head, written, nil
+		}
+
+		if err != nil {
+			return head, written, err
+		}
+	}
+}
+
+// link points the page prev of a chain at next
+func link(pager Pager, prev, next base.PageNumber) error {
+	page, err := fetch(pager, prev)
+	if err != nil {
+		return err
+	}
+
+	page.SetNext(next)
+	pager.MarkDirty(prev)
+	pager.ReleasePage(prev)
+
+	return nil
+}
+
+// fetch returns the pinned overflow page pn
+func fetch(pager Pager, pn base.PageNumber) (*pages.OverflowPage, error) {
+	fr, err := pager.GetPage(pn, true)
+	if err != nil {
+		return nil, err
+	}
+
+	page, ok := pages.OverflowFrom(fr.Page)
+	if !ok {
+		pager.ReleasePage(pn)
+		return nil, errors.ErrNotOverflowPage
+	}
+
+	return page, nil
+}
+
+// Read returns the whole payload stored in the chain starting at head
+func Read(pager Pager, head base.PageNumber) ([]byte, error) {
+	return io.ReadAll(NewReader(pager, head))
+}
+
+// Free gives every page of the chain starting at head back to the pager
+func Free(pager Pager, head base.PageNumber) error {
+	var offset uint64
+
+	for pn := head; pn != 0; {
+		page, err := fetch(pager, pn)
+		if err != nil {
+			return err
+		}
+
+		if page.Offset() != offset {
+			pager.ReleasePage(pn)
+			return errors.ErrCorruptedOverflow
+		}
+
+		next := page.Next()
+		data, err := page.Data()
+
+		pager.ReleasePage(pn)
+
+		if err != nil {
+			return err
+		}
+
+		if err := pager.FreePage(pn); err != nil {
+			return err
+		}
+
+		offset += uint64(len(data))
+		pn = next
+	}
+
+	return nil
+}
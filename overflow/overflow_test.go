@@ -0,0 +1,229 @@
+package overflow
+
+import (
+	"bytes"
+	goerrors "errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/pager/pagertest"
+	"github.com/dark-vinci/nildb/pages"
+)
+
+func payload(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+
+	return data
+}
+
+func chunkSize(t *testing.T) int {
+	t.Helper()
+
+	page, _ := pages.OverflowFrom(pages.Alloc(constants.DefaultPageSize))
+
+	return page.Capacity()
+}
+
+// TestWriteAndRead verifies payloads of different sizes survive a round trip
+func TestWriteAndRead(t *testing.T) {
+	chunk := chunkSize(t)
+
+	tests := []struct {
+		name  string
+		size  int
+		pages int
+	}{
+		{name: "Empty payload", size: 0, pages: 1},
+		{name: "Single byte", size: 1, pages: 1},
+		{name: "Exactly one page", size: chunk, pages: 1},
+		{name: "One byte over a page", size: chunk + 1, pages: 2},
+		{name: "Many pages", size: chunk*5 + 100, pages: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := pagertest.NewMemPager(constants.DefaultPageSize)
+			data := payload(tt.size)
+
+			head, err := Write(p, data)
+			if err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+
+			if p.Allocated() != tt.pages {
+				t.Errorf("expected chain of %d pages, got %d", tt.pages, p.Allocated())
+			}
+
+			got, err := Read(p, head)
+			if err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+
+			if !bytes.Equal(got, data) {
+				t.Errorf("payload corrupted: wrote %d bytes, read %d", len(data), len(got))
+			}
+
+			if p.Pinned() != 0 {
+				t.Errorf("expected every page to be released, %d pins left", p.Pinned())
+			}
+		})
+	}
+}
+
+// TestReaderStreams verifies the reader can be consumed with small buffers
+func TestReaderStreams(t *testing.T) {
+	p := pagertest.NewMemPager(constants.DefaultPageSize)
+	data := payload(chunkSize(t)*3 + 17)
+
+	head, n, err := WriteFrom(p, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	if n != int64(len(data)) {
+		t.Errorf("expected %d bytes written, got %d", len(data), n)
+	}
+
+	var (
+		r   = NewReader(p, head)
+		buf = make([]byte, 100)
+		got []byte
+	)
+
+	for {
+		n, err := r.Read(buf)
+		got = append(got, buf[:n]...)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+
+		if p.Pinned() != 0 {
+			t.Fatalf("expected no page to stay pinned between reads")
+		}
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Errorf("streamed payload corrupted")
+	}
+}
+
+// failingReader returns its data, then err
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+
+	return n, nil
+}
+
+// TestWriteFailure verifies a chain cut short by an error is freed
+func TestWriteFailure(t *testing.T) {
+	var (
+		p      = pagertest.NewMemPager(constants.DefaultPageSize)
+		broken = goerrors.New("broken source")
+	)
+
+	head, _, err := WriteFrom(p, &failingReader{data: payload(chunkSize(t)*3 + 5), err: broken})
+	if !goerrors.Is(err, broken) {
+		t.Fatalf("expected %v, got %v", broken, err)
+	}
+
+	if head != 0 {
+		t.Errorf("expected no chain, got head %d", head)
+	}
+
+	if p.Allocated() != 0 {
+		t.Errorf("expected every page to be freed, %d left", p.Allocated())
+	}
+
+	if p.Pinned() != 0 {
+		t.Errorf("expected every page to be released, %d pins left", p.Pinned())
+	}
+}
+
+// TestFree verifies every page of a chain is given back
+func TestFree(t *testing.T) {
+	p := pagertest.NewMemPager(constants.DefaultPageSize)
+
+	head, err := Write(p, payload(chunkSize(t)*4))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	if err := Free(p, head); err != nil {
+		t.Fatalf("free failed: %v", err)
+	}
+
+	if p.Allocated() != 0 {
+		t.Errorf("expected every page to be freed, %d left", p.Allocated())
+	}
+}
+
+// TestCorruptedChain verifies a chain with broken offsets is detected
+func TestCorruptedChain(t *testing.T) {
+	p := pagertest.NewMemPager(constants.DefaultPageSize)
+
+	head, err := Write(p, payload(chunkSize(t)*2))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	page, err := fetch(p, head)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+
+	// make the second page point back at the first one
+	second, _ := fetch(p, page.Next())
+	second.SetNext(head)
+	p.ReleasePage(page.Next())
+	p.ReleasePage(head)
+
+	if _, err := Read(p, head); err != errors.ErrCorruptedOverflow {
+		t.Errorf("expected ErrCorruptedOverflow, got %v", err)
+	}
+}
+
+// TestCorruptedLength verifies a chunk length past the page is detected
+// instead of read
+func TestCorruptedLength(t *testing.T) {
+	p := pagertest.NewMemPager(constants.DefaultPageSize)
+
+	head, err := Write(p, payload(10))
+	if err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	page, err := fetch(p, head)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+
+	page.SetLength(page.Capacity() + 1)
+	p.ReleasePage(head)
+
+	if _, err := Read(p, head); err != errors.ErrCorruptedOverflow {
+		t.Errorf("expected ErrCorruptedOverflow from Read, got %v", err)
+	}
+
+	if err := Free(p, head); err != errors.ErrCorruptedOverflow {
+		t.Errorf("expected ErrCorruptedOverflow from Free, got %v", err)
+	}
+}
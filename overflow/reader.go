@@ -0,0 +1,71 @@
+package overflow
+
+import (
+	"io"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/errors"
+)
+
+// Reader streams a chain one page at a time, a page is only pinned while
+// its chunk is copied out.
+type Reader struct {
+	pager  Pager
+	next   base.PageNumber
+	offset uint64
+	chunk  []byte
+}
+
+var _ io.Reader = (*Reader)(nil)
+
+func NewReader(pager Pager, head base.PageNumber) *Reader {
+	return &Reader{
+		pager:  pager,
+		next:   head,
+		offset: 0,
+		chunk:  nil,
+	}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.next == 0 {
+			return 0, io.EOF
+		}
+
+		if err := r.load(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+
+	return n, nil
+}
+
+// load copies the chunk of the next page of the chain
+func (r *Reader) load() error {
+	page, err := fetch(r.pager, r.next)
+	if err != nil {
+		return err
+	}
+
+	defer r.pager.ReleasePage(r.next)
+
+	// offsets must follow each other, this also stops on looping chains
+	if page.Offset() != r.offset {
+		return errors.ErrCorruptedOverflow
+	}
+
+	data, err := page.Data()
+	if err != nil {
+		return err
+	}
+
+	r.chunk = append(r.chunk[:0], data...)
+	r.offset += uint64(len(r.chunk))
+	r.next = page.Next()
+
+	return nil
+}
@@ -1,21 +1,54 @@
 package pager
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/blocks"
+	"github.com/dark-vinci/nildb/cache"
+	"github.com/dark-vinci/nildb/checksum"
 	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/diskscheduler"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/frame"
 	"github.com/dark-vinci/nildb/interfaces"
+	"github.com/dark-vinci/nildb/wal"
 )
 
 type Builder struct {
 	BlockSize uint32
 	PageSize  uint32
-	Cache     *faces.Cache
+	Cache     faces.Cache
+	WAL       wal.Store
+	Checksum  checksum.Algorithm // used by new databases, opened ones keep theirs
+	DirectIO  bool               // Open and Create bypass the OS page cache
+
+	DoubleWrite     bool             // write pages to a scratch area before their place
+	DoubleWriteFile faces.IOOperator // the scratch area, next to the database when nil
+
+	CheckpointInterval time.Duration // 0 disables timed checkpoints
+	CheckpointLogSize  int64         // 0 disables checkpoints on log size
+
+	DiskWorkers int  // goroutines reading and writing pages, a page always uses the same one
+	QueueDepth  int  // disk requests each of them queues before callers block
+	IOUring     bool // submit page I/O through io_uring where the kernel allows it
+
+	ReadAhead uint // pages read ahead of a sequential scan, 0 disables it
 }
 
 func NewBuilder() *Builder {
 	return &Builder{
-		BlockSize: 0,
-		PageSize:  uint32(constants.DefaultPageSize),
-		Cache:     nil,
+		BlockSize:          0,
+		PageSize:           uint32(constants.DefaultPageSize),
+		Cache:              nil,
+		WAL:                nil,
+		Checksum:           checksum.CRC32C,
+		CheckpointInterval: constants.DefaultCheckpointInterval,
+		CheckpointLogSize:  constants.DefaultCheckpointLogSize,
+		DiskWorkers:        constants.DefaultDiskWorkers,
+		QueueDepth:         constants.DefaultQueueDepth,
+		ReadAhead:          constants.DefaultReadAhead,
 	}
 }
 
@@ -29,9 +62,181 @@ func (b *Builder) SetPageSize(pageSize uint32) *Builder {
 	return b
 }
 
+// SetCache makes the pager use cache, its page size must match the pager's
 func (b *Builder) SetCache(cache faces.Cache) *Builder {
-	b.Cache = &cache
+	b.Cache = cache
 	return b
 }
 
-// WE NEED TO SET CACHE PAGE SIZE TO Pager Page size
+// SetChecksum sets how the pages of a new database are checksummed
+func (b *Builder) SetChecksum(sum checksum.Algorithm) *Builder {
+	b.Checksum = sum
+	return b
+}
+
+// SetDirectIO makes Open and Create use O_DIRECT for the data file, so
+// pages are cached by the pager only. It falls back to buffered I/O where
+// the filesystem refuses it.
+func (b *Builder) SetDirectIO(enabled bool) *Builder {
+	b.DirectIO = enabled
+	return b
+}
+
+// SetDoubleWrite protects pages against torn writes, every batch is
+// written and synced to a scratch area before the pages are written in
+// place. Open and Create keep the area in path-dwb.
+func (b *Builder) SetDoubleWrite(enabled bool) *Builder {
+	b.DoubleWrite = enabled
+	return b
+}
+
+// SetDoubleWriteFile turns the double-write area on and keeps it in file
+func (b *Builder) SetDoubleWriteFile(file faces.IOOperator) *Builder {
+	b.DoubleWrite = true
+	b.DoubleWriteFile = file
+
+	return b
+}
+
+// SetWAL keeps the write-ahead log in store instead of next to the database
+func (b *Builder) SetWAL(store wal.Store) *Builder {
+	b.WAL = store
+	return b
+}
+
+// SetCheckpointInterval sets how often a checkpoint runs in the background
+func (b *Builder) SetCheckpointInterval(interval time.Duration) *Builder {
+	b.CheckpointInterval = interval
+	return b
+}
+
+// SetCheckpointLogSize sets the log size that triggers a checkpoint
+func (b *Builder) SetCheckpointLogSize(size int64) *Builder {
+	b.CheckpointLogSize = size
+	return b
+}
+
+// SetDiskWorkers sets how many goroutines serve page reads and writes
+func (b *Builder) SetDiskWorkers(workers int) *Builder {
+	b.DiskWorkers = workers
+	return b
+}
+
+// SetQueueDepth sets how many disk requests each goroutine queues
+func (b *Builder) SetQueueDepth(depth int) *Builder {
+	b.QueueDepth = depth
+	return b
+}
+
+// SetIOUring makes the disk workers submit their batches through io_uring
+// on files with a descriptor, they keep the block layer where it is refused
+func (b *Builder) SetIOUring(enabled bool) *Builder {
+	b.IOUring = enabled
+	return b
+}
+
+// SetReadAhead sets how many pages are read ahead once pages are asked
+// for one after the other, 0 turns read-ahead off
+func (b *Builder) SetReadAhead(pages uint) *Builder {
+	b.ReadAhead = pages
+	return b
+}
+
+// blockSize returns the configured block size, a page when unset
+func (b *Builder) blockSize() uint32 {
+	if b.BlockSize == 0 {
+		return b.PageSize
+	}
+
+	return b.BlockSize
+}
+
+// validate checks the page and block sizes, the checksum, the double-write
+// area, the disk workers and the cache are usable
+func (b *Builder) validate() error {
+	if b.PageSize < constants.MinPageSize || b.PageSize > constants.MaxPageSize ||
+		b.PageSize%constants.PageAlignment != 0 {
+		return fmt.Errorf("%w: %d", errors.ErrInvalidPageSize, b.PageSize)
+	}
+
+	if blockSize := b.blockSize(); blockSize&(blockSize-1) != 0 {
+		return fmt.Errorf("%w: %d", errors.ErrInvalidBlockSize, blockSize)
+	}
+
+	if !b.Checksum.Valid() {
+		return fmt.Errorf("%w: %d", errors.ErrInvalidChecksum, b.Checksum)
+	}
+
+	if b.DoubleWrite && b.DoubleWriteFile == nil {
+		return errors.ErrNoDoubleWriteFile
+	}
+
+	if b.DiskWorkers < 1 || b.QueueDepth < 1 {
+		return fmt.Errorf("%w: %d workers, queue depth %d", errors.ErrInvalidDiskWorkers, b.DiskWorkers, b.QueueDepth)
+	}
+
+	// frames are read and written whole, every layer must agree on their size
+	if b.Cache != nil {
+		return samePageSize("cache", b.Cache.GetPageSize(), b.PageSize)
+	}
+
+	return nil
+}
+
+// Build wires the block layer, the disk worker and the cache on top of an
+// opened file. The pager owns the file from then on and closes it in Close.
+func (b *Builder) Build(file faces.IOOperator) (*Pager, error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+
+	c := b.Cache
+	if c == nil {
+		c = cache.NewBuilder().SetPageSize(uint(b.PageSize)).BuildPool()
+	}
+
+	// a Cache is not safe for concurrent use, the pager shares it as a Pool
+	if single, ok := c.(*cache.Cache); ok {
+		c = cache.NewPool(single)
+	}
+
+	// OpenFile checks the page size stored in page zero against b.PageSize
+	// before building, CreateFile stores b.PageSize there
+	block := blocks.NewBlock(file, int(b.blockSize()), int(b.PageSize))
+
+	var doubleWrite *diskscheduler.DoubleWrite
+
+	if b.DoubleWrite {
+		doubleWrite = diskscheduler.NewDoubleWrite(b.DoubleWriteFile, int(b.PageSize))
+	}
+
+	worker := diskscheduler.NewBuilder().
+		SetPageSize(uint(b.PageSize)).
+		SetChecksum(b.Checksum).
+		SetDoubleWrite(doubleWrite).
+		SetWorkers(b.DiskWorkers).
+		SetQueueDepth(b.QueueDepth).
+		SetIOUring(b.IOUring).
+		Build(*block)
+
+	return &Pager{
+		worker:    worker,
+		cache:     c,
+		file:      file,
+		area:      b.DoubleWriteFile,
+		pageSize:  b.PageSize,
+		blockSize: b.blockSize(),
+		shadows:   make(map[*frame.Frame][]byte),
+		touched:   make(map[base.PageNumber]struct{}),
+		unsynced:  make(map[base.PageNumber]base.LSN),
+		readAhead: b.ReadAhead,
+	}, nil
+}
+
+func samePageSize(layer string, size uint, pageSize uint32) error {
+	if size != uint(pageSize) {
+		return fmt.Errorf("%w: %s uses %d bytes, pager uses %d", errors.ErrPageSizeMismatch, layer, size, pageSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package pager
+
+import (
+	"context"
+	goerrors "errors"
+	"time"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/frame"
+	"github.com/dark-vinci/nildb/wal"
+)
+
+// checkpointer runs checkpoints in the background, on a timer and once
+// the log grows past logSize
+type checkpointer struct {
+	logSize int64
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	err     error // first failed checkpoint, returned by Close
+}
+
+// startCheckpointer starts the background checkpoints, a zero interval and
+// log size leave them to Checkpoint calls
+func (p *Pager) startCheckpointer(interval time.Duration, logSize int64) {
+	if p.log == nil || (interval <= 0 && logSize <= 0) {
+		return
+	}
+
+	c := &checkpointer{
+		logSize: logSize,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	p.checkpointer = c
+
+	go p.runCheckpoints(c, interval)
+}
+
+func (p *Pager) runCheckpoints(c *checkpointer, interval time.Duration) {
+	defer close(c.done)
+
+	var tick <-chan time.Time
+
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-tick:
+		case <-c.wake:
+		}
+
+		if err := p.Checkpoint(); err != nil && c.err == nil {
+			c.err = err
+		}
+	}
+}
+
+// logGrew wakes the checkpointer when the log holds size bytes or more
+func (c *checkpointer) logGrew(size int64) {
+	if c == nil || c.logSize <= 0 || size < c.logSize {
+		return
+	}
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stopCheckpointer waits for a running checkpoint and stops the background ones
+func (p *Pager) stopCheckpointer() error {
+	// commits read the field under the lock, the running checkpoint takes it too
+	p.lock.Lock()
+	c := p.checkpointer
+	p.checkpointer = nil
+	p.lock.Unlock()
+
+	if c == nil {
+		return nil
+	}
+
+	close(c.stop)
+	<-c.done
+
+	return c.err
+}
+
+// Checkpoint saves the dirty page and active transaction tables in the
+// log, writes back and syncs the pages that were dirty at that point and
+// drops the log segments recovery no longer needs. Writers only wait for the page
+// being written.
+func (p *Pager) Checkpoint() error {
+	if p.log == nil {
+		return errors.ErrNoLog
+	}
+
+	p.checkpointLock.Lock()
+	defer p.checkpointLock.Unlock()
+
+	lsn, dirty, err := p.logCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	if err := p.log.Flush(lsn); err != nil {
+		return err
+	}
+
+	for pn, recLSN := range dirty {
+		if err := p.flushOld(pn, recLSN); err != nil {
+			return err
+		}
+	}
+
+	// the log is only dropped once the pages it describes are durable
+	if err := p.sync(); err != nil {
+		return err
+	}
+
+	return p.log.Truncate(p.truncationPoint(lsn))
+}
+
+// logCheckpoint appends the checkpoint record and returns it with the
+// dirty pages it lists
+func (p *Pager) logCheckpoint() (base.LSN, map[base.PageNumber]base.LSN, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// changes not logged yet have no record for the dirty page table to point at
+	if err := p.logTouched(); err != nil {
+		return 0, nil, err
+	}
+
+	cp := &wal.Checkpoint{
+		Dirty:  p.dirtyPages(),
+		Active: make(map[uint64]base.LSN),
+	}
+
+	if p.tx != 0 {
+		cp.Active[p.tx] = p.txLast
+	}
+
+	lsn, err := p.log.Append(&wal.Record{Type: wal.CheckpointRecord, Checkpoint: cp})
+
+	return lsn, cp.Dirty, err
+}
+
+// flushOld writes pn back if it is still dirty since recLSN. Pinned pages
+// are being changed and are left to the next checkpoint.
+func (p *Pager) flushOld(pn base.PageNumber, recLSN base.LSN) error {
+	frameID, ok := p.cache.Flushing(pn, false)
+	if !ok {
+		return nil
+	}
+
+	fr := p.cache.GetFrame(frameID).(*frame.Frame)
+
+	p.lock.Lock()
+	newer := fr.RecLSN == 0 || fr.RecLSN > recLSN
+	p.lock.Unlock()
+
+	if newer {
+		p.cache.MarkDirty(pn)
+		p.cache.Written(pn)
+
+		return nil
+	}
+
+	// a page being written is left to the next checkpoint like a pinned one
+	if err := p.writeHeld(context.Background(), fr, base.CheckpointWrite); !goerrors.Is(err, errors.ErrPageLatched) {
+		return err
+	}
+
+	return nil
+}
+
+// truncationPoint returns the oldest LSN recovery may still need: the
+// checkpoint, the first change of a page not durable yet and the begin
+// record of the running transaction
+func (p *Pager) truncationPoint(checkpoint base.LSN) base.LSN {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	upTo := checkpoint
+
+	for _, recLSN := range p.dirtyPages() {
+		upTo = min(upTo, recLSN)
+	}
+
+	if p.tx != 0 {
+		upTo = min(upTo, p.txFirst)
+	}
+
+	return upTo
+}
+
+// dirtyPages returns the pages with logged changes that may not be on
+// disk, with the first of them: the cached pages not written back, the
+// ones being written and the ones written since the last sync
+func (p *Pager) dirtyPages() map[base.PageNumber]base.LSN {
+	dirty := make(map[base.PageNumber]base.LSN, len(p.unsynced))
+
+	for pn, recLSN := range p.unsynced {
+		dirty[pn] = recLSN
+	}
+
+	p.cache.EachFrame(func(f any) {
+		fr := f.(*frame.Frame)
+
+		if recLSN, ok := dirty[fr.PageNumber]; fr.RecLSN != 0 && (!ok || fr.RecLSN < recLSN) {
+			dirty[fr.PageNumber] = fr.RecLSN
+		}
+	})
+
+	return dirty
+}
@@ -0,0 +1,173 @@
+package pager
+
+import (
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/frame"
+	"github.com/dark-vinci/nildb/pages"
+)
+
+// pageSource is what the free list needs to reach page zero and the trunks
+type pageSource interface {
+	GetPage(pn base.PageNumber, pin bool) (*frame.Frame, error)
+	ReleasePage(pn base.PageNumber)
+	MarkDirty(pn base.PageNumber)
+}
+
+// freeList keeps freed pages on disk. Page zero points at the first trunk
+// page, each trunk lists free leaf pages and points at the next trunk.
+// When the list is empty, pages are taken from the end of the file.
+type freeList struct {
+	source pageSource
+}
+
+func (f freeList) header() (*pages.PageZero, error) {
+	fr, err := f.source.GetPage(0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	zero, ok := pages.PageZeroFrom(fr.Page)
+	if !ok {
+		f.source.ReleasePage(0)
+		return nil, errors.ErrInvalidPageZero
+	}
+
+	return zero, nil
+}
+
+func (f freeList) trunk(pn base.PageNumber) (*pages.FreeListPage, error) {
+	fr, err := f.source.GetPage(pn, true)
+	if err != nil {
+		return nil, err
+	}
+
+	trunk, ok := pages.FreeListFrom(fr.Page)
+	if !ok {
+		f.source.ReleasePage(pn)
+		return nil, errors.ErrInvalidFreeList
+	}
+
+	return trunk, nil
+}
+
+// allocate takes a page off the free list, or grows the file by one page
+func (f freeList) allocate() (base.PageNumber, error) {
+	zero, err := f.header()
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.source.ReleasePage(0)
+	defer f.source.MarkDirty(0)
+
+	head := zero.FreeListHead()
+
+	if head == 0 {
+		pn := base.PageNumber(zero.TotalPages())
+		zero.SetTotalPages(uint64(pn) + 1)
+
+		return pn, nil
+	}
+
+	trunk, err := f.trunk(head)
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.source.ReleasePage(head)
+
+	zero.SetFreePages(zero.FreePages() - 1)
+
+	if trunk.Len() > 0 {
+		pn := trunk.Pop()
+		f.source.MarkDirty(head)
+
+		return pn, nil
+	}
+
+	// an empty trunk is handed out itself
+	zero.SetFreeListHead(trunk.Next())
+
+	return head, nil
+}
+
+// free puts pn on the free list. It goes into the first trunk when there
+// is room, otherwise it becomes the new first trunk. Page zero, pages past
+// the end of the file and pages the first trunk already holds are refused
+// with ErrInvalidFreePage, they would be handed out twice.
+func (f freeList) free(pn base.PageNumber) error {
+	if pn == 0 {
+		return errors.ErrInvalidFreePage
+	}
+
+	zero, err := f.header()
+	if err != nil {
+		return err
+	}
+
+	defer f.source.ReleasePage(0)
+
+	if uint64(pn) >= zero.TotalPages() {
+		return errors.ErrInvalidFreePage
+	}
+
+	defer f.source.MarkDirty(0)
+
+	head := zero.FreeListHead()
+
+	if head == pn {
+		return errors.ErrInvalidFreePage
+	}
+
+	if head != 0 {
+		trunk, err := f.trunk(head)
+		if err != nil {
+			return err
+		}
+
+		if trunk.Contains(pn) {
+			f.source.ReleasePage(head)
+			return errors.ErrInvalidFreePage
+		}
+
+		if trunk.Len() < trunk.Capacity() {
+			trunk.Push(pn)
+			f.source.MarkDirty(head)
+			f.source.ReleasePage(head)
+
+			zero.SetFreePages(zero.FreePages() + 1)
+
+			return nil
+		}
+
+		f.source.ReleasePage(head)
+	}
+
+	trunk, err := f.trunk(pn)
+	if err != nil {
+		return err
+	}
+
+	trunk.Reset()
+	trunk.SetNext(head)
+	f.source.MarkDirty(pn)
+	f.source.ReleasePage(pn)
+
+	zero.SetFreeListHead(pn)
+	zero.SetFreePages(zero.FreePages() + 1)
+
+	return nil
+}
+
+// stats returns the number of free pages and the number of pages in the file
+func (f freeList) stats() (uint64, uint64, error) {
+	zero, err := f.header()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer f.source.ReleasePage(0)
+
+	return zero.FreePages(), zero.TotalPages(), nil
+}
@@ -0,0 +1,154 @@
+package pager
+
+import (
+	goerrors "errors"
+	"testing"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/pager/pagertest"
+)
+
+// TestFreeListGrowsFile verifies pages come from the end of the file when nothing is free
+func TestFreeListGrowsFile(t *testing.T) {
+	f := freeList{source: pagertest.NewMemPager(constants.DefaultPageSize)}
+
+	for want := base.PageNumber(1); want <= 5; want++ {
+		pn, err := f.allocate()
+		if err != nil {
+			t.Fatalf("allocate failed: %v", err)
+		}
+
+		if pn != want {
+			t.Errorf("expected page %d, got %d", want, pn)
+		}
+	}
+
+	free, total, err := f.stats()
+	if err != nil {
+		t.Fatalf("stats failed: %v", err)
+	}
+
+	if free != 0 || total != 6 {
+		t.Errorf("expected 0 free and 6 total pages, got %d and %d", free, total)
+	}
+}
+
+// TestFreeListReuse verifies freed pages, trunks included, are handed out again
+func TestFreeListReuse(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+	}{
+		{name: "Single trunk", count: 10},
+		{name: "Several trunks", count: 2000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := pagertest.NewMemPager(constants.DefaultPageSize)
+			f := freeList{source: source}
+
+			for i := 0; i < tt.count; i++ {
+				if _, err := f.allocate(); err != nil {
+					t.Fatalf("allocate failed: %v", err)
+				}
+			}
+
+			for pn := base.PageNumber(1); pn <= base.PageNumber(tt.count); pn++ {
+				if err := f.free(pn); err != nil {
+					t.Fatalf("free failed: %v", err)
+				}
+			}
+
+			free, total, _ := f.stats()
+			if free != uint64(tt.count) || total != uint64(tt.count)+1 {
+				t.Fatalf("expected %d free and %d total pages, got %d and %d", tt.count, tt.count+1, free, total)
+			}
+
+			// a fresh free list over the same pages sees the same state
+			f = freeList{source: source}
+			seen := make(map[base.PageNumber]bool)
+
+			for i := 0; i < tt.count; i++ {
+				pn, err := f.allocate()
+				if err != nil {
+					t.Fatalf("allocate failed: %v", err)
+				}
+
+				if pn == 0 || pn > base.PageNumber(tt.count) || seen[pn] {
+					t.Fatalf("unexpected page %d handed out", pn)
+				}
+
+				seen[pn] = true
+			}
+
+			free, total, _ = f.stats()
+			if free != 0 || total != uint64(tt.count)+1 {
+				t.Errorf("expected 0 free and %d total pages, got %d and %d", tt.count+1, free, total)
+			}
+
+			if source.Pinned() != 0 {
+				t.Errorf("expected every page to be released, %d pins left", source.Pinned())
+			}
+		})
+	}
+}
+
+// TestFreeListRejectsPageZero verifies the header page can never be freed
+func TestFreeListRejectsPageZero(t *testing.T) {
+	f := freeList{source: pagertest.NewMemPager(constants.DefaultPageSize)}
+
+	if err := f.free(0); err == nil {
+		t.Errorf("expected freeing page zero to fail")
+	}
+}
+
+// TestFreeListRejectsInvalidPages verifies pages that are not in use are
+// refused and leave the free list as it was
+func TestFreeListRejectsInvalidPages(t *testing.T) {
+	tests := []struct {
+		name string
+		pn   base.PageNumber
+	}{
+		{name: "Page zero", pn: 0},
+		{name: "Past the end of the file", pn: 10},
+		{name: "Far past the end of the file", pn: 1000},
+		{name: "Already a leaf of the first trunk", pn: 3},
+		{name: "Already the first trunk", pn: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := pagertest.NewMemPager(constants.DefaultPageSize)
+			f := freeList{source: source}
+
+			for range 9 {
+				if _, err := f.allocate(); err != nil {
+					t.Fatalf("allocate failed: %v", err)
+				}
+			}
+
+			// page 2 becomes the first trunk, 3 and 4 its leaves
+			for _, pn := range []base.PageNumber{2, 3, 4} {
+				if err := f.free(pn); err != nil {
+					t.Fatalf("free of page %d failed: %v", pn, err)
+				}
+			}
+
+			if err := f.free(tt.pn); !goerrors.Is(err, errors.ErrInvalidFreePage) {
+				t.Fatalf("expected ErrInvalidFreePage, got %v", err)
+			}
+
+			free, total, _ := f.stats()
+			if free != 3 || total != 10 {
+				t.Errorf("expected 3 free and 10 total pages, got %d and %d", free, total)
+			}
+
+			if source.Pinned() != 0 {
+				t.Errorf("expected every page to be released, %d pins left", source.Pinned())
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package pager
+
+import (
+	"context"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/frame"
+	"github.com/dark-vinci/nildb/interfaces"
+)
+
+// guard holds a pin of a page and its latch until closed
+type guard struct {
+	p      *Pager
+	pn     base.PageNumber
+	fr     *frame.Frame
+	closed bool
+}
+
+// PageNumber returns the page the guard holds
+func (g *guard) PageNumber() base.PageNumber {
+	return g.pn
+}
+
+// Page returns the page the guard holds, it must not be used once the
+// guard is closed
+func (g *guard) Page() faces.PageHandle {
+	return g.fr.Page
+}
+
+// ReadGuard keeps a page cached and unchanged while it is read. Readers of
+// a page share it.
+type ReadGuard struct {
+	guard
+}
+
+// Close releases the latch and the pin, closing twice does nothing
+func (g *ReadGuard) Close() {
+	if g.closed {
+		return
+	}
+
+	g.closed = true
+	g.fr.Latch.RUnlock()
+	g.p.ReleasePage(g.pn)
+}
+
+// WriteGuard keeps a page cached while one goroutine changes it, readers
+// and other writers of the page wait for it to be closed.
+type WriteGuard struct {
+	guard
+}
+
+// Close marks the page dirty, then releases the latch and the pin. Closing
+// twice does nothing.
+func (g *WriteGuard) Close() {
+	if g.closed {
+		return
+	}
+
+	g.closed = true
+
+	// the changes are logged before another writer can make more
+	g.p.markDirty(g.pn, true)
+	g.fr.Latch.Unlock()
+	g.p.releasePage(g.pn)
+}
+
+// ReadPage pins pn and latches it for reading. The pager lock is not held
+// while the latch is waited for.
+func (p *Pager) ReadPage(ctx context.Context, pn base.PageNumber) (*ReadGuard, error) {
+	fr, err := p.pin(ctx, pn)
+	if err != nil {
+		return nil, err
+	}
+
+	fr.Latch.RLock()
+
+	return &ReadGuard{guard{p: p, pn: pn, fr: fr}}, nil
+}
+
+// WritePage pins pn and latches it for writing, see ReadPage
+func (p *Pager) WritePage(ctx context.Context, pn base.PageNumber) (*WriteGuard, error) {
+	fr, err := p.pin(ctx, pn)
+	if err != nil {
+		return nil, err
+	}
+
+	fr.Latch.Lock()
+
+	return &WriteGuard{guard{p: p, pn: pn, fr: fr}}, nil
+}
+
+// pin returns the frame of pn with one more pin, a guard cannot do without
+func (p *Pager) pin(ctx context.Context, pn base.PageNumber) (*frame.Frame, error) {
+	fr, err := p.getPage(ctx, pn, true)
+	if err != nil {
+		return nil, err
+	}
+
+	p.readAheadOf(pn)
+
+	return fr, nil
+}
@@ -0,0 +1,360 @@
+package pager
+
+import (
+	"context"
+	"encoding/binary"
+	goerrors "errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/cache"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/files"
+	"github.com/dark-vinci/nildb/frame"
+	"github.com/dark-vinci/nildb/interfaces"
+	"github.com/dark-vinci/nildb/pages"
+	"github.com/dark-vinci/nildb/wal"
+)
+
+// counterPages creates a pager over c with n pages, each holding a zero
+// counter in its first cell
+func counterPages(t *testing.T, c faces.Cache, n int) (*Pager, []base.PageNumber) {
+	t.Helper()
+
+	p, err := CreateFile(&files.MemFile{}, NewBuilder().SetCache(c))
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	t.Cleanup(func() { p.Close() })
+
+	numbers := make([]base.PageNumber, n)
+
+	for i := range numbers {
+		handle, pn, err := p.GetNewPage(false)
+		if err != nil {
+			t.Fatalf("allocate failed: %v", err)
+		}
+
+		if _, err := (*handle).(*pages.Page).Insert(make([]byte, 8)); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+
+		numbers[i] = pn
+	}
+
+	return p, numbers
+}
+
+// counter and setCounter report errors without stopping, goroutines use them
+func counter(t *testing.T, page faces.PageHandle) uint64 {
+	t.Helper()
+
+	cell, err := page.(*pages.Page).Get(0)
+	if err != nil {
+		t.Errorf("page lost its counter: %v", err)
+		return 0
+	}
+
+	return binary.LittleEndian.Uint64(cell)
+}
+
+func setCounter(t *testing.T, page faces.PageHandle, n uint64) {
+	t.Helper()
+
+	if err := page.(*pages.Page).Update(0, binary.LittleEndian.AppendUint64(nil, n)); err != nil {
+		t.Errorf("update failed: %v", err)
+	}
+}
+
+// frameOf returns the frame caching pn
+func frameOf(p *Pager, pn base.PageNumber) *frame.Frame {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.cache.GetFrame(*p.cache.Peek(pn)).(*frame.Frame)
+}
+
+// TestGuards verifies guards count their pins, mark what they wrote dirty
+// and keep writers apart from the readers of a page
+func TestGuards(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, p *Pager, numbers []base.PageNumber)
+	}{
+		{
+			name: "Pins are counted",
+			run: func(t *testing.T, p *Pager, numbers []base.PageNumber) {
+				first, _ := p.ReadPage(ctx, numbers[0])
+				second, _ := p.ReadPage(ctx, numbers[0])
+
+				first.Close()
+				first.Close()
+
+				if pins := frameOf(p, numbers[0]).Pins; pins != 1 {
+					t.Fatalf("expected 1 pin left, got %d", pins)
+				}
+
+				for _, pn := range numbers[1:] {
+					if _, err := p.GetPage(pn, false); err != nil {
+						t.Fatalf("get failed: %v", err)
+					}
+				}
+
+				if !p.cache.Contains(numbers[0]) {
+					t.Errorf("a page still guarded was evicted")
+				}
+
+				second.Close()
+
+				if pins := frameOf(p, numbers[0]).Pins; pins != 0 {
+					t.Errorf("expected no pin left, got %d", pins)
+				}
+			},
+		},
+		{
+			name: "A write guard marks the page dirty",
+			run: func(t *testing.T, p *Pager, numbers []base.PageNumber) {
+				if err := p.FlushAll(); err != nil {
+					t.Fatalf("flush failed: %v", err)
+				}
+
+				w, err := p.WritePage(ctx, numbers[0])
+				if err != nil {
+					t.Fatalf("write failed: %v", err)
+				}
+
+				setCounter(t, w.Page(), 7)
+				w.Close()
+
+				if !frameOf(p, numbers[0]).IsSet(constants.DirtyFlag) {
+					t.Errorf("the page written is not dirty")
+				}
+
+				r, _ := p.ReadPage(ctx, numbers[0])
+				defer r.Close()
+
+				if got := counter(t, r.Page()); got != 7 {
+					t.Errorf("expected 7, got %d", got)
+				}
+			},
+		},
+		{
+			name: "A writer waits for the readers",
+			run: func(t *testing.T, p *Pager, numbers []base.PageNumber) {
+				r, _ := p.ReadPage(ctx, numbers[0])
+				written := make(chan *WriteGuard)
+
+				go func() {
+					w, _ := p.WritePage(ctx, numbers[0])
+					written <- w
+				}()
+
+				select {
+				case w := <-written:
+					w.Close()
+					t.Fatalf("the writer did not wait for the reader")
+				case <-time.After(50 * time.Millisecond):
+				}
+
+				r.Close()
+
+				select {
+				case w := <-written:
+					w.Close()
+				case <-time.After(time.Second):
+					t.Fatalf("the writer still waits after the reader closed")
+				}
+			},
+		},
+		{
+			name: "Flushes leave a page being written dirty and name it",
+			run: func(t *testing.T, p *Pager, numbers []base.PageNumber) {
+				w, _ := p.WritePage(ctx, numbers[0])
+				setCounter(t, w.Page(), 1)
+				p.MarkDirty(numbers[0])
+
+				var latched *errors.PageLatchedError
+
+				if err := p.FlushAll(); !goerrors.As(err, &latched) {
+					t.Fatalf("expected %v, got %v", errors.ErrPageLatched, err)
+				}
+
+				if len(latched.Pages) != 1 || latched.Pages[0] != uint64(numbers[0]) {
+					t.Errorf("expected page %d named, got %v", numbers[0], latched.Pages)
+				}
+
+				if !frameOf(p, numbers[0]).IsSet(constants.DirtyFlag) {
+					t.Errorf("a page being written was flushed")
+				}
+
+				w.Close()
+
+				if err := p.FlushAll(); err != nil {
+					t.Fatalf("flush failed: %v", err)
+				}
+
+				if frameOf(p, numbers[0]).IsSet(constants.DirtyFlag) {
+					t.Errorf("the page stayed dirty once written")
+				}
+			},
+		},
+		{
+			name: "Guards stop at the pin limit",
+			run: func(t *testing.T, p *Pager, numbers []base.PageNumber) {
+				// half of the 10 frames may be pinned
+				for _, pn := range numbers[:5] {
+					r, err := p.ReadPage(ctx, pn)
+					if err != nil {
+						t.Fatalf("read failed: %v", err)
+					}
+
+					defer r.Close()
+				}
+
+				if _, err := p.ReadPage(ctx, numbers[5]); !goerrors.Is(err, errors.ErrPinLimit) {
+					t.Errorf("expected %v, got %v", errors.ErrPinLimit, err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, numbers := counterPages(t, cache.NewBuilder().SetMaxSize(10).Build(), 20)
+
+			tt.run(t, p, numbers)
+		})
+	}
+}
+
+// TestGuardsConcurrent increments counters from many goroutines through
+// write guards while others read them, run it with -race. No increment
+// may be lost.
+func TestGuardsConcurrent(t *testing.T) {
+	// every goroutine pins one page at a time, fewer than a shard may pin
+	const (
+		goroutines = 4
+		increments = 400
+	)
+
+	var (
+		ctx        = context.Background()
+		p, numbers = counterPages(t, cache.NewBuilder().SetMaxSize(20).SetShards(2).BuildPool(), 30)
+		wg         sync.WaitGroup
+	)
+
+	for g := range goroutines {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range increments {
+				pn := numbers[(g+i)%4]
+
+				w, err := p.WritePage(ctx, pn)
+				if err != nil {
+					t.Errorf("write failed: %v", err)
+					return
+				}
+
+				setCounter(t, w.Page(), counter(t, w.Page())+1)
+				w.Close()
+
+				// the other pages are read to push the counters out of the cache
+				r, err := p.ReadPage(ctx, numbers[4+(g*increments+i)%26])
+				if err != nil {
+					t.Errorf("read failed: %v", err)
+					return
+				}
+
+				counter(t, r.Page())
+				r.Close()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	var total uint64
+
+	for _, pn := range numbers[:4] {
+		r, err := p.ReadPage(ctx, pn)
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+
+		total += counter(t, r.Page())
+		r.Close()
+	}
+
+	if total != goroutines*increments {
+		t.Errorf("expected %d increments, got %d", goroutines*increments, total)
+	}
+}
+
+// TestLatchedPageLogging verifies a page latched for writing is not read
+// by a commit while it changes, the guard logs it once closed
+func TestLatchedPageLogging(t *testing.T) {
+	p, err := CreateFile(&files.MemFile{}, recoveryOpts(wal.NewMemStore()))
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	defer p.Close()
+
+	handle, pn, err := p.GetNewPage(false)
+	if err != nil {
+		t.Fatalf("allocate failed: %v", err)
+	}
+
+	if _, err := (*handle).(*pages.Page).Insert(make([]byte, 8)); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	p.MarkDirty(pn)
+
+	if _, err := p.Begin(); err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+
+	g, err := p.WritePage(context.Background(), pn)
+	if err != nil {
+		t.Fatalf("write latch failed: %v", err)
+	}
+
+	before := frameOf(p, pn).LSN
+
+	setCounter(t, g.Page(), 1)
+
+	// another holder of the page marks it while the guard changes it
+	p.MarkDirty(pn)
+
+	if err := p.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+
+	if lsn := frameOf(p, pn).LSN; lsn != before {
+		t.Errorf("expected the latched page to stay unlogged at %d, got %d", before, lsn)
+	}
+
+	p.lock.Lock()
+	_, touched := p.touched[pn]
+	p.lock.Unlock()
+
+	if !touched {
+		t.Errorf("expected the latched page to stay touched for the next commit")
+	}
+
+	g.Close()
+
+	if lsn := frameOf(p, pn).LSN; lsn <= before {
+		t.Errorf("expected closing the guard to log the page past %d, got %d", before, lsn)
+	}
+}
@@ -0,0 +1,96 @@
+package pager
+
+import (
+	goerrors "errors"
+	"io"
+
+	"github.com/dark-vinci/nildb/blocks"
+	"github.com/dark-vinci/nildb/checksum"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/interfaces"
+	"github.com/dark-vinci/nildb/pages"
+)
+
+// pageZero returns the pinned database header page
+func (p *Pager) pageZero() (*pages.PageZero, error) {
+	fr, err := p.GetPage(0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	zero, ok := pages.PageZeroFrom(fr.Page)
+	if !ok {
+		p.ReleasePage(0)
+		return nil, errors.ErrInvalidPageZero
+	}
+
+	return zero, nil
+}
+
+// initHeader writes the header of a new database into page zero
+func (p *Pager) initHeader(pageSize, blockSize uint32, sum checksum.Algorithm) error {
+	zero, err := p.pageZero()
+	if err != nil {
+		return err
+	}
+
+	zero.Init(pageSize, blockSize, sum)
+	p.pages.Store(zero.TotalPages())
+	p.MarkDirty(0)
+	p.ReleasePage(0)
+
+	return nil
+}
+
+// verifyHeader refuses files that are not nildb databases, are corrupted
+// or were created with another page or block size
+func (p *Pager) verifyHeader(pageSize, blockSize uint32) error {
+	zero, err := p.pageZero()
+	if err != nil {
+		return err
+	}
+
+	defer p.ReleasePage(0)
+
+	if err := zero.Validate(pageSize, blockSize); err != nil {
+		return err
+	}
+
+	p.pages.Store(zero.TotalPages())
+
+	return nil
+}
+
+// readChecksum reads page zero straight from file and returns how the
+// pages of the database are checksummed. It runs before the pager is
+// built, the worker needs the algorithm to check the pages it reads.
+func readChecksum(file faces.IOOperator, opts *Builder) (checksum.Algorithm, error) {
+	if err := opts.validate(); err != nil {
+		return 0, err
+	}
+
+	var (
+		handle = pages.Alloc(int(opts.PageSize))
+		data   = handle.(*pages.Page).Bytes()
+		block  = blocks.NewBlock(file, int(opts.blockSize()), int(opts.PageSize))
+	)
+
+	// an empty file reads as a zeroed page and is refused below
+	if err := block.Read(0, data); err != nil && !goerrors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	zero, _ := pages.PageZeroFrom(handle)
+
+	if err := zero.Validate(opts.PageSize, opts.blockSize()); err != nil {
+		return 0, err
+	}
+
+	sum := zero.PageChecksum()
+
+	if err := checksum.Verify(data, sum, 0); err != nil {
+		return 0, err
+	}
+
+	return sum, nil
+}
@@ -1,48 +1,133 @@
 package pager
 
 import (
-	"container/heap"
-	"os"
-	"strings"
+	"context"
+	goerrors "errors"
 
 	"github.com/dark-vinci/nildb/base"
 	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
 	"github.com/dark-vinci/nildb/frame"
 	"github.com/dark-vinci/nildb/interfaces"
-	"github.com/dark-vinci/nildb/pages"
 )
 
 func (p *Pager) GetNewPage(pin bool) (*faces.PageHandle, base.PageNumber, error) {
-	var (
-		pn        = p.AllocatePage()
-		page, err = p.GetPage(pn, pin)
-	)
+	pn, err := p.AllocatePage()
+	if err != nil {
+		return nil, 0, err
+	}
 
-	if err != nil || page == nil {
+	// the page is pinned until marked dirty, it cannot be evicted meanwhile
+	page, err := p.getPage(context.Background(), pn, true)
+	if err != nil {
 		return nil, 0, err
 	}
 
-	p.cache.MarkDirty(pn)
+	p.MarkDirty(pn)
+
+	if !pin {
+		p.releasePage(pn)
+	}
 
 	return &(*page).Page, pn, nil
 }
 
-func (p *Pager) AllocatePage() base.PageNumber {
-	p.lock.Lock()
-	defer p.lock.Unlock()
+// AllocatePage takes a page off the free list stored in page zero, or
+// grows the file when the list is empty
+func (p *Pager) AllocatePage() (base.PageNumber, error) {
+	p.freeLock.Lock()
+	defer p.freeLock.Unlock()
+
+	pn, err := p.freelist().allocate()
+	if err != nil {
+		return 0, err
+	}
+
+	p.counted(pn)
 
-	if p.freePages.Len() > 0 {
-		return heap.Pop(&p.freePages).(base.PageNumber)
+	return pn, nil
+}
+
+// counted grows the page count to cover pn, a page taken off the free
+// list is already counted
+func (p *Pager) counted(pn base.PageNumber) {
+	for {
+		pages := p.pages.Load()
+		if uint64(pn) < pages || p.pages.CompareAndSwap(pages, uint64(pn)+1) {
+			return
+		}
 	}
+}
 
-	pn := p.nextPageNumber
-	p.nextPageNumber++
+// FreePage returns the page to the free list so AllocatePage can reuse it
+func (p *Pager) FreePage(pn base.PageNumber) error {
+	p.freeLock.Lock()
+	defer p.freeLock.Unlock()
 
-	return pn
+	return p.freelist().free(pn)
 }
 
-// ReleasePage unpin the page
+// PageCounts returns the number of free pages and the number of pages in the file
+func (p *Pager) PageCounts() (uint64, uint64, error) {
+	p.freeLock.Lock()
+	defer p.freeLock.Unlock()
+
+	return p.freelist().stats()
+}
+
+func (p *Pager) freelist() freeList {
+	return freeList{source: locked{p}}
+}
+
+// locked gives the free list the pager methods it needs while the free
+// list lock is held
+type locked struct {
+	p *Pager
+}
+
+func (l locked) GetPage(pn base.PageNumber, pin bool) (*frame.Frame, error) {
+	return l.p.getPage(context.Background(), pn, pin)
+}
+
+func (l locked) ReleasePage(pn base.PageNumber) {
+	l.p.releasePage(pn)
+}
+
+func (l locked) MarkDirty(pn base.PageNumber) {
+	l.p.MarkDirty(pn)
+}
+
+// MarkDirty flags a cached page as modified, so it is written back before
+// eviction. With a log, the changes made so far are logged right away; an
+// append error sticks to the log and is returned by the next flush. The
+// pager lock is only taken to log them. A page latched for writing is
+// logged once its guard is closed.
+func (p *Pager) MarkDirty(pn base.PageNumber) {
+	p.markDirty(pn, false)
+}
+
+// markDirty is MarkDirty for a caller that holds the latch of the page
+// when latched is set
+func (p *Pager) markDirty(pn base.PageNumber, latched bool) {
+	p.cache.MarkDirty(pn)
+
+	if p.log == nil {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.touched[pn] = struct{}{}
+	_ = p.logPage(pn, latched)
+}
+
+// ReleasePage drops one pin of the page, it is evictable once all are dropped
 func (p *Pager) ReleasePage(pn base.PageNumber) {
+	p.releasePage(pn)
+}
+
+func (p *Pager) releasePage(pn base.PageNumber) {
 	p.cache.Unpin(pn)
 }
 
@@ -51,59 +136,258 @@ func (p *Pager) Stop() {
 	p.worker.Stop()
 }
 
-// GetPage retrieves a page from cache or disk
-func (p *Pager) GetPage(pn base.PageNumber, pin bool) (*frame.Frame, error) {
-	frameID := p.cache.GetFrameID(pn)
+// Close stops the background checkpoints, rolls back the running
+// transaction, waits for the pages read ahead, writes every dirty page
+// back and syncs it, stops the worker and closes the files
+func (p *Pager) Close() error {
+	err := p.stopCheckpointer()
 
-	// PAGE IS IN CACHE
-	if frameID != nil {
-		if pin {
-			p.cache.Pin(pn)
+	if rErr := p.Rollback(); rErr != nil && !goerrors.Is(rErr, errors.ErrNoTx) && err == nil {
+		err = rErr
+	}
+
+	p.settleAll()
+
+	if fErr := p.FlushAll(); fErr != nil && err == nil {
+		err = fErr
+	}
+
+	p.Stop()
+
+	if p.log != nil {
+		if lErr := p.log.Close(); lErr != nil && err == nil {
+			err = lErr
 		}
+	}
 
-		page := p.cache.GetFrame(*frameID).(*frame.Frame)
+	if cErr := p.file.Close(); cErr != nil && err == nil {
+		err = cErr
+	}
 
-		return page, nil
+	if p.area != nil {
+		if cErr := p.area.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
 	}
 
-	// Cache miss, need to evict if full and load
-	if p.cache.Size() >= p.cache.MaxSize() {
-		victimID := p.cache.FindVictim()
-		victimFrame := p.cache.GetFrame(victimID).(frame.Frame)
+	return err
+}
 
-		if victimFrame.IsSet(constants.DirtyFlag) {
-			resultChan := p.worker.Write(victimFrame.PageNumber, victimFrame.Page)
+// flush writes pn back with the priority of class if it is cached and
+// dirty. Pinned pages are skipped unless pinned is set.
+func (p *Pager) flush(ctx context.Context, pn base.PageNumber, class base.Priority, pinned bool) error {
+	frameID, ok := p.cache.Flushing(pn, pinned)
+	if !ok {
+		return nil
+	}
 
-			result := <-resultChan
-			if result.Error != nil {
-				return nil, result.Error
-			}
+	return p.writeHeld(ctx, p.cache.GetFrame(frameID).(*frame.Frame), class)
+}
+
+// writeHeld writes back a frame Fetch or Flushing holds with the priority
+// of class and drops the hold, callers pinning the page wait for the
+// write meanwhile. The log is flushed up to the frame's LSN
+// first, a page never reaches the disk ahead of the records describing it.
+// A page held by a WriteGuard is being changed and is put back dirty with
+// a PageLatchedError, its latch is not waited for. A failed write puts the
+// page back dirty too. The pager lock is only taken to log the page.
+func (p *Pager) writeHeld(ctx context.Context, fr *frame.Frame, class base.Priority) error {
+	pn := fr.PageNumber
+
+	defer p.cache.Written(pn)
+
+	if !fr.Latch.TryRLock() {
+		p.cache.MarkDirty(pn)
+		return &errors.PageLatchedError{Pages: []uint64{uint64(pn)}}
+	}
+
+	defer fr.Latch.RUnlock()
+
+	lsn, err := p.logHeld(fr)
 
-			p.cache.MarkClean(victimFrame.PageNumber)
+	if err == nil && lsn != 0 {
+		err = p.log.Flush(lsn)
+	}
+
+	if err == nil {
+		err = (<-p.worker.SubmitContext(ctx, faces.DiskRequest{
+			Type:       base.WriteOp,
+			PageNumber: pn,
+			Page:       fr.Page,
+			Priority:   class,
+		})).Error
+	}
+
+	if err != nil {
+		p.cache.MarkDirty(pn)
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// the write is not durable before the next sync, recovery still
+	// redoes the page from its first change until then
+	if recLSN, ok := p.unsynced[pn]; fr.RecLSN != 0 && (!ok || fr.RecLSN < recLSN) {
+		p.unsynced[pn] = fr.RecLSN
+	}
+
+	// changes logged while the page was written are redone from the old point
+	if fr.LSN == lsn {
+		fr.RecLSN = 0
+	}
+
+	return nil
+}
+
+// logHeld logs the changes of a held frame and returns its LSN, the log
+// must reach it before the page is written
+func (p *Pager) logHeld(fr *frame.Frame) (base.LSN, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if err := p.logFrame(fr); err != nil {
+		return 0, err
+	}
+
+	return fr.LSN, nil
+}
+
+// Flush writes the page back if it is dirty and makes it durable
+func (p *Pager) Flush(pn base.PageNumber) error {
+	if err := p.flush(context.Background(), pn, base.CheckpointWrite, true); err != nil {
+		return err
+	}
+
+	return p.sync()
+}
+
+// FlushAll writes every dirty page back and makes them durable. It tries
+// every page before returning the first error, pages held by write guards
+// are named together once the others are written.
+func (p *Pager) FlushAll() error {
+	var (
+		err     error
+		dirty   []base.PageNumber
+		latched []uint64
+	)
+
+	p.cache.EachFrame(func(f any) {
+		if fr := f.(*frame.Frame); fr.IsSet(constants.DirtyFlag) {
+			dirty = append(dirty, fr.PageNumber)
+		}
+	})
+
+	for _, pn := range dirty {
+		fErr := p.flush(context.Background(), pn, base.CheckpointWrite, true)
+		if goerrors.Is(fErr, errors.ErrPageLatched) {
+			latched = append(latched, uint64(pn))
+			continue
 		}
+
+		if fErr != nil && err == nil {
+			err = fErr
+		}
+	}
+
+	if sErr := p.sync(); sErr != nil && err == nil {
+		err = sErr
 	}
 
-	// EVICT IF NEEDED
-	frameID2 := p.cache.Map(pn)
+	if err == nil && latched != nil {
+		err = &errors.PageLatchedError{Pages: latched}
+	}
+
+	return err
+}
 
-	// Load from disk
-	fram := p.cache.GetFrame(frameID2).(*frame.Frame)
+// sync waits until the writes sent to the worker so far are durable. The
+// pages written before it no longer need their log records, unless it fails.
+func (p *Pager) sync() error {
+	p.lock.Lock()
+	written := p.unsynced
+	p.unsynced = make(map[base.PageNumber]base.LSN)
+	p.lock.Unlock()
 
-	resultChan := p.worker.Read(pn, (*fram).Page)
-	result := <-resultChan
+	result := <-p.worker.Sync()
 
 	if result.Error != nil {
-		if os.IsNotExist(result.Error) || strings.Contains(result.Error.Error(), "file does not exist") {
-			// Initialize an empty page
-			fram.Page = pages.Alloc(p.cache.PageSize())
-		} else {
-			return nil, result.Error
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		for pn, recLSN := range written {
+			if current, ok := p.unsynced[pn]; !ok || recLSN < current {
+				p.unsynced[pn] = recLSN
+			}
 		}
 	}
 
-	if pin {
-		p.cache.Pin(pn)
+	return result.Error
+}
+
+// GetPage retrieves a page from cache or disk
+func (p *Pager) GetPage(pn base.PageNumber, pin bool) (*frame.Frame, error) {
+	return p.GetPageContext(context.Background(), pn, pin)
+}
+
+// GetPageContext is GetPage for a caller that may give up. Once ctx is
+// done the disk requests the page waits for fail with its error, and the
+// cache is left as if the page was never asked for.
+func (p *Pager) GetPageContext(ctx context.Context, pn base.PageNumber, pin bool) (*frame.Frame, error) {
+	fr, err := p.getPage(ctx, pn, pin)
+	if err != nil {
+		return nil, err
+	}
+
+	p.readAheadOf(pn)
+
+	return fr, nil
+}
+
+// getPage returns the frame of pn and reads the page in when it is not
+// cached, without the pager lock. The cache maps a missed page and marks
+// it loading in one step, the callers asking for it meanwhile wait for
+// that read instead of issuing their own. A dirty victim is written back
+// before its frame is reused.
+func (p *Pager) getPage(ctx context.Context, pn base.PageNumber, pin bool) (*frame.Frame, error) {
+	for {
+		frameID, lookup := p.cache.Fetch(pn, pin)
+
+		switch lookup {
+		case faces.Hit:
+			return p.cache.GetFrame(frameID).(*frame.Frame), nil
+		case faces.PinLimit:
+			return nil, errors.ErrPinLimit
+		case faces.NoFrame:
+			return nil, errors.ErrNoFreeFrame
+		case faces.Loading:
+			p.cache.Wait(pn)
+		case faces.Dirty:
+			if err := p.writeHeld(ctx, p.cache.GetFrame(frameID).(*frame.Frame), base.EvictionWrite); err != nil {
+				return nil, err
+			}
+		case faces.Missed:
+			return p.load(ctx, pn, p.cache.GetFrame(frameID).(*frame.Frame), pin)
+		}
+	}
+}
+
+// load reads pn into the frame Fetch mapped for it. The page is usable
+// once read, a failed read leaves it out of the cache.
+func (p *Pager) load(ctx context.Context, pn base.PageNumber, fr *frame.Frame, pin bool) (*frame.Frame, error) {
+	// pages past the end of the file come back zeroed
+	result := <-p.worker.ReadContext(ctx, pn, fr.Page)
+	if result.Error != nil {
+		p.cache.Invalidate(pn)
+		return nil, result.Error
+	}
+
+	p.remember(fr)
+
+	// the page stays cached, it is just not handed out
+	if !p.cache.Loaded(pn, pin) {
+		return nil, errors.ErrPinLimit
 	}
 
-	return fram, nil
+	return fr, nil
 }
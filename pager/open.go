@@ -0,0 +1,233 @@
+package pager
+
+import (
+	"os"
+
+	"github.com/dark-vinci/nildb/blocks"
+	"github.com/dark-vinci/nildb/diskscheduler"
+	"github.com/dark-vinci/nildb/files"
+	"github.com/dark-vinci/nildb/interfaces"
+	"github.com/dark-vinci/nildb/wal"
+)
+
+// walPath returns where the log of the database at path lives by default
+func walPath(path string) string {
+	return path + "-wal"
+}
+
+// doubleWritePath returns where the double-write area of the database at path lives
+func doubleWritePath(path string) string {
+	return path + "-dwb"
+}
+
+// withDoubleWrite returns a copy of opts holding the double-write file next
+// to the database when opts asks for one without naming it
+func withDoubleWrite(path string, opts *Builder, create bool) (*Builder, error) {
+	if !opts.DoubleWrite || opts.DoubleWriteFile != nil {
+		return opts, nil
+	}
+
+	var (
+		area = files.NewFile(doubleWritePath(path))
+		file faces.IOOperator
+		err  error
+	)
+
+	if _, statErr := os.Stat(doubleWritePath(path)); create || os.IsNotExist(statErr) {
+		file, err = area.Create()
+	} else {
+		file, err = area.Open()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	withArea := *opts
+	withArea.DoubleWriteFile = file
+
+	return &withArea, nil
+}
+
+// withLog returns a copy of opts that keeps the log segments in their own
+// directory when opts does not name a store
+func withLog(path string, opts *Builder) *Builder {
+	if opts == nil {
+		opts = NewBuilder()
+	}
+
+	if opts.WAL != nil {
+		return opts
+	}
+
+	withWAL := *opts
+	withWAL.WAL = wal.NewDirStore(walPath(path))
+
+	return &withWAL
+}
+
+// Open opens the database at path. The file must start with a valid header
+// written with the page size of opts, a nil opts uses the defaults. The
+// log is kept in the path-wal directory unless opts names another store.
+func Open(path string, opts *Builder) (*Pager, error) {
+	opts = withLog(path, opts)
+
+	file, err := files.NewFile(path).SetDirectIO(opts.DirectIO).Open()
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err = withDoubleWrite(path, opts, false)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return OpenFile(file, opts)
+}
+
+// Create creates the database at path, truncating any existing file and
+// its log, and writes a fresh header to page zero
+func Create(path string, opts *Builder) (*Pager, error) {
+	opts = withLog(path, opts)
+
+	file, err := files.NewFile(path).SetDirectIO(opts.DirectIO).Create()
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err = withDoubleWrite(path, opts, true)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return CreateFile(file, opts)
+}
+
+// OpenFile is Open for a file that is already opened, files.MemFile included.
+// Without opts.WAL the pager runs without a log.
+func OpenFile(file faces.IOOperator, opts *Builder) (*Pager, error) {
+	if opts == nil {
+		opts = NewBuilder()
+	}
+
+	if err := restoreTornPages(file, opts); err != nil {
+		closeFiles(file, opts)
+		return nil, err
+	}
+
+	sum, err := readChecksum(file, opts)
+	if err != nil {
+		closeFiles(file, opts)
+		return nil, err
+	}
+
+	withSum := *opts
+	withSum.Checksum = sum
+	opts = &withSum
+
+	p, err := build(file, opts, wal.Open)
+	if err != nil {
+		return nil, err
+	}
+
+	// a crash may have left the file behind or ahead of the log
+	if p.log != nil {
+		if err := p.recover(); err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+	}
+
+	if err := p.verifyHeader(p.pageSize, p.blockSize); err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	p.startCheckpointer(opts.CheckpointInterval, opts.CheckpointLogSize)
+
+	return p, nil
+}
+
+// CreateFile is Create for a file that is already opened and empty
+func CreateFile(file faces.IOOperator, opts *Builder) (*Pager, error) {
+	if opts == nil {
+		opts = NewBuilder()
+	}
+
+	p, err := build(file, opts, wal.Create)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.initHeader(p.pageSize, p.blockSize, opts.Checksum); err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	// the header is written right away, a file without it cannot be opened
+	if err := p.Flush(0); err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	p.startCheckpointer(opts.CheckpointInterval, opts.CheckpointLogSize)
+
+	return p, nil
+}
+
+// build wires the pager and attaches the log opened by openLog
+func build(file faces.IOOperator, opts *Builder, openLog func(wal.Store) (*wal.Log, error)) (*Pager, error) {
+	p, err := opts.Build(file)
+	if err != nil {
+		closeFiles(file, opts)
+		return nil, err
+	}
+
+	if opts.WAL == nil {
+		return p, nil
+	}
+
+	log, err := openLog(opts.WAL)
+	if err != nil {
+		_ = p.Close()
+
+		return nil, err
+	}
+
+	p.log = log
+	p.lastTxID = log.LastTxID()
+
+	return p, nil
+}
+
+// restoreTornPages puts back the pages of the last batch kept in the
+// double-write area, before anything reads the data file
+func restoreTornPages(file faces.IOOperator, opts *Builder) error {
+	if !opts.DoubleWrite || opts.DoubleWriteFile == nil {
+		return nil
+	}
+
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	var (
+		area  = diskscheduler.NewDoubleWrite(opts.DoubleWriteFile, int(opts.PageSize))
+		block = blocks.NewBlock(file, int(opts.blockSize()), int(opts.PageSize))
+	)
+
+	_, err := area.Restore(block)
+
+	return err
+}
+
+// closeFiles closes the files handed to a pager that could not be built
+func closeFiles(file faces.IOOperator, opts *Builder) {
+	_ = file.Close()
+
+	if opts.DoubleWriteFile != nil {
+		_ = opts.DoubleWriteFile.Close()
+	}
+}
@@ -2,16 +2,40 @@ package pager
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/frame"
 	"github.com/dark-vinci/nildb/interfaces"
-	"github.com/dark-vinci/nildb/utils"
+	"github.com/dark-vinci/nildb/wal"
 )
 
 type Pager struct {
-	worker         faces.DiskWorkerOps
-	cache          faces.Cache
-	lock           sync.Mutex
-	freePages      utils.Uint64Heap
-	nextPageNumber base.PageNumber
+	worker    faces.DiskWorkerOps
+	cache     faces.Cache // shared with every goroutine, the pager lock is not needed to reach it
+	file      faces.IOOperator
+	area      faces.IOOperator // double-write area, nil without one
+	pageSize  uint32
+	blockSize uint32
+	lock      sync.Mutex // guards the log state below, never held across I/O
+	freeLock  sync.Mutex // one free list change at a time
+
+	log        *wal.Log                     // nil when the pager runs without a log
+	shadowLock sync.Mutex                   // guards shadows
+	shadows    map[*frame.Frame][]byte      // pages of the frames as last logged
+	touched    map[base.PageNumber]struct{} // pages marked dirty since last logged
+	unsynced   map[base.PageNumber]base.LSN // pages written back since the last sync, with their first change not durable yet
+	tx         uint64                       // running transaction, 0 when none
+	txLast     base.LSN                     // last record of the running transaction
+	txFirst    base.LSN                     // begin record of the running transaction
+	lastTxID   uint64
+
+	checkpointLock sync.Mutex    // one checkpoint or rollback runs at a time
+	checkpointer   *checkpointer // nil when checkpoints only run on demand
+
+	prefetches sync.WaitGroup // reads ahead not done yet
+	readAhead  uint           // pages read ahead of a sequential scan, 0 when off
+	lastRead   atomic.Uint64  // last page asked for
+	sequential atomic.Int64   // pages asked for right after the one before
+	pages      atomic.Uint64  // pages in the file as far as the pager knows, bounds the reads ahead
 }
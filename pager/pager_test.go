@@ -0,0 +1,863 @@
+package pager
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/btree"
+	"github.com/dark-vinci/nildb/cache"
+	"github.com/dark-vinci/nildb/checksum"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/files"
+	"github.com/dark-vinci/nildb/frame"
+	"github.com/dark-vinci/nildb/interfaces"
+	"github.com/dark-vinci/nildb/pages"
+	"github.com/dark-vinci/nildb/wal"
+)
+
+func testPath(t *testing.T) string {
+	t.Helper()
+
+	return filepath.Join(t.TempDir(), "test.db")
+}
+
+// TestCreateAndOpen verifies a tree written through one pager is read back by the next
+func TestCreateAndOpen(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *Builder
+	}{
+		{name: "Buffered I/O", opts: nil},
+		{name: "Direct I/O", opts: NewBuilder().SetDirectIO(true)},
+		{name: "io_uring", opts: NewBuilder().SetIOUring(true)},
+		{name: "Direct I/O through io_uring", opts: NewBuilder().SetDirectIO(true).SetIOUring(true)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := testPath(t)
+
+			p, err := Create(path, tt.opts)
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+
+			tree, err := btree.New(p)
+			if err != nil {
+				t.Fatalf("failed to create tree: %v", err)
+			}
+
+			for i := 0; i < 500; i++ {
+				if err := tree.Insert([]byte(fmt.Sprintf("key-%04d", i)), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+					t.Fatalf("insert failed: %v", err)
+				}
+			}
+
+			_, total, _ := p.PageCounts()
+
+			if err := p.Close(); err != nil {
+				t.Fatalf("close failed: %v", err)
+			}
+
+			p, err = Open(path, tt.opts)
+			if err != nil {
+				t.Fatalf("open failed: %v", err)
+			}
+
+			defer p.Close()
+
+			if _, reopened, _ := p.PageCounts(); reopened != total {
+				t.Errorf("expected %d pages after reopening, got %d", total, reopened)
+			}
+
+			tree, err = btree.Open(p, tree.Root())
+			if err != nil {
+				t.Fatalf("failed to open tree: %v", err)
+			}
+
+			for i := 0; i < 500; i++ {
+				got, err := tree.Get([]byte(fmt.Sprintf("key-%04d", i)))
+				if err != nil {
+					t.Fatalf("get failed: %v", err)
+				}
+
+				if want := fmt.Sprintf("value-%d", i); string(got) != want {
+					t.Fatalf("expected %q, got %q", want, got)
+				}
+			}
+		})
+	}
+}
+
+// TestEviction verifies dirty pages survive being evicted from a small
+// cache, whatever the replacement policy and in a sharded pool
+func TestEviction(t *testing.T) {
+	caches := map[string]faces.Cache{
+		"pool": cache.NewBuilder().SetMaxSize(20).SetShards(2).BuildPool(),
+	}
+
+	for _, r := range []cache.Replacement{cache.LRUK, cache.Clock, cache.TwoQ, cache.ARC} {
+		caches[r.String()] = cache.NewBuilder().SetMaxSize(10).SetReplacement(r).Build()
+	}
+
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			p, err := CreateFile(&files.MemFile{}, NewBuilder().SetCache(c))
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+
+			defer p.Close()
+
+			var numbers []base.PageNumber
+
+			for i := 0; i < 25; i++ {
+				handle, pn, err := p.GetNewPage(false)
+				if err != nil {
+					t.Fatalf("allocate failed: %v", err)
+				}
+
+				if _, err := (*handle).(*pages.Page).Insert([]byte(fmt.Sprintf("page-%d", pn))); err != nil {
+					t.Fatalf("insert failed: %v", err)
+				}
+
+				numbers = append(numbers, pn)
+			}
+
+			// pinned while read, the pages read ahead of the scan may take an unpinned frame
+			for _, pn := range numbers {
+				fr, err := p.GetPage(pn, true)
+				if err != nil {
+					t.Fatalf("get failed: %v", err)
+				}
+
+				cell, err := fr.Page.(*pages.Page).Get(0)
+				if err != nil {
+					t.Fatalf("page %d lost its cell: %v", pn, err)
+				}
+
+				if want := fmt.Sprintf("page-%d", pn); string(cell) != want {
+					t.Errorf("expected %q, got %q", want, cell)
+				}
+
+				p.ReleasePage(pn)
+			}
+		})
+	}
+}
+
+// TestGetPageContext verifies a cancelled read of a page leaves it out of the
+// cache, while a cached page is still served
+func TestGetPageContext(t *testing.T) {
+	c := cache.NewBuilder().SetMaxSize(10).Build()
+
+	p, err := CreateFile(&files.MemFile{}, NewBuilder().SetCache(c))
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	defer p.Close()
+
+	var numbers []base.PageNumber
+
+	for i := 0; i < 25; i++ {
+		handle, pn, err := p.GetNewPage(false)
+		if err != nil {
+			t.Fatalf("allocate failed: %v", err)
+		}
+
+		if _, err := (*handle).(*pages.Page).Insert([]byte(fmt.Sprintf("page-%d", pn))); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+
+		numbers = append(numbers, pn)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the first pages were evicted by the last ones
+	if _, err := p.GetPageContext(ctx, numbers[0], false); !goerrors.Is(err, context.Canceled) {
+		t.Fatalf("expected an evicted page to need the disk, got %v", err)
+	}
+
+	if c.GetFrameID(numbers[0]) != nil {
+		t.Errorf("the page of a cancelled read stayed in the cache")
+	}
+
+	if _, err := p.GetPageContext(ctx, numbers[len(numbers)-1], false); err != nil {
+		t.Errorf("expected a cached page without the disk, got %v", err)
+	}
+
+	fr, err := p.GetPage(numbers[0], false)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+
+	cell, err := fr.Page.(*pages.Page).Get(0)
+	if err != nil {
+		t.Fatalf("page %d lost its cell: %v", numbers[0], err)
+	}
+
+	if want := fmt.Sprintf("page-%d", numbers[0]); string(cell) != want {
+		t.Errorf("expected %q, got %q", want, cell)
+	}
+}
+
+// stallingFile holds the reads of page stall until release is closed and
+// tells started when the first one arrives
+type stallingFile struct {
+	*countingFile
+	stall   base.PageNumber
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (f *stallingFile) ReadAt(p []byte, off int64) (int, error) {
+	if base.PageNumber(off/constants.DefaultPageSize) == f.stall {
+		f.once.Do(func() { close(f.started) })
+		<-f.release
+	}
+
+	return f.countingFile.ReadAt(p, off)
+}
+
+// TestReadOutsideLock verifies a page is read without the pager lock, and
+// once for every caller asking for it while it is read
+func TestReadOutsideLock(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, p *Pager, file *stallingFile)
+	}{
+		{
+			name: "Callers share the read",
+			run: func(t *testing.T, p *Pager, file *stallingFile) {
+				var (
+					wg     sync.WaitGroup
+					frames = make([]*frame.Frame, 8)
+				)
+
+				for i := range frames {
+					wg.Add(1)
+
+					go func() {
+						defer wg.Done()
+
+						fr, err := p.GetPage(file.stall, true)
+						if err != nil {
+							t.Errorf("get failed: %v", err)
+							return
+						}
+
+						frames[i] = fr
+					}()
+				}
+
+				<-file.started
+
+				// the other callers arrive while the read is held
+				time.Sleep(20 * time.Millisecond)
+				close(file.release)
+				wg.Wait()
+
+				if n := file.count(file.stall); n != 1 {
+					t.Errorf("expected the page read once, got %d reads", n)
+				}
+
+				for _, fr := range frames {
+					if fr != frames[0] {
+						t.Errorf("callers were handed different frames")
+					}
+
+					p.ReleasePage(file.stall)
+				}
+			},
+		},
+		{
+			name: "The pager lock is free meanwhile",
+			run: func(t *testing.T, p *Pager, file *stallingFile) {
+				read := make(chan error, 1)
+
+				go func() {
+					_, err := p.GetPage(file.stall, false)
+					read <- err
+				}()
+
+				<-file.started
+
+				done := make(chan error, 1)
+
+				go func() {
+					_, _, err := p.PageCounts()
+					p.MarkDirty(0)
+					done <- err
+				}()
+
+				select {
+				case err := <-done:
+					if err != nil {
+						t.Errorf("page counts failed: %v", err)
+					}
+				case <-time.After(time.Second):
+					t.Errorf("the pager waited for a read of another page")
+				}
+
+				close(file.release)
+
+				if err := <-read; err != nil {
+					t.Errorf("get failed: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counting := &countingFile{MemFile: &files.MemFile{}, reads: make(map[base.PageNumber]int)}
+
+			p, err := CreateFile(counting, NewBuilder())
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+
+			var last base.PageNumber
+
+			for i := 0; i < 5; i++ {
+				if _, last, err = p.GetNewPage(false); err != nil {
+					t.Fatalf("allocate failed: %v", err)
+				}
+			}
+
+			if err := p.FlushAll(); err != nil {
+				t.Fatalf("flush failed: %v", err)
+			}
+
+			p.Stop()
+
+			// a second pager starts with only page zero cached
+			file := &stallingFile{countingFile: counting, stall: last, started: make(chan struct{}), release: make(chan struct{})}
+
+			p, err = OpenFile(file, NewBuilder().SetReadAhead(0))
+			if err != nil {
+				t.Fatalf("open failed: %v", err)
+			}
+
+			defer p.Close()
+
+			counting.lock.Lock()
+			clear(counting.reads)
+			counting.lock.Unlock()
+
+			tt.run(t, p, file)
+		})
+	}
+}
+
+// TestConcurrentReaders verifies B+tree readers sharing a pager find
+// every value while their pages are read in, evicted and written back
+// under them by the other readers, the background checkpoints and
+// flushes. Run it with -race.
+func TestConcurrentReaders(t *testing.T) {
+	const (
+		readers = 8
+		keys    = 1000
+	)
+
+	for _, r := range []cache.Replacement{cache.LRUK, cache.Clock, cache.TwoQ, cache.ARC} {
+		t.Run(r.String(), func(t *testing.T) {
+			var (
+				c    = cache.NewBuilder().SetMaxSize(48).SetShards(2).SetPinPercentageLimit(100).SetReplacement(r).BuildPool()
+				opts = NewBuilder().SetCache(c).SetWAL(wal.NewMemStore())
+			)
+
+			p, err := CreateFile(&files.MemFile{}, opts)
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+
+			defer p.Close()
+
+			tree, err := btree.New(p)
+			if err != nil {
+				t.Fatalf("failed to create tree: %v", err)
+			}
+
+			// the tree outgrows the cache, readers evict pages still dirty
+			for i := range keys {
+				if err := tree.Insert([]byte(fmt.Sprintf("key-%04d", i)), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+					t.Fatalf("insert failed: %v", err)
+				}
+			}
+
+			// the tree changes pages without latching them, checkpoints
+			// start once it is built
+			p.startCheckpointer(time.Millisecond, 0)
+
+			var (
+				wg   sync.WaitGroup
+				done = make(chan struct{})
+			)
+
+			for g := range readers {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					for i := g; i < 4*keys; i += readers {
+						key := (i * 7) % keys
+
+						got, err := tree.Get([]byte(fmt.Sprintf("key-%04d", key)))
+						if err != nil {
+							t.Errorf("get failed: %v", err)
+							return
+						}
+
+						if want := fmt.Sprintf("value-%d", key); string(got) != want {
+							t.Errorf("expected %q, got %q", want, got)
+							return
+						}
+					}
+				}()
+			}
+
+			flushed := make(chan error, 1)
+
+			go func() {
+				for {
+					select {
+					case <-done:
+						flushed <- nil
+						return
+					default:
+					}
+
+					if err := p.FlushAll(); err != nil {
+						flushed <- err
+						return
+					}
+				}
+			}()
+
+			wg.Wait()
+			close(done)
+
+			if err := <-flushed; err != nil {
+				t.Errorf("flush failed: %v", err)
+			}
+		})
+	}
+}
+
+// TestPinLimit verifies pages are not pinned past the limit of the cache,
+// and that a cache without an evictable frame refuses new pages
+func TestPinLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit float32
+		want  error
+	}{
+		{name: "Pin limit", limit: 50, want: errors.ErrPinLimit},
+		{name: "Every frame pinned", limit: 100, want: errors.ErrNoFreeFrame},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cache.NewBuilder().SetMaxSize(10).SetPinPercentageLimit(tt.limit).Build()
+
+			p, err := CreateFile(&files.MemFile{}, NewBuilder().SetCache(c))
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+
+			defer p.Close()
+
+			var pinned []base.PageNumber
+
+			defer func() {
+				for _, pn := range pinned {
+					p.ReleasePage(pn)
+				}
+			}()
+
+			for pn := base.PageNumber(1); pn <= 20; pn++ {
+				_, err := p.GetPage(pn, true)
+				if err == nil {
+					pinned = append(pinned, pn)
+					continue
+				}
+
+				if !goerrors.Is(err, tt.want) {
+					t.Fatalf("expected %v, got %v", tt.want, err)
+				}
+
+				if uint(len(pinned)) > uint(tt.limit)*c.GetMaxSize()/100 {
+					t.Errorf("%d pages were pinned past the limit", len(pinned))
+				}
+
+				return
+			}
+
+			t.Errorf("every page was pinned, expected %v", tt.want)
+		})
+	}
+}
+
+// TestOpenRejects verifies mismatched configurations and foreign files are refused
+func TestOpenRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, path string)
+		opts    *Builder
+		check   func(err error) bool
+	}{
+		{
+			name:    "Invalid page size",
+			prepare: func(t *testing.T, path string) {},
+			opts:    NewBuilder().SetPageSize(1000),
+			check:   func(err error) bool { return goerrors.Is(err, errors.ErrInvalidPageSize) },
+		},
+		{
+			name:    "Invalid block size",
+			prepare: func(t *testing.T, path string) {},
+			opts:    NewBuilder().SetBlockSize(3000),
+			check:   func(err error) bool { return goerrors.Is(err, errors.ErrInvalidBlockSize) },
+		},
+		{
+			name:    "Cache page size mismatch",
+			prepare: func(t *testing.T, path string) {},
+			opts:    NewBuilder().SetPageSize(8192).SetCache(cache.WithPageSize(4096)),
+			check:   func(err error) bool { return goerrors.Is(err, errors.ErrPageSizeMismatch) },
+		},
+		{
+			name: "Header page size mismatch",
+			prepare: func(t *testing.T, path string) {
+				p, err := Create(path, NewBuilder().SetPageSize(8192))
+				if err != nil {
+					t.Fatalf("create failed: %v", err)
+				}
+
+				p.Close()
+			},
+			opts: NewBuilder(),
+			check: func(err error) bool {
+				var mismatch *errors.HeaderMismatchError
+				return goerrors.As(err, &mismatch) && mismatch.Field == "page size"
+			},
+		},
+		{
+			name: "Header block size mismatch",
+			prepare: func(t *testing.T, path string) {
+				p, err := Create(path, NewBuilder().SetBlockSize(16384))
+				if err != nil {
+					t.Fatalf("create failed: %v", err)
+				}
+
+				p.Close()
+			},
+			opts: NewBuilder(),
+			check: func(err error) bool {
+				var mismatch *errors.HeaderMismatchError
+				return goerrors.As(err, &mismatch) && mismatch.Field == "block size"
+			},
+		},
+		{
+			name: "Not a database",
+			prepare: func(t *testing.T, path string) {
+				if err := os.WriteFile(path, []byte("definitely not a database"), 0644); err != nil {
+					t.Fatalf("write failed: %v", err)
+				}
+			},
+			opts:  NewBuilder(),
+			check: func(err error) bool { return goerrors.Is(err, errors.ErrNotADatabase) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := testPath(t)
+
+			if err := os.WriteFile(path, nil, 0644); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+
+			tt.prepare(t, path)
+
+			p, err := Open(path, tt.opts)
+			if err == nil {
+				p.Close()
+				t.Fatalf("expected open to fail")
+			}
+
+			if !tt.check(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// syncFile counts the writes not synced yet and survives Close, so the
+// pager can be reopened on it
+type syncFile struct {
+	*files.MemFile
+	unsynced int
+	syncs    int
+}
+
+func (s *syncFile) WriteAt(p []byte, off int64) (int, error) {
+	s.unsynced++
+	return s.MemFile.WriteAt(p, off)
+}
+
+func (s *syncFile) Sync() error {
+	s.unsynced = 0
+	s.syncs++
+
+	return s.MemFile.Sync()
+}
+
+func (s *syncFile) Close() error {
+	return nil
+}
+
+// TestFlush verifies flushed pages are written, marked clean and synced
+func TestFlush(t *testing.T) {
+	tests := []struct {
+		name   string
+		flush  func(p *Pager, pn base.PageNumber) error
+		closes bool
+	}{
+		{name: "Flush page", flush: func(p *Pager, pn base.PageNumber) error { return p.Flush(pn) }},
+		{name: "Flush all", flush: func(p *Pager, pn base.PageNumber) error { return p.FlushAll() }},
+		{name: "Close", flush: func(p *Pager, pn base.PageNumber) error { return p.Close() }, closes: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &syncFile{MemFile: &files.MemFile{}}
+
+			p, err := CreateFile(file, nil)
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+
+			handle, pn, err := p.GetNewPage(false)
+			if err != nil {
+				t.Fatalf("allocate failed: %v", err)
+			}
+
+			(*handle).(*pages.Page).Insert([]byte("kept"))
+			p.MarkDirty(pn)
+
+			syncs := file.syncs
+
+			if err := tt.flush(p, pn); err != nil {
+				t.Fatalf("flush failed: %v", err)
+			}
+
+			if file.unsynced != 0 || file.syncs == syncs {
+				t.Errorf("expected the file synced, %d writes left after %d syncs", file.unsynced, file.syncs-syncs)
+			}
+
+			if !tt.closes {
+				fr, _ := p.GetPage(pn, false)
+
+				if fr.IsSet(constants.DirtyFlag) {
+					t.Errorf("expected page %d to be clean", pn)
+				}
+
+				p.Stop()
+			}
+
+			p, err = OpenFile(file, nil)
+			if err != nil {
+				t.Fatalf("open failed: %v", err)
+			}
+
+			defer p.Close()
+
+			fr, err := p.GetPage(pn, false)
+			if err != nil {
+				t.Fatalf("get failed: %v", err)
+			}
+
+			if cell, err := fr.Page.(*pages.Page).Get(0); err != nil || string(cell) != "kept" {
+				t.Errorf("expected the flushed cell, got %q, %v", cell, err)
+			}
+		})
+	}
+}
+
+// TestChecksums verifies every algorithm is kept by the database and
+// catches a flipped bit when the page is read back
+func TestChecksums(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm checksum.Algorithm
+	}{
+		{name: "None", algorithm: checksum.None},
+		{name: "CRC32C", algorithm: checksum.CRC32C},
+		{name: "XXHash32", algorithm: checksum.XXHash32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &syncFile{MemFile: &files.MemFile{}}
+
+			p, err := CreateFile(file, NewBuilder().SetChecksum(tt.algorithm))
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+
+			handle, pn, err := p.GetNewPage(false)
+			if err != nil {
+				t.Fatalf("allocate failed: %v", err)
+			}
+
+			(*handle).(*pages.Page).Insert([]byte("checked"))
+			p.MarkDirty(pn)
+
+			if err := p.Close(); err != nil {
+				t.Fatalf("close failed: %v", err)
+			}
+
+			// the algorithm comes from the header, not from the options
+			p, err = OpenFile(file, nil)
+			if err != nil {
+				t.Fatalf("open failed: %v", err)
+			}
+
+			if _, err := p.GetPage(pn, false); err != nil {
+				t.Fatalf("intact page refused: %v", err)
+			}
+
+			p.Stop()
+
+			at := int64(pn)*constants.DefaultPageSize + 100
+			flipped := make([]byte, 1)
+
+			file.Seek(at, io.SeekStart)
+			file.Read(flipped)
+			flipped[0] ^= 0x01
+			file.Seek(at, io.SeekStart)
+			file.Write(flipped)
+
+			p, err = OpenFile(file, nil)
+			if err != nil {
+				t.Fatalf("open failed: %v", err)
+			}
+
+			defer p.Close()
+
+			_, err = p.GetPage(pn, false)
+
+			if tt.algorithm == checksum.None {
+				if err != nil {
+					t.Errorf("expected an unchecked page to be read, got %v", err)
+				}
+
+				return
+			}
+
+			var corrupted *errors.PageCorruptedError
+			if !goerrors.Is(err, errors.ErrPageCorrupted) || !goerrors.As(err, &corrupted) || corrupted.Page != uint64(pn) {
+				t.Errorf("expected ErrPageCorrupted for page %d, got %v", pn, err)
+			}
+		})
+	}
+}
+
+// walGuard fails the test when a page reaches the data file before the log
+// records describing it are durable
+type walGuard struct {
+	*files.MemFile
+	t     *testing.T
+	pager *Pager
+}
+
+func (g *walGuard) WriteAt(p []byte, off int64) (int, error) {
+	if g.pager != nil && g.pager.log != nil {
+		pn := base.PageNumber(off / int64(g.pager.pageSize))
+
+		if frameID := g.pager.cache.GetFrameID(pn); frameID != nil {
+			fr := g.pager.cache.GetFrame(*frameID).(*frame.Frame)
+
+			if fr.LSN != 0 && fr.LSN >= g.pager.log.FlushedLSN() {
+				g.t.Errorf("page %d written before its record %d was flushed", pn, fr.LSN)
+			}
+		}
+	}
+
+	return g.MemFile.WriteAt(p, off)
+}
+
+// TestWriteAheadRule verifies evicted pages never overtake the log and commits are logged
+func TestWriteAheadRule(t *testing.T) {
+	var (
+		guard = &walGuard{MemFile: &files.MemFile{}, t: t}
+		log   = wal.NewMemStore()
+		opts  = NewBuilder().SetCache(cache.NewBuilder().SetMaxSize(10).Build()).SetWAL(log)
+	)
+
+	p, err := CreateFile(guard, opts)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	guard.pager = p
+
+	tx, err := p.Begin()
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+
+	if _, err := p.Begin(); !goerrors.Is(err, errors.ErrTxActive) {
+		t.Errorf("expected ErrTxActive, got %v", err)
+	}
+
+	for i := 0; i < 30; i++ {
+		handle, pn, err := p.GetNewPage(false)
+		if err != nil {
+			t.Fatalf("allocate failed: %v", err)
+		}
+
+		(*handle).(*pages.Page).Insert([]byte(fmt.Sprintf("page-%d", pn)))
+		p.MarkDirty(pn)
+	}
+
+	if err := p.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+
+	var (
+		r       = p.log.NewReader(0)
+		updates int
+		commit  bool
+	)
+
+	for rec, err := r.Next(); err == nil; rec, err = r.Next() {
+		if rec.TxID == tx && rec.Type == wal.UpdateRecord {
+			updates++
+		}
+
+		commit = commit || (rec.TxID == tx && rec.Type == wal.CommitRecord)
+	}
+
+	if updates < 30 || !commit {
+		t.Errorf("expected at least 30 updates and a durable commit, got %d updates, commit %v", updates, commit)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Package pagertest provides an in-memory pager for testing structures that
+// store their nodes through the pager.
+package pagertest
+
+import (
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/frame"
+	"github.com/dark-vinci/nildb/interfaces"
+	"github.com/dark-vinci/nildb/pages"
+)
+
+// MemPager keeps every page in memory and counts pins, so tests can check
+// that pages are released after use.
+type MemPager struct {
+	pageSize int
+	frames   map[base.PageNumber]*frame.Frame
+	pins     map[base.PageNumber]int
+	free     []base.PageNumber
+	next     base.PageNumber
+}
+
+func NewMemPager(pageSize int) *MemPager {
+	return &MemPager{
+		pageSize: pageSize,
+		frames:   make(map[base.PageNumber]*frame.Frame),
+		pins:     make(map[base.PageNumber]int),
+		free:     nil,
+		next:     1, // page zero holds the database header
+	}
+}
+
+func (m *MemPager) GetPage(pn base.PageNumber, pin bool) (*frame.Frame, error) {
+	fr, ok := m.frames[pn]
+	if !ok {
+		fr = frame.NewFrame(pn, pages.Alloc(m.pageSize))
+		m.frames[pn] = fr
+	}
+
+	if pin {
+		m.pins[pn]++
+	}
+
+	return fr, nil
+}
+
+func (m *MemPager) GetNewPage(pin bool) (*faces.PageHandle, base.PageNumber, error) {
+	var pn base.PageNumber
+
+	if len(m.free) > 0 {
+		pn = m.free[len(m.free)-1]
+		m.free = m.free[:len(m.free)-1]
+	} else {
+		pn = m.next
+		m.next++
+	}
+
+	fr := frame.NewFrame(pn, pages.Alloc(m.pageSize))
+	m.frames[pn] = fr
+
+	if pin {
+		m.pins[pn]++
+	}
+
+	return &fr.Page, pn, nil
+}
+
+func (m *MemPager) ReleasePage(pn base.PageNumber) {
+	if m.pins[pn] > 0 {
+		m.pins[pn]--
+	}
+}
+
+func (m *MemPager) FreePage(pn base.PageNumber) error {
+	delete(m.frames, pn)
+	m.free = append(m.free, pn)
+
+	return nil
+}
+
+func (m *MemPager) MarkDirty(pn base.PageNumber) {
+	if fr, ok := m.frames[pn]; ok {
+		fr.Set(constants.DirtyFlag)
+	}
+}
+
+// Pinned returns the number of outstanding pins over all pages
+func (m *MemPager) Pinned() int {
+	total := 0
+
+	for _, count := range m.pins {
+		total += count
+	}
+
+	return total
+}
+
+// Allocated returns the number of pages in use
+func (m *MemPager) Allocated() int {
+	return len(m.frames)
+}
@@ -0,0 +1,104 @@
+package pager
+
+import (
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/frame"
+	"github.com/dark-vinci/nildb/interfaces"
+)
+
+// readAheadTrigger is how many pages asked for one after the other make a
+// sequential scan the pager reads ahead of
+const readAheadTrigger = 2
+
+// Prefetch starts reading pns into the cache with the lowest priority and
+// returns without waiting for them. Cached pages and pages past the end of
+// the file are skipped, and so are the pages whose disk queue is full. A
+// prefetched page does not count as used until it is asked for, and it
+// only takes the frame of a clean page used less than K times, so hot
+// pages stay and nothing is written back; once no such frame is left the
+// rest is dropped. A page asked for while it is read ahead waits for that
+// read.
+func (p *Pager) Prefetch(pns ...base.PageNumber) {
+	// the count kept by the pager, reading page zero could evict a page
+	total := p.pages.Load()
+
+	for _, pn := range pns {
+		if uint64(pn) >= total || p.cache.Contains(pn) {
+			continue
+		}
+
+		frameID, ok := p.cache.MapCold(pn)
+		if !ok {
+			return
+		}
+
+		fr := p.cache.GetFrame(frameID).(*frame.Frame)
+
+		done, ok := p.worker.TrySubmit(faces.DiskRequest{
+			Type:       base.ReadOp,
+			PageNumber: pn,
+			Page:       fr.Page,
+			Priority:   base.PrefetchRead,
+		})
+		if !ok {
+			// the disk is busy enough, the page is read when it is asked for
+			p.cache.Invalidate(pn)
+			continue
+		}
+
+		p.prefetches.Add(1)
+
+		go p.prefetched(pn, fr, done)
+	}
+}
+
+// prefetched makes a page read ahead usable once its read is done, a
+// failed read leaves it out of the cache and the page is read again when
+// it is asked for
+func (p *Pager) prefetched(pn base.PageNumber, fr *frame.Frame, done chan faces.DiskResult) {
+	defer p.prefetches.Done()
+
+	if result := <-done; result.Error != nil {
+		p.cache.Invalidate(pn)
+		return
+	}
+
+	p.remember(fr)
+	p.cache.Loaded(pn, false)
+}
+
+// readAheadOf reads ahead of pn once the pages asked for look like a
+// sequential scan
+func (p *Pager) readAheadOf(pn base.PageNumber) {
+	if p.readAhead == 0 {
+		return
+	}
+
+	var sequential int64
+
+	switch last := base.PageNumber(p.lastRead.Swap(uint64(pn))); pn {
+	case last + 1:
+		sequential = p.sequential.Add(1)
+	case last:
+		sequential = p.sequential.Load()
+	default:
+		p.sequential.Store(0)
+	}
+
+	if sequential < readAheadTrigger {
+		return
+	}
+
+	pns := make([]base.PageNumber, 0, p.readAhead)
+
+	for next := pn + 1; next <= pn+base.PageNumber(p.readAhead); next++ {
+		pns = append(pns, next)
+	}
+
+	p.Prefetch(pns...)
+}
+
+// settleAll waits for every read ahead
+func (p *Pager) settleAll() {
+	p.prefetches.Wait()
+}
@@ -0,0 +1,222 @@
+package pager
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/cache"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/files"
+	"github.com/dark-vinci/nildb/pages"
+)
+
+// countingFile counts the reads of every page
+type countingFile struct {
+	*files.MemFile
+	lock  sync.Mutex
+	reads map[base.PageNumber]int
+}
+
+func (f *countingFile) ReadAt(p []byte, off int64) (int, error) {
+	f.lock.Lock()
+	f.reads[base.PageNumber(off/constants.DefaultPageSize)]++
+	f.lock.Unlock()
+
+	return f.MemFile.ReadAt(p, off)
+}
+
+func (f *countingFile) count(pn base.PageNumber) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.reads[pn]
+}
+
+func (f *countingFile) total() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var n int
+
+	for _, reads := range f.reads {
+		n += reads
+	}
+
+	return n
+}
+
+// TestPrefetch verifies pages read ahead are served from the cache without
+// another read, and never push out pages in use
+func TestPrefetch(t *testing.T) {
+	tests := []struct {
+		name      string
+		readAhead uint
+		run       func(t *testing.T, p *Pager, c *cache.Cache, file *countingFile, numbers []base.PageNumber)
+	}{
+		{
+			name: "Prefetched pages are read once",
+			run: func(t *testing.T, p *Pager, c *cache.Cache, file *countingFile, numbers []base.PageNumber) {
+				p.Prefetch(numbers[:4]...)
+
+				for _, pn := range numbers[:4] {
+					checkPage(t, p, pn)
+
+					if n := file.count(pn); n != 1 {
+						t.Errorf("expected page %d read once, got %d", pn, n)
+					}
+				}
+			},
+		},
+		{
+			name: "Hot pages stay cached",
+			run: func(t *testing.T, p *Pager, c *cache.Cache, file *countingFile, numbers []base.PageNumber) {
+				hot := numbers[:9]
+
+				// page zero and the hot pages fill the cache, page zero was used once by open
+				if _, err := p.GetPage(0, false); err != nil {
+					t.Fatalf("get failed: %v", err)
+				}
+
+				for _, pn := range append(hot, hot...) {
+					checkPage(t, p, pn)
+				}
+
+				p.Prefetch(numbers[9:]...)
+				p.settleAll()
+
+				for _, pn := range hot {
+					if !c.Contains(pn) {
+						t.Errorf("prefetching evicted page %d, used twice", pn)
+					}
+				}
+
+				if n := file.total(); n != len(hot) {
+					t.Errorf("expected only the hot pages read, got %d reads", n)
+				}
+			},
+		},
+		{
+			name: "Pages past the end are skipped",
+			run: func(t *testing.T, p *Pager, c *cache.Cache, file *countingFile, numbers []base.PageNumber) {
+				p.Prefetch(numbers[len(numbers)-1]+1, numbers[len(numbers)-1]+100)
+				p.settleAll()
+
+				if n := file.total(); n != 0 {
+					t.Errorf("expected no read, got %d", n)
+				}
+			},
+		},
+		{
+			name:      "Sequential scan reads ahead",
+			readAhead: 4,
+			run: func(t *testing.T, p *Pager, c *cache.Cache, file *countingFile, numbers []base.PageNumber) {
+				for _, pn := range numbers[:8] {
+					checkPage(t, p, pn)
+				}
+
+				for _, pn := range numbers[:8] {
+					if n := file.count(pn); n != 1 {
+						t.Errorf("expected page %d read once, got %d", pn, n)
+					}
+				}
+
+				p.settleAll()
+
+				// read ahead of the last page asked for
+				for _, pn := range numbers[8:12] {
+					if !c.Contains(pn) {
+						t.Errorf("expected page %d read ahead", pn)
+					}
+				}
+			},
+		},
+		{
+			name:      "Random access does not read ahead",
+			readAhead: 4,
+			run: func(t *testing.T, p *Pager, c *cache.Cache, file *countingFile, numbers []base.PageNumber) {
+				picked := []base.PageNumber{numbers[6], numbers[1], numbers[9], numbers[3]}
+
+				for _, pn := range picked {
+					checkPage(t, p, pn)
+				}
+
+				p.settleAll()
+
+				if n := file.total(); n != len(picked) {
+					t.Errorf("expected %d reads, got %d", len(picked), n)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &countingFile{MemFile: &files.MemFile{}, reads: make(map[base.PageNumber]int)}
+
+			p, err := CreateFile(file, NewBuilder())
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+
+			var numbers []base.PageNumber
+
+			for i := 0; i < 20; i++ {
+				handle, pn, err := p.GetNewPage(false)
+				if err != nil {
+					t.Fatalf("allocate failed: %v", err)
+				}
+
+				if _, err := (*handle).(*pages.Page).Insert([]byte(fmt.Sprintf("page-%d", pn))); err != nil {
+					t.Fatalf("insert failed: %v", err)
+				}
+
+				numbers = append(numbers, pn)
+			}
+
+			if err := p.FlushAll(); err != nil {
+				t.Fatalf("flush failed: %v", err)
+			}
+
+			p.Stop()
+
+			// a second pager starts with none of the pages cached
+			c := cache.NewBuilder().SetMaxSize(10).Build()
+
+			p, err = OpenFile(file, NewBuilder().SetCache(c).SetReadAhead(tt.readAhead))
+			if err != nil {
+				t.Fatalf("open failed: %v", err)
+			}
+
+			defer p.Close()
+
+			file.lock.Lock()
+			clear(file.reads)
+			file.lock.Unlock()
+
+			tt.run(t, p, c, file, numbers)
+		})
+	}
+}
+
+func checkPage(t *testing.T, p *Pager, pn base.PageNumber) {
+	t.Helper()
+
+	// pinned while read, a page read ahead may take the frame of an unpinned one
+	fr, err := p.GetPage(pn, true)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+
+	defer p.ReleasePage(pn)
+
+	cell, err := fr.Page.(*pages.Page).Get(0)
+	if err != nil {
+		t.Fatalf("page %d lost its cell: %v", pn, err)
+	}
+
+	if want := fmt.Sprintf("page-%d", pn); string(cell) != want {
+		t.Errorf("expected %q, got %q", want, cell)
+	}
+}
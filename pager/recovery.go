@@ -0,0 +1,282 @@
+package pager
+
+import (
+	"context"
+	"io"
+	"maps"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/frame"
+	"github.com/dark-vinci/nildb/pages"
+	"github.com/dark-vinci/nildb/wal"
+)
+
+// analysis holds the tables rebuilt from the log before redo and undo
+type analysis struct {
+	active map[uint64]base.LSN          // transactions without commit or abort, with their last record
+	dirty  map[base.PageNumber]base.LSN // pages that may be stale on disk, with the first record to redo
+}
+
+// recover brings the data file back to the state the log describes:
+// analysis rebuilds the transaction and dirty page tables, starting over
+// from every checkpoint it meets, redo repeats history from the oldest dirty page and undo
+// rolls back every transaction that never committed
+func (p *Pager) recover() error {
+	state, err := p.analyze(p.log.FirstLSN())
+	if err != nil {
+		return err
+	}
+
+	if err := p.redo(state); err != nil {
+		return err
+	}
+
+	losers := make(map[uint64]*undoState, len(state.active))
+
+	for tx, last := range state.active {
+		losers[tx] = &undoState{next: last, last: last}
+	}
+
+	if err := p.undo(losers); err != nil {
+		return err
+	}
+
+	return p.log.FlushAll()
+}
+
+func (p *Pager) analyze(from base.LSN) (*analysis, error) {
+	state := &analysis{
+		active: make(map[uint64]base.LSN),
+		dirty:  make(map[base.PageNumber]base.LSN),
+	}
+
+	r := p.log.NewReader(from)
+
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return state, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// a checkpoint saved both tables, what came before it is settled
+		if rec.Type == wal.CheckpointRecord {
+			state.active = maps.Clone(rec.Checkpoint.Active)
+			state.dirty = maps.Clone(rec.Checkpoint.Dirty)
+
+			continue
+		}
+
+		if rec.TxID != 0 {
+			switch rec.Type {
+			case wal.CommitRecord, wal.AbortRecord:
+				delete(state.active, rec.TxID)
+			default:
+				state.active[rec.TxID] = rec.LSN
+			}
+		}
+
+		if rec.Type == wal.UpdateRecord || rec.Type == wal.CompensationRecord {
+			if _, ok := state.dirty[rec.Page]; !ok {
+				state.dirty[rec.Page] = rec.LSN
+			}
+		}
+	}
+}
+
+// redo applies every logged change to a dirty page again, losers included.
+// Records hold whole byte ranges, applying them in order is idempotent.
+func (p *Pager) redo(state *analysis) error {
+	if len(state.dirty) == 0 {
+		return nil
+	}
+
+	start := base.LSN(^uint64(0))
+	for _, recLSN := range state.dirty {
+		start = min(start, recLSN)
+	}
+
+	r := p.log.NewReader(start)
+
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if rec.Type != wal.UpdateRecord && rec.Type != wal.CompensationRecord {
+			continue
+		}
+
+		if recLSN, ok := state.dirty[rec.Page]; !ok || rec.LSN < recLSN {
+			continue
+		}
+
+		fr, err := p.getPage(context.Background(), rec.Page, true)
+		if err != nil {
+			return err
+		}
+
+		rec.Apply(fr.Page.(*pages.Page).Bytes())
+		p.stamp(fr, rec.LSN)
+		p.releasePage(rec.Page)
+	}
+}
+
+// undoState tracks a transaction being rolled back
+type undoState struct {
+	next base.LSN // next record to undo
+	last base.LSN // last record written by the transaction
+}
+
+// undo rolls back the given transactions newest change first. Every
+// reverted update is logged as a compensation record pointing past it, so
+// a crash during undo never reverts the same change twice.
+func (p *Pager) undo(losers map[uint64]*undoState) error {
+	for len(losers) > 0 {
+		var (
+			tx    uint64
+			state *undoState
+		)
+
+		for id, s := range losers {
+			if state == nil || s.next > state.next {
+				tx, state = id, s
+			}
+		}
+
+		if state.next == 0 {
+			if err := p.endRollback(tx, state); err != nil {
+				return err
+			}
+
+			delete(losers, tx)
+
+			continue
+		}
+
+		rec, err := p.log.Read(state.next)
+		if err != nil {
+			return err
+		}
+
+		switch rec.Type {
+		case wal.UpdateRecord:
+			lsn, err := p.compensate(rec, state.last)
+			if err != nil {
+				return err
+			}
+
+			state.last = lsn
+			state.next = rec.PrevLSN
+
+		case wal.CompensationRecord:
+			state.next = rec.UndoNext
+
+		case wal.BeginRecord:
+			state.next = 0
+
+		default:
+			return errors.ErrCorruptedRecord
+		}
+	}
+
+	return nil
+}
+
+// endRollback logs that tx is fully rolled back
+func (p *Pager) endRollback(tx uint64, state *undoState) error {
+	_, err := p.log.Append(&wal.Record{PrevLSN: state.last, TxID: tx, Type: wal.AbortRecord})
+
+	return err
+}
+
+// compensate reverts update in its page and logs the compensation record
+func (p *Pager) compensate(update *wal.Record, last base.LSN) (base.LSN, error) {
+	fr, err := p.getPage(context.Background(), update.Page, true)
+	if err != nil {
+		return 0, err
+	}
+
+	defer p.releasePage(update.Page)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	diffs := make([]wal.Diff, len(update.Diffs))
+
+	for i, d := range update.Diffs {
+		diffs[i] = wal.Diff{Offset: d.Offset, After: d.Before}
+	}
+
+	lsn, err := p.log.Append(&wal.Record{
+		PrevLSN:  last,
+		TxID:     update.TxID,
+		Type:     wal.CompensationRecord,
+		Page:     update.Page,
+		UndoNext: update.PrevLSN,
+		Diffs:    diffs,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	update.Revert(fr.Page.(*pages.Page).Bytes())
+	p.stamp(fr, lsn)
+
+	return lsn, nil
+}
+
+// stamp marks a page changed by the record at lsn, the change is already logged
+func (p *Pager) stamp(fr *frame.Frame, lsn base.LSN) {
+	fr.LSN = lsn
+
+	if fr.RecLSN == 0 {
+		fr.RecLSN = lsn
+	}
+
+	p.remember(fr)
+	p.cache.MarkDirty(fr.PageNumber)
+}
+
+// Rollback undoes every change of the running transaction. Checkpoints
+// wait for it, the log keeps the records being undone.
+func (p *Pager) Rollback() error {
+	p.checkpointLock.Lock()
+	defer p.checkpointLock.Unlock()
+
+	tx, last, err := p.abandon()
+	if err != nil {
+		return err
+	}
+
+	return p.undo(map[uint64]*undoState{tx: {next: last, last: last}})
+}
+
+// abandon logs the changes left of the running transaction and ends it.
+// Its pages are undone after, without the pager lock, they may be read in.
+func (p *Pager) abandon() (uint64, base.LSN, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.tx == 0 {
+		return 0, 0, errors.ErrNoTx
+	}
+
+	if err := p.logTouched(); err != nil {
+		return 0, 0, err
+	}
+
+	tx, last := p.tx, p.txLast
+	p.tx, p.txLast, p.txFirst = 0, 0, 0
+
+	return tx, last, nil
+}
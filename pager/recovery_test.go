@@ -0,0 +1,553 @@
+package pager
+
+import (
+	"bytes"
+	goerrors "errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/btree"
+	"github.com/dark-vinci/nildb/cache"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/files"
+	"github.com/dark-vinci/nildb/pages"
+	"github.com/dark-vinci/nildb/wal"
+)
+
+var errCrash = goerrors.New("simulated crash")
+
+// crashingFile stops accepting writes once its budget is spent, like a
+// process killed between two Block.Write calls
+type crashingFile struct {
+	*files.MemFile
+	budget int // writes left, negative for no limit
+	writes int
+}
+
+func (c *crashingFile) WriteAt(p []byte, off int64) (int, error) {
+	if c.budget == 0 {
+		return 0, errCrash
+	}
+
+	c.budget--
+	c.writes++
+
+	return c.MemFile.WriteAt(p, off)
+}
+
+// tearingFile writes only the first half of its tear-th write, like a page
+// torn by a power loss, and refuses every write after it
+type tearingFile struct {
+	*files.MemFile
+	tear    int // write to tear, counted from 1, zero for none
+	writes  int
+	crashed bool
+}
+
+func (f *tearingFile) WriteAt(p []byte, off int64) (int, error) {
+	if f.crashed {
+		return 0, errCrash
+	}
+
+	if f.writes++; f.writes == f.tear {
+		f.crashed = true
+		f.MemFile.WriteAt(p[:len(p)/2], off)
+
+		return 0, errCrash
+	}
+
+	return f.MemFile.WriteAt(p, off)
+}
+
+func (f *tearingFile) Close() error {
+	return nil
+}
+
+// volatileFile keeps its writes in memory until synced, like the page
+// cache of the system, a crash loses the writes after the last sync.
+// Syncs fail once failSync is set.
+type volatileFile struct {
+	*files.MemFile // what the process reads back
+	durable        *files.MemFile
+	lock           sync.Mutex
+	pending        []volatileWrite
+	failSync       bool
+}
+
+type volatileWrite struct {
+	data []byte
+	off  int64
+}
+
+func (v *volatileFile) WriteAt(p []byte, off int64) (int, error) {
+	v.lock.Lock()
+	v.pending = append(v.pending, volatileWrite{data: bytes.Clone(p), off: off})
+	v.lock.Unlock()
+
+	return v.MemFile.WriteAt(p, off)
+}
+
+func (v *volatileFile) Sync() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if v.failSync {
+		return errCrash
+	}
+
+	for _, w := range v.pending {
+		if _, err := v.durable.WriteAt(w.data, w.off); err != nil {
+			return err
+		}
+	}
+
+	v.pending = nil
+
+	return nil
+}
+
+func recoveryOpts(log wal.Store) *Builder {
+	c := cache.NewBuilder().SetMaxSize(12).SetPinPercentageLimit(100).Build()
+
+	// checkpoints only run where the workload asks for them
+	return NewBuilder().SetCache(c).SetWAL(log).SetCheckpointInterval(0).SetCheckpointLogSize(0)
+}
+
+func recoveryKey(batch, i int) []byte {
+	return []byte(fmt.Sprintf("batch-%d-key-%03d", batch, i))
+}
+
+func recoveryValue(batch, i int) []byte {
+	return bytes.Repeat([]byte{byte(batch*50 + i)}, 600)
+}
+
+// crashRun is what the workload managed to do before the crash
+type crashRun struct {
+	root      base.PageNumber
+	committed map[int]bool
+}
+
+// runWorkload fills three batches of keys, each in its own transaction.
+// The first commits, the second rolls back and the third is left running,
+// with a checkpoint after each one when asked. It stops at the first
+// error, which is where the simulated crash hit.
+func runWorkload(p *Pager, checkpoint bool) crashRun {
+	run := crashRun{committed: make(map[int]bool)}
+
+	if _, err := p.Begin(); err != nil {
+		return run
+	}
+
+	tree, err := btree.New(p)
+	if err != nil {
+		return run
+	}
+
+	for batch := 0; batch < 3; batch++ {
+		if batch > 0 {
+			if _, err := p.Begin(); err != nil {
+				return run
+			}
+		}
+
+		for i := 0; i < 40; i++ {
+			if err := tree.Insert(recoveryKey(batch, i), recoveryValue(batch, i)); err != nil {
+				return run
+			}
+		}
+
+		switch batch {
+		case 0:
+			if err := p.Commit(); err != nil {
+				return run
+			}
+
+			run.root = tree.Root()
+			run.committed[batch] = true
+
+		case 1:
+			if err := p.Rollback(); err != nil {
+				return run
+			}
+		}
+
+		if checkpoint {
+			if err := p.Checkpoint(); err != nil {
+				return run
+			}
+		}
+	}
+
+	return run
+}
+
+// checkRecovered verifies committed batches are complete and nothing else survived
+func checkRecovered(t *testing.T, p *Pager, run crashRun) {
+	t.Helper()
+
+	if !run.committed[0] {
+		return
+	}
+
+	tree, err := btree.Open(p, run.root)
+	if err != nil {
+		t.Fatalf("failed to open tree: %v", err)
+	}
+
+	for batch := 0; batch < 3; batch++ {
+		for i := 0; i < 40; i++ {
+			got, err := tree.Get(recoveryKey(batch, i))
+
+			if run.committed[batch] {
+				if err != nil || !bytes.Equal(got, recoveryValue(batch, i)) {
+					t.Fatalf("committed key %s lost: %v", recoveryKey(batch, i), err)
+				}
+
+				continue
+			}
+
+			if !goerrors.Is(err, errors.ErrKeyNotFound) {
+				t.Fatalf("uncommitted key %s survived: %v", recoveryKey(batch, i), err)
+			}
+		}
+	}
+}
+
+// TestCrashRecovery verifies no committed data is lost and no uncommitted
+// data survives a crash between any two page writes
+func TestCrashRecovery(t *testing.T) {
+	for _, checkpoint := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Checkpoints %v", checkpoint), func(t *testing.T) {
+			crashRecovery(t, checkpoint)
+		})
+	}
+}
+
+func crashRecovery(t *testing.T, checkpoint bool) {
+	// a run without crash tells how many page writes the workload makes
+	probe := &crashingFile{MemFile: &files.MemFile{}, budget: -1}
+
+	p, err := CreateFile(probe, recoveryOpts(wal.NewMemStore()))
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	runWorkload(p, checkpoint)
+	p.Stop()
+
+	total := probe.writes
+	step := max(total/5, 1)
+
+	for budget := 0; budget <= total+step; budget += step {
+		t.Run(fmt.Sprintf("Crash after %d writes", budget), func(t *testing.T) {
+			var (
+				data = &crashingFile{MemFile: &files.MemFile{}, budget: -1}
+				log  = wal.NewMemStore()
+			)
+
+			p, err := CreateFile(data, recoveryOpts(log))
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+
+			// small segments let checkpoints drop part of the log
+			p.log.SetSegmentSize(4 << 10)
+
+			// the header write does not count against the budget
+			data.budget = budget
+			run := runWorkload(p, checkpoint)
+			p.Stop()
+
+			for attempt := 0; attempt < 2; attempt++ {
+				data.budget = -1
+
+				p, err = OpenFile(data, recoveryOpts(log))
+				if err != nil {
+					t.Fatalf("recovery failed: %v", err)
+				}
+
+				checkRecovered(t, p, run)
+
+				// crash again right after recovery, it must be repeatable
+				p.Stop()
+			}
+		})
+	}
+}
+
+// TestRollback verifies a rolled back transaction leaves its pages as they were
+func TestRollback(t *testing.T) {
+	p, err := CreateFile(&files.MemFile{}, recoveryOpts(wal.NewMemStore()))
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	defer p.Close()
+
+	_, before, _ := p.PageCounts()
+
+	if _, err := p.Begin(); err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+
+	tree, err := btree.New(p)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+
+	for i := 0; i < 40; i++ {
+		if err := tree.Insert(recoveryKey(0, i), recoveryValue(0, i)); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	if err := p.Rollback(); err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+
+	if err := p.Rollback(); !goerrors.Is(err, errors.ErrNoTx) {
+		t.Errorf("expected ErrNoTx, got %v", err)
+	}
+
+	if _, after, _ := p.PageCounts(); after != before {
+		t.Errorf("expected %d pages after rollback, got %d", before, after)
+	}
+}
+
+// TestCheckpoint verifies checkpoints drop old log segments, on demand and
+// in the background once the log grows, and the database still recovers
+func TestCheckpoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		logSize    int64
+		background bool
+	}{
+		{name: "On demand"},
+		{name: "Log size", logSize: 8 << 10, background: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				data = &files.MemFile{}
+				log  = wal.NewMemStore()
+			)
+
+			p, err := CreateFile(data, recoveryOpts(log).SetCheckpointLogSize(tt.logSize))
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+
+			p.log.SetSegmentSize(4 << 10)
+
+			if _, err := p.Begin(); err != nil {
+				t.Fatalf("begin failed: %v", err)
+			}
+
+			tree, err := btree.New(p)
+			if err != nil {
+				t.Fatalf("failed to create tree: %v", err)
+			}
+
+			for i := 0; i < 40; i++ {
+				if err := tree.Insert(recoveryKey(0, i), recoveryValue(0, i)); err != nil {
+					t.Fatalf("insert failed: %v", err)
+				}
+			}
+
+			if err := p.Commit(); err != nil {
+				t.Fatalf("commit failed: %v", err)
+			}
+
+			segments, _ := log.Segments()
+
+			if !tt.background {
+				if err := p.Checkpoint(); err != nil {
+					t.Fatalf("checkpoint failed: %v", err)
+				}
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+
+			for p.log.FirstLSN() == 1 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if left, _ := log.Segments(); p.log.FirstLSN() == 1 || len(left) >= len(segments) {
+				t.Fatalf("expected old segments dropped, %d of %d left", len(left), len(segments))
+			}
+
+			// crash without writing the remaining pages back
+			p.Stop()
+
+			p, err = OpenFile(data, recoveryOpts(log))
+			if err != nil {
+				t.Fatalf("recovery failed: %v", err)
+			}
+
+			defer p.Close()
+
+			checkRecovered(t, p, crashRun{root: tree.Root(), committed: map[int]bool{0: true}})
+		})
+	}
+}
+
+// TestUnsyncedWrites verifies pages written back but never synced are
+// still redone when a checkpoint crashes before its sync, the checkpoint
+// record must list them
+func TestUnsyncedWrites(t *testing.T) {
+	var (
+		data = &volatileFile{MemFile: &files.MemFile{}, durable: &files.MemFile{}}
+		log  = wal.NewMemStore()
+	)
+
+	p, err := CreateFile(data, recoveryOpts(log))
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	if _, err := p.Begin(); err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+
+	tree, err := btree.New(p)
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+
+	// the tree outgrows the cache, evicted pages are written but not synced
+	for batch := 0; batch < 3; batch++ {
+		for i := 0; i < 40; i++ {
+			if err := tree.Insert(recoveryKey(batch, i), recoveryValue(batch, i)); err != nil {
+				t.Fatalf("insert failed: %v", err)
+			}
+		}
+	}
+
+	if err := p.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+
+	data.failSync = true
+
+	if err := p.Checkpoint(); !goerrors.Is(err, errCrash) {
+		t.Fatalf("expected the checkpoint sync to fail, got %v", err)
+	}
+
+	p.Stop()
+
+	p, err = OpenFile(data.durable, recoveryOpts(log))
+	if err != nil {
+		t.Fatalf("recovery failed: %v", err)
+	}
+
+	defer p.Close()
+
+	checkRecovered(t, p, crashRun{root: tree.Root(), committed: map[int]bool{0: true, 1: true, 2: true}})
+}
+
+// TestTornPage verifies a page torn by a crash is restored from the
+// double-write area, and is reported as corrupted without one
+func TestTornPage(t *testing.T) {
+	tests := []struct {
+		name        string
+		doubleWrite bool
+	}{
+		{name: "Double-write", doubleWrite: true},
+		{name: "In place", doubleWrite: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				data = &tearingFile{MemFile: &files.MemFile{}}
+				area = &tearingFile{MemFile: &files.MemFile{}}
+				opts = NewBuilder()
+			)
+
+			if tt.doubleWrite {
+				opts.SetDoubleWriteFile(area)
+			}
+
+			p, err := CreateFile(data, opts)
+			if err != nil {
+				t.Fatalf("create failed: %v", err)
+			}
+
+			var numbers []base.PageNumber
+
+			for i := 0; i < 5; i++ {
+				handle, pn, err := p.GetNewPage(false)
+				if err != nil {
+					t.Fatalf("allocate failed: %v", err)
+				}
+
+				(*handle).(*pages.Page).Insert([]byte(fmt.Sprintf("old-%d", i)))
+				p.MarkDirty(pn)
+
+				numbers = append(numbers, pn)
+			}
+
+			if err := p.FlushAll(); err != nil {
+				t.Fatalf("flush failed: %v", err)
+			}
+
+			for i, pn := range numbers {
+				fr, _ := p.GetPage(pn, false)
+				fr.Page.(*pages.Page).Insert([]byte(fmt.Sprintf("new-%d", i)))
+				p.MarkDirty(pn)
+			}
+
+			// pages are written one at a time, the third one is torn
+			data.tear = data.writes + 3
+
+			if err := p.FlushAll(); !goerrors.Is(err, errCrash) {
+				t.Fatalf("expected the flush to crash, got %v", err)
+			}
+
+			p.Stop()
+
+			data.crashed = false
+
+			p, err = OpenFile(data, opts)
+			if err != nil {
+				t.Fatalf("open failed: %v", err)
+			}
+
+			defer p.Close()
+
+			torn := numbers[2]
+
+			_, err = p.GetPage(torn, false)
+			if !tt.doubleWrite {
+				if !goerrors.Is(err, errors.ErrPageCorrupted) {
+					t.Errorf("expected the torn page %d to be reported, got %v", torn, err)
+				}
+
+				return
+			}
+
+			for i, pn := range numbers {
+				fr, err := p.GetPage(pn, false)
+				if err != nil {
+					t.Fatalf("page %d not restored: %v", pn, err)
+				}
+
+				// pages after the torn one were never written
+				want := fmt.Sprintf("new-%d", i)
+				if i > 2 {
+					want = fmt.Sprintf("old-%d", i)
+				}
+
+				page := fr.Page.(*pages.Page)
+
+				if cell, err := page.Get(base.SlotID(page.NumSlots() - 1)); err != nil || string(cell) != want {
+					t.Errorf("expected page %d to end with %q, got %q, %v", pn, want, cell, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package pager
+
+import (
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/frame"
+	"github.com/dark-vinci/nildb/pages"
+	"github.com/dark-vinci/nildb/wal"
+)
+
+// diffGap merges changed ranges of a page closer than this many bytes
+const diffGap = 16
+
+// remember keeps the image of a page as it was loaded into fr, changes
+// are logged as the difference against it
+func (p *Pager) remember(fr *frame.Frame) {
+	if p.log == nil {
+		return
+	}
+
+	current := fr.Page.(*pages.Page).Bytes()
+
+	p.shadowLock.Lock()
+	defer p.shadowLock.Unlock()
+
+	shadow, ok := p.shadows[fr]
+
+	if !ok || len(shadow) != len(current) {
+		shadow = make([]byte, len(current))
+		p.shadows[fr] = shadow
+	}
+
+	copy(shadow, current)
+}
+
+// shadowOf returns the image of the page in fr as last logged
+func (p *Pager) shadowOf(fr *frame.Frame) ([]byte, bool) {
+	p.shadowLock.Lock()
+	defer p.shadowLock.Unlock()
+
+	shadow, ok := p.shadows[fr]
+
+	return shadow, ok
+}
+
+// logPage logs the changes made to a cached page since it was last logged.
+// Unless the caller holds its latch, a page latched for writing is being
+// changed and stays touched for the next logTouched.
+func (p *Pager) logPage(pn base.PageNumber, latched bool) error {
+	frameID := p.cache.Peek(pn)
+	if frameID == nil {
+		return nil
+	}
+
+	fr := p.cache.GetFrame(*frameID).(*frame.Frame)
+
+	if !latched {
+		if !fr.Latch.TryRLock() {
+			return nil
+		}
+
+		defer fr.Latch.RUnlock()
+	}
+
+	return p.logFrame(fr)
+}
+
+// logFrame appends an update record for the bytes of fr that differ from
+// its logged image, and stamps the frame with the record's LSN. The caller
+// holds the latch of fr so the page does not change while it is read.
+func (p *Pager) logFrame(fr *frame.Frame) error {
+	if p.log == nil {
+		return nil
+	}
+
+	shadow, ok := p.shadowOf(fr)
+	if !ok {
+		return nil
+	}
+
+	current := fr.Page.(*pages.Page).Bytes()
+
+	diffs := wal.Compare(shadow, current, diffGap)
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	lsn, err := p.log.Append(&wal.Record{
+		PrevLSN: p.txLast,
+		TxID:    p.tx,
+		Type:    wal.UpdateRecord,
+		Page:    fr.PageNumber,
+		Diffs:   diffs,
+	})
+	if err != nil {
+		return err
+	}
+
+	if p.tx != 0 {
+		p.txLast = lsn
+	}
+
+	fr.LSN = lsn
+
+	if fr.RecLSN == 0 {
+		fr.RecLSN = lsn
+	}
+
+	copy(shadow, current)
+
+	return nil
+}
+
+// logTouched logs every page marked dirty since the last call, a page
+// written back meanwhile was logged then. A dirty frame is not reused
+// before writeHeld logs it under the pager lock, the frames collected keep
+// their page. A page latched for writing is being changed, it stays
+// touched and is logged by a later call.
+func (p *Pager) logTouched() error {
+	var dirty []*frame.Frame
+
+	p.cache.EachFrame(func(f any) {
+		fr := f.(*frame.Frame)
+
+		if _, ok := p.touched[fr.PageNumber]; ok && fr.IsSet(constants.DirtyFlag) {
+			dirty = append(dirty, fr)
+		}
+	})
+
+	latched := make(map[base.PageNumber]struct{})
+
+	for _, fr := range dirty {
+		if !fr.Latch.TryRLock() {
+			latched[fr.PageNumber] = struct{}{}
+			continue
+		}
+
+		err := p.logFrame(fr)
+		fr.Latch.RUnlock()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	clear(p.touched)
+
+	for pn := range latched {
+		p.touched[pn] = struct{}{}
+	}
+
+	return nil
+}
+
+// Begin starts a transaction, the changes logged until Commit belong to it
+func (p *Pager) Begin() (uint64, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.log == nil {
+		return 0, errors.ErrNoLog
+	}
+
+	if p.tx != 0 {
+		return 0, errors.ErrTxActive
+	}
+
+	// earlier changes are not part of the transaction
+	if err := p.logTouched(); err != nil {
+		return 0, err
+	}
+
+	p.lastTxID++
+
+	lsn, err := p.log.Append(&wal.Record{TxID: p.lastTxID, Type: wal.BeginRecord})
+	if err != nil {
+		return 0, err
+	}
+
+	p.tx, p.txLast, p.txFirst = p.lastTxID, lsn, lsn
+
+	return p.tx, nil
+}
+
+// Commit logs the remaining changes of the transaction and returns once
+// its commit record is on disk. Concurrent commits share one log flush.
+func (p *Pager) Commit() error {
+	lsn, c, err := p.commit()
+	if err != nil {
+		return err
+	}
+
+	if err := p.log.Flush(lsn); err != nil {
+		return err
+	}
+
+	c.logGrew(p.log.Size())
+
+	return nil
+}
+
+// commit appends the commit record and returns the checkpointer to wake,
+// the pager lock is released before waiting for the flush
+func (p *Pager) commit() (base.LSN, *checkpointer, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.tx == 0 {
+		return 0, nil, errors.ErrNoTx
+	}
+
+	if err := p.logTouched(); err != nil {
+		return 0, nil, err
+	}
+
+	lsn, err := p.log.Append(&wal.Record{PrevLSN: p.txLast, TxID: p.tx, Type: wal.CommitRecord})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	p.tx, p.txLast, p.txFirst = 0, 0, 0
+
+	return lsn, p.checkpointer, nil
+}
@@ -0,0 +1,107 @@
+package pages
+
+import (
+	"hash/crc32"
+	"time"
+	"unsafe"
+
+	"github.com/dark-vinci/nildb/checksum"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Init writes a new database header with the parameters the file is created with
+func (p *PageZero) Init(pageSize, blockSize uint32, pageChecksum checksum.Algorithm) {
+	header := p.buffer.Header()
+	*header = DBHeader{}
+
+	copy(header.magic[:], constants.DatabaseMagic)
+	header.version = constants.FormatVersion
+	header.pageSize = pageSize
+	header.blockSize = blockSize
+	header.pageChecksum = pageChecksum
+	header.createdAt = time.Now().UnixNano()
+	header.totalPages = 1
+
+	p.seal()
+}
+
+// seal recomputes the header checksum, it must follow every header change
+func (p *PageZero) seal() {
+	p.buffer.Header().checksum = p.computeChecksum()
+}
+
+func (p *PageZero) computeChecksum() uint32 {
+	var (
+		header DBHeader
+		size   = unsafe.Offsetof(header.checksum)
+	)
+
+	// the page checksum in front changes with every write, it is not part of the header
+	return crc32.Checksum(p.buffer.AsSlice()[checksum.HeaderSize:size], castagnoli)
+}
+
+// Validate checks the header was written by nildb, is intact and matches
+// the page and block sizes the database is opened with
+func (p *PageZero) Validate(pageSize, blockSize uint32) error {
+	header := p.buffer.Header()
+
+	if string(header.magic[:]) != constants.DatabaseMagic {
+		return errors.ErrNotADatabase
+	}
+
+	if header.checksum != p.computeChecksum() {
+		return errors.ErrCorruptedHeader
+	}
+
+	if header.version != constants.FormatVersion {
+		return &errors.HeaderMismatchError{
+			Field:    "version",
+			Expected: constants.FormatVersion,
+			Found:    uint64(header.version),
+		}
+	}
+
+	if header.pageSize != pageSize {
+		return &errors.HeaderMismatchError{
+			Field:    "page size",
+			Expected: uint64(pageSize),
+			Found:    uint64(header.pageSize),
+		}
+	}
+
+	if header.blockSize != blockSize {
+		return &errors.HeaderMismatchError{
+			Field:    "block size",
+			Expected: uint64(blockSize),
+			Found:    uint64(header.blockSize),
+		}
+	}
+
+	return nil
+}
+
+func (p *PageZero) Version() uint16 {
+	return p.buffer.Header().version
+}
+
+// PageSize returns the page size the database was created with
+func (p *PageZero) PageSize() uint32 {
+	return p.buffer.Header().pageSize
+}
+
+// PageChecksum returns the algorithm every page of the database is checksummed with
+func (p *PageZero) PageChecksum() checksum.Algorithm {
+	return p.buffer.Header().pageChecksum
+}
+
+// BlockSize returns the block size the database was created with
+func (p *PageZero) BlockSize() uint32 {
+	return p.buffer.Header().blockSize
+}
+
+func (p *PageZero) CreatedAt() time.Time {
+	return time.Unix(0, p.buffer.Header().createdAt)
+}
@@ -0,0 +1,127 @@
+package pages
+
+import (
+	stderrors "errors"
+	"testing"
+
+	"github.com/dark-vinci/nildb/checksum"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+)
+
+func newTestPageZero(t *testing.T) *PageZero {
+	t.Helper()
+
+	zero, ok := PageZeroFrom(Alloc(constants.DefaultPageSize))
+	if !ok {
+		t.Fatalf("expected a page to be usable as page zero")
+	}
+
+	zero.Init(constants.DefaultPageSize, constants.DefaultPageSize, checksum.CRC32C)
+
+	return zero
+}
+
+// TestHeaderValidate verifies Validate refuses foreign, corrupted and mismatched headers
+func TestHeaderValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(*PageZero)
+		pageSize uint32
+		expected error
+	}{
+		{
+			name:     "Valid header",
+			modify:   func(*PageZero) {},
+			pageSize: constants.DefaultPageSize,
+		},
+		{
+			name: "Wrong magic",
+			modify: func(p *PageZero) {
+				copy(p.buffer.Header().magic[:], "sqlite")
+			},
+			pageSize: constants.DefaultPageSize,
+			expected: errors.ErrNotADatabase,
+		},
+		{
+			name: "Flipped byte",
+			modify: func(p *PageZero) {
+				p.buffer.Header().createdAt ^= 0x10
+			},
+			pageSize: constants.DefaultPageSize,
+			expected: errors.ErrCorruptedHeader,
+		},
+		{
+			name: "Page checksum written",
+			modify: func(p *PageZero) {
+				checksum.Seal(p.buffer.AsSlice(), checksum.CRC32C)
+			},
+			pageSize: constants.DefaultPageSize,
+		},
+		{
+			name: "Free list changes keep the checksum valid",
+			modify: func(p *PageZero) {
+				p.SetFreeListHead(7)
+				p.SetFreePages(3)
+				p.SetTotalPages(10)
+			},
+			pageSize: constants.DefaultPageSize,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zero := newTestPageZero(t)
+			tt.modify(zero)
+
+			if err := zero.Validate(tt.pageSize, constants.DefaultPageSize); err != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestHeaderMismatch verifies page and block size mismatches are reported
+// with both sizes
+func TestHeaderMismatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		pageSize  uint32
+		blockSize uint32
+		field     string
+		expected  uint64
+	}{
+		{name: "Page size", pageSize: 8192, blockSize: constants.DefaultPageSize, field: "page size", expected: 8192},
+		{name: "Block size", pageSize: constants.DefaultPageSize, blockSize: 16384, field: "block size", expected: 16384},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zero := newTestPageZero(t)
+
+			err := zero.Validate(tt.pageSize, tt.blockSize)
+
+			var mismatch *errors.HeaderMismatchError
+			if !stderrors.As(err, &mismatch) {
+				t.Fatalf("expected HeaderMismatchError, got %v", err)
+			}
+
+			if mismatch.Field != tt.field || mismatch.Expected != tt.expected || mismatch.Found != constants.DefaultPageSize {
+				t.Errorf("unexpected mismatch %+v", mismatch)
+			}
+
+			if zero.PageSize() != constants.DefaultPageSize || zero.Version() != constants.FormatVersion {
+				t.Errorf("expected creation parameters to be kept, got %d/%d", zero.PageSize(), zero.Version())
+			}
+		})
+	}
+}
+
+// TestHeaderEmptyFile verifies a zeroed page is not taken for a database
+func TestHeaderEmptyFile(t *testing.T) {
+	zero, _ := PageZeroFrom(Alloc(constants.DefaultPageSize))
+
+	if err := zero.Validate(constants.DefaultPageSize, constants.DefaultPageSize); err != errors.ErrNotADatabase {
+		t.Errorf("expected ErrNotADatabase, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package pages
+
+import (
+	"encoding/binary"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/bufferwheader"
+	"github.com/dark-vinci/nildb/checksum"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/interfaces"
+)
+
+// FreeListHeader starts a free list trunk page, the content holds the page
+// numbers of the free leaf pages the trunk keeps track of
+type FreeListHeader struct {
+	_     [checksum.HeaderSize]byte
+	next  uint64 // next trunk page, zero on the last trunk
+	count uint32 // leaf page numbers stored in the content
+	_     uint32
+}
+
+type FreeListPage struct {
+	buffer *bufferwheader.BufferWithHeader[FreeListHeader]
+}
+
+var _ faces.PageHandle = (*FreeListPage)(nil)
+
+// FreeListFrom views the bytes of a page as a free list trunk page
+func FreeListFrom(handle faces.PageHandle) (*FreeListPage, bool) {
+	switch v := handle.(type) {
+	case *FreeListPage:
+		return v, true
+	case *Page:
+		return &FreeListPage{buffer: bufferwheader.Cast[PageHeader, FreeListHeader](v.buffer)}, true
+	default:
+		return nil, false
+	}
+}
+
+func (f *FreeListPage) IsOverflow() bool {
+	return false
+}
+
+func (f *FreeListPage) FromBuffer(buffer []byte) faces.PageHandle {
+	f.buffer = bufferwheader.FromSlice[FreeListHeader](buffer)
+
+	return f
+}
+
+func (f *FreeListPage) IntoBuffer() (interface{}, error) {
+	return f.buffer, nil
+}
+
+func (f *FreeListPage) Type() string {
+	return constants.FreeListPage
+}
+
+// Reset turns the page into an empty trunk
+func (f *FreeListPage) Reset() {
+	*f.buffer.Header() = FreeListHeader{}
+}
+
+func (f *FreeListPage) Next() base.PageNumber {
+	return base.PageNumber(f.buffer.Header().next)
+}
+
+func (f *FreeListPage) SetNext(pn base.PageNumber) {
+	f.buffer.Header().next = uint64(pn)
+}
+
+// Len returns the number of leaf pages in the trunk
+func (f *FreeListPage) Len() int {
+	return int(f.buffer.Header().count)
+}
+
+// Capacity returns the number of leaf pages a trunk can hold
+func (f *FreeListPage) Capacity() int {
+	return len(f.buffer.Content()) / 8
+}
+
+// Push adds a leaf page, the caller checks Len against Capacity first
+func (f *FreeListPage) Push(pn base.PageNumber) {
+	header := f.buffer.Header()
+
+	binary.LittleEndian.PutUint64(f.buffer.Content()[header.count*8:], uint64(pn))
+	header.count++
+}
+
+// Contains reports whether pn is one of the leaf pages of the trunk
+func (f *FreeListPage) Contains(pn base.PageNumber) bool {
+	content := f.buffer.Content()
+
+	for i := range f.Len() {
+		if base.PageNumber(binary.LittleEndian.Uint64(content[i*8:])) == pn {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Pop removes the last leaf page added
+func (f *FreeListPage) Pop() base.PageNumber {
+	header := f.buffer.Header()
+	header.count--
+
+	return base.PageNumber(binary.LittleEndian.Uint64(f.buffer.Content()[header.count*8:]))
+}
@@ -0,0 +1,44 @@
+package pages
+
+import "github.com/dark-vinci/nildb/base"
+
+const leafFlag = 0x01
+
+// IsLeaf reports whether the page is a B+TREE leaf
+func (p *Page) IsLeaf() bool {
+	return p.buffer.Header().flags&leafFlag != 0
+}
+
+// SetLeaf marks the page as a B+TREE leaf or internal node
+func (p *Page) SetLeaf(leaf bool) {
+	if leaf {
+		p.buffer.Header().flags |= leafFlag
+		return
+	}
+
+	p.buffer.Header().flags &^= leafFlag
+}
+
+// Right returns the next leaf, or the right-most child of an internal node.
+// Page zero is never a node, so zero means there is none.
+func (p *Page) Right() base.PageNumber {
+	return base.PageNumber(p.buffer.Header().right)
+}
+
+func (p *Page) SetRight(pn base.PageNumber) {
+	p.buffer.Header().right = uint64(pn)
+}
+
+// Left returns the previous leaf, zero if there is none
+func (p *Page) Left() base.PageNumber {
+	return base.PageNumber(p.buffer.Header().left)
+}
+
+func (p *Page) SetLeft(pn base.PageNumber) {
+	p.buffer.Header().left = uint64(pn)
+}
+
+// CopyFrom overwrites the page, header included, with the contents of src
+func (p *Page) CopyFrom(src *Page) {
+	copy(p.buffer.AsSlice(), src.buffer.AsSlice())
+}
@@ -1,13 +1,20 @@
 package pages
 
 import (
+	"github.com/dark-vinci/nildb/base"
 	"github.com/dark-vinci/nildb/bufferwheader"
+	"github.com/dark-vinci/nildb/checksum"
 	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
 	"github.com/dark-vinci/nildb/interfaces"
 )
 
 type OverflowPageHeader struct {
-	offset uint64
+	_      [checksum.HeaderSize]byte
+	offset uint64 // position of this page's chunk in the whole payload
+	next   uint64 // next page of the chain, zero on the last page
+	length uint32 // payload bytes stored in this page
+	_      uint32
 }
 
 type OverflowPage struct {
@@ -49,3 +56,64 @@ func (o *OverflowPage) FromDBHeader(buffer *bufferwheader.BufferWithHeader[DBHea
 func (o *OverflowPage) Type() string {
 	return constants.OverFlowPage
 }
+
+// OverflowFrom views the bytes of a page as an overflow page. The contents
+// are kept, so it works both for new pages and for chains read from disk.
+func OverflowFrom(handle faces.PageHandle) (*OverflowPage, bool) {
+	switch v := handle.(type) {
+	case *OverflowPage:
+		return v, true
+	case *Page:
+		return &OverflowPage{buffer: bufferwheader.Cast[PageHeader, OverflowPageHeader](v.buffer)}, true
+	default:
+		return nil, false
+	}
+}
+
+// Reset clears the header, leaving an empty last page of a chain
+func (o *OverflowPage) Reset() {
+	*o.buffer.Header() = OverflowPageHeader{}
+}
+
+func (o *OverflowPage) Offset() uint64 {
+	return o.buffer.Header().offset
+}
+
+func (o *OverflowPage) SetOffset(offset uint64) {
+	o.buffer.Header().offset = offset
+}
+
+// Next returns the following page of the chain, zero on the last page
+func (o *OverflowPage) Next() base.PageNumber {
+	return base.PageNumber(o.buffer.Header().next)
+}
+
+func (o *OverflowPage) SetNext(pn base.PageNumber) {
+	o.buffer.Header().next = uint64(pn)
+}
+
+// Data returns the payload chunk stored in the page, a length past the
+// chunk area is ErrCorruptedOverflow
+func (o *OverflowPage) Data() ([]byte, error) {
+	length := o.buffer.Header().length
+
+	if int(length) > len(o.buffer.Content()) {
+		return nil, errors.ErrCorruptedOverflow
+	}
+
+	return o.buffer.Content()[:length], nil
+}
+
+// Content returns the whole chunk area of the page, SetLength records how much of it is used
+func (o *OverflowPage) Content() []byte {
+	return o.buffer.Content()
+}
+
+func (o *OverflowPage) SetLength(length int) {
+	o.buffer.Header().length = uint32(length)
+}
+
+// Capacity is the largest chunk a single overflow page can hold
+func (o *OverflowPage) Capacity() int {
+	return len(o.buffer.Content())
+}
@@ -2,12 +2,24 @@ package pages
 
 import (
 	"github.com/dark-vinci/nildb/bufferwheader"
+	"github.com/dark-vinci/nildb/checksum"
 	"github.com/dark-vinci/nildb/constants"
 	"github.com/dark-vinci/nildb/interfaces"
 )
 
+// PageHeader sits at the start of every slotted page. Offsets are relative
+// to the content area, the slot directory grows from offset 0 and cells grow
+// from the end of the content towards it.
 type PageHeader struct {
-	id uint32
+	_              [checksum.HeaderSize]byte
+	id             uint32
+	numSlots       uint16 // entries in the slot directory, including tombstones
+	lastUsedOffset uint16 // start of the cell area
+	freeSpace      uint16 // free bytes, including fragments left by deleted cells
+	flags          uint16
+	_              uint32
+	right          uint64 // next leaf, or the right-most child of an internal node
+	left           uint64 // previous leaf
 }
 
 // Page B+TREE PAGE
@@ -31,6 +43,11 @@ func (p *Page) IntoBuffer() (interface{}, error) {
 	return p.buffer, nil
 }
 
+// Bytes returns the whole page as it is stored on disk, header included
+func (p *Page) Bytes() []byte {
+	return p.buffer.AsSlice()
+}
+
 func (p *Page) FromPageHeader(header *bufferwheader.BufferWithHeader[PageHeader]) faces.PageHandle {
 	return &Page{buffer: header}
 }
@@ -1,13 +1,28 @@
 package pages
 
 import (
+	"github.com/dark-vinci/nildb/base"
 	"github.com/dark-vinci/nildb/bufferwheader"
+	"github.com/dark-vinci/nildb/checksum"
 	"github.com/dark-vinci/nildb/constants"
 	"github.com/dark-vinci/nildb/interfaces"
 )
 
 type DBHeader struct {
-	version uint16
+	_            [checksum.HeaderSize]byte
+	magic        [8]byte
+	version      uint16
+	pageChecksum checksum.Algorithm // how every page is checksummed
+	_            uint8
+	pageSize     uint32
+	blockSize    uint32
+	_            uint32
+	createdAt    int64  // unix nanoseconds
+	freeListHead uint64 // first trunk page of the free list, zero when empty
+	freePages    uint64 // pages on the free list, trunks included
+	totalPages   uint64 // pages in the file, page zero included
+	checksum     uint32 // crc32c of every header field before it
+	_            uint32
 }
 
 type PageZero struct {
@@ -55,3 +70,43 @@ func (p *PageZero) FromDBHeader(buffer *bufferwheader.BufferWithHeader[DBHeader]
 func (p *PageZero) Type() string {
 	return constants.PageZero
 }
+
+// PageZeroFrom views the bytes of a page as the database header page
+func PageZeroFrom(handle faces.PageHandle) (*PageZero, bool) {
+	switch v := handle.(type) {
+	case *PageZero:
+		return v, true
+	case *Page:
+		return &PageZero{buffer: bufferwheader.Cast[PageHeader, DBHeader](v.buffer)}, true
+	default:
+		return nil, false
+	}
+}
+
+func (p *PageZero) FreeListHead() base.PageNumber {
+	return base.PageNumber(p.buffer.Header().freeListHead)
+}
+
+func (p *PageZero) SetFreeListHead(pn base.PageNumber) {
+	p.buffer.Header().freeListHead = uint64(pn)
+	p.seal()
+}
+
+func (p *PageZero) FreePages() uint64 {
+	return p.buffer.Header().freePages
+}
+
+func (p *PageZero) SetFreePages(count uint64) {
+	p.buffer.Header().freePages = count
+	p.seal()
+}
+
+// TotalPages is the high-water mark of the file, a new database only has page zero
+func (p *PageZero) TotalPages() uint64 {
+	return max(p.buffer.Header().totalPages, 1)
+}
+
+func (p *PageZero) SetTotalPages(count uint64) {
+	p.buffer.Header().totalPages = count
+	p.seal()
+}
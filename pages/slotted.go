@@ -0,0 +1,381 @@
+package pages
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+)
+
+// SlotSize is the size of one slot directory entry: cell offset and cell length
+const SlotSize = 4
+
+// slot points at a cell in the content area; a zero offset marks a deleted slot
+type slot struct {
+	offset uint16
+	length uint16
+}
+
+func align(size int) int {
+	return (size + constants.CellAlignment - 1) &^ (constants.CellAlignment - 1)
+}
+
+func (s slot) isDeleted() bool {
+	return s.offset == 0
+}
+
+// ensureInit lays out the header of an empty page, pages coming from
+// Alloc or from zeroed disk blocks do not have their offsets set yet.
+func (p *Page) ensureInit() {
+	header := p.buffer.Header()
+
+	if header.numSlots != 0 {
+		return
+	}
+
+	header.lastUsedOffset = uint16(len(p.buffer.Content()))
+	header.freeSpace = header.lastUsedOffset
+}
+
+func (p *Page) slotAt(id base.SlotID) slot {
+	var (
+		content = p.buffer.Content()
+		at      = int(id) * SlotSize
+	)
+
+	return slot{
+		offset: binary.LittleEndian.Uint16(content[at:]),
+		length: binary.LittleEndian.Uint16(content[at+2:]),
+	}
+}
+
+func (p *Page) setSlot(id base.SlotID, s slot) {
+	var (
+		content = p.buffer.Content()
+		at      = int(id) * SlotSize
+	)
+
+	binary.LittleEndian.PutUint16(content[at:], s.offset)
+	binary.LittleEndian.PutUint16(content[at+2:], s.length)
+}
+
+// contiguousFree is the gap between the slot directory and the cell area
+func (p *Page) contiguousFree() int {
+	header := p.buffer.Header()
+
+	return int(header.lastUsedOffset) - int(header.numSlots)*SlotSize
+}
+
+// NumSlots returns the number of entries in the slot directory
+func (p *Page) NumSlots() uint16 {
+	return p.buffer.Header().numSlots
+}
+
+// FreeSpace returns the bytes that can still be used for cells and slots
+func (p *Page) FreeSpace() uint16 {
+	if p.buffer.Header().numSlots == 0 {
+		return uint16(len(p.buffer.Content()))
+	}
+
+	return p.buffer.Header().freeSpace
+}
+
+// MaxCellSize is the largest cell that fits in an otherwise empty page
+func (p *Page) MaxCellSize() int {
+	return (len(p.buffer.Content()) - SlotSize) &^ (constants.CellAlignment - 1)
+}
+
+// CanFit reports whether a cell of the given size can be inserted, possibly after compaction
+func (p *Page) CanFit(size int) bool {
+	return align(size)+SlotSize <= int(p.FreeSpace())
+}
+
+// allocate reserves an aligned region for size bytes at the end of the free gap
+func (p *Page) allocate(size int) (uint16, error) {
+	var (
+		header = p.buffer.Header()
+		needed = align(size)
+	)
+
+	if needed > int(header.freeSpace) {
+		return 0, errors.ErrPageFull
+	}
+
+	if needed > p.contiguousFree() {
+		p.Compact()
+	}
+
+	header.lastUsedOffset -= uint16(needed)
+	header.freeSpace -= uint16(needed)
+
+	return header.lastUsedOffset, nil
+}
+
+// release gives the space of a cell back to the page
+func (p *Page) release(s slot) {
+	header := p.buffer.Header()
+
+	header.freeSpace += uint16(align(int(s.length)))
+
+	if s.offset == header.lastUsedOffset {
+		header.lastUsedOffset += uint16(align(int(s.length)))
+	}
+}
+
+// Insert stores the cell in the page and returns its slot.
+// Deleted slots are reused before the slot directory is grown.
+func (p *Page) Insert(cell []byte) (base.SlotID, error) {
+	if len(cell) > p.MaxCellSize() {
+		return 0, errors.ErrCellTooLarge
+	}
+
+	p.ensureInit()
+
+	var (
+		header = p.buffer.Header()
+		id     = base.SlotID(header.numSlots)
+	)
+
+	for i := base.SlotID(0); i < base.SlotID(header.numSlots); i++ {
+		if p.slotAt(i).isDeleted() {
+			id = i
+			break
+		}
+	}
+
+	grow := id == base.SlotID(header.numSlots)
+
+	if grow {
+		if align(len(cell))+SlotSize > int(header.freeSpace) {
+			return 0, errors.ErrPageFull
+		}
+
+		// reserve the slot first, so compaction keeps the gap for it
+		header.freeSpace -= SlotSize
+		if p.contiguousFree() < SlotSize+align(len(cell)) {
+			p.Compact()
+		}
+
+		header.numSlots++
+		p.setSlot(id, slot{})
+	}
+
+	offset, err := p.allocate(len(cell))
+	if err != nil {
+		if grow {
+			header.numSlots--
+			header.freeSpace += SlotSize
+		}
+
+		return 0, err
+	}
+
+	copy(p.buffer.Content()[offset:], cell)
+	p.setSlot(id, slot{offset: offset, length: uint16(len(cell))})
+
+	return id, nil
+}
+
+// Get returns the cell stored in the slot. The returned slice aliases the
+// page, it is only valid until the page is modified again.
+func (p *Page) Get(id base.SlotID) ([]byte, error) {
+	if id >= base.SlotID(p.NumSlots()) {
+		return nil, errors.ErrInvalidSlot
+	}
+
+	s := p.slotAt(id)
+	if s.isDeleted() {
+		return nil, errors.ErrInvalidSlot
+	}
+
+	return p.buffer.Content()[s.offset : s.offset+s.length], nil
+}
+
+// Update replaces the cell in the slot, keeping its slot id
+func (p *Page) Update(id base.SlotID, cell []byte) error {
+	if id >= base.SlotID(p.NumSlots()) {
+		return errors.ErrInvalidSlot
+	}
+
+	old := p.slotAt(id)
+	if old.isDeleted() {
+		return errors.ErrInvalidSlot
+	}
+
+	header := p.buffer.Header()
+
+	// shrinking or same sized cells are rewritten in place
+	if align(len(cell)) <= align(int(old.length)) {
+		copy(p.buffer.Content()[old.offset:], cell)
+
+		header.freeSpace += uint16(align(int(old.length)) - align(len(cell)))
+		p.setSlot(id, slot{offset: old.offset, length: uint16(len(cell))})
+
+		return nil
+	}
+
+	if align(len(cell)) > int(header.freeSpace)+align(int(old.length)) {
+		return errors.ErrPageFull
+	}
+
+	p.release(old)
+	p.setSlot(id, slot{})
+
+	offset, err := p.allocate(len(cell))
+	if err != nil {
+		return err
+	}
+
+	copy(p.buffer.Content()[offset:], cell)
+	p.setSlot(id, slot{offset: offset, length: uint16(len(cell))})
+
+	return nil
+}
+
+// Delete removes the cell in the slot. The slot id stays reserved as a
+// tombstone, unless it is at the end of the slot directory.
+func (p *Page) Delete(id base.SlotID) error {
+	if id >= base.SlotID(p.NumSlots()) {
+		return errors.ErrInvalidSlot
+	}
+
+	s := p.slotAt(id)
+	if s.isDeleted() {
+		return errors.ErrInvalidSlot
+	}
+
+	p.release(s)
+	p.setSlot(id, slot{})
+	p.trimSlots()
+
+	return nil
+}
+
+// trimSlots drops tombstones from the end of the slot directory
+func (p *Page) trimSlots() {
+	header := p.buffer.Header()
+
+	for header.numSlots > 0 && p.slotAt(base.SlotID(header.numSlots-1)).isDeleted() {
+		header.numSlots--
+		header.freeSpace += SlotSize
+	}
+}
+
+// Compact moves every live cell to the end of the page so all the free
+// space is in one gap between the slot directory and the cell area.
+func (p *Page) Compact() {
+	var (
+		header  = p.buffer.Header()
+		content = p.buffer.Content()
+		ids     = make([]base.SlotID, 0, header.numSlots)
+	)
+
+	for i := base.SlotID(0); i < base.SlotID(header.numSlots); i++ {
+		if !p.slotAt(i).isDeleted() {
+			ids = append(ids, i)
+		}
+	}
+
+	// cells are moved starting with the one closest to the end, so a cell
+	// is never overwritten before it has been moved
+	sort.Slice(ids, func(i, j int) bool {
+		return p.slotAt(ids[i]).offset > p.slotAt(ids[j]).offset
+	})
+
+	end := len(content)
+
+	for _, id := range ids {
+		s := p.slotAt(id)
+		end -= align(int(s.length))
+
+		copy(content[end:], content[s.offset:s.offset+s.length])
+		p.setSlot(id, slot{offset: uint16(end), length: s.length})
+	}
+
+	header.lastUsedOffset = uint16(end)
+}
+
+// InsertAt stores the cell at position index of the slot directory, shifting
+// the following slots up by one. Used by pages that keep their cells ordered.
+func (p *Page) InsertAt(index base.SlotID, cell []byte) error {
+	if len(cell) > p.MaxCellSize() {
+		return errors.ErrCellTooLarge
+	}
+
+	p.ensureInit()
+
+	header := p.buffer.Header()
+
+	if index > base.SlotID(header.numSlots) {
+		return errors.ErrInvalidSlot
+	}
+
+	if align(len(cell))+SlotSize > int(header.freeSpace) {
+		return errors.ErrPageFull
+	}
+
+	if p.contiguousFree() < SlotSize+align(len(cell)) {
+		p.Compact()
+	}
+
+	header.freeSpace -= SlotSize
+
+	offset, err := p.allocate(len(cell))
+	if err != nil {
+		header.freeSpace += SlotSize
+		return err
+	}
+
+	copy(p.buffer.Content()[offset:], cell)
+
+	content := p.buffer.Content()
+	at := int(index) * SlotSize
+	end := int(header.numSlots) * SlotSize
+
+	copy(content[at+SlotSize:end+SlotSize], content[at:end])
+	header.numSlots++
+
+	p.setSlot(index, slot{offset: offset, length: uint16(len(cell))})
+
+	return nil
+}
+
+// RemoveAt removes the cell at position index, shifting the following slots
+// down by one
+func (p *Page) RemoveAt(index base.SlotID) error {
+	header := p.buffer.Header()
+
+	if index >= base.SlotID(header.numSlots) {
+		return errors.ErrInvalidSlot
+	}
+
+	p.release(p.slotAt(index))
+
+	content := p.buffer.Content()
+	at := int(index) * SlotSize
+	end := int(header.numSlots) * SlotSize
+
+	copy(content[at:end-SlotSize], content[at+SlotSize:end])
+	header.numSlots--
+	header.freeSpace += SlotSize
+
+	return nil
+}
+
+// Reset drops every cell and slot, leaving an empty page
+func (p *Page) Reset() {
+	p.buffer.Header().numSlots = 0
+	p.ensureInit()
+}
+
+// CellSize is the space a cell of the given length takes in a page, slot included
+func CellSize(length int) int {
+	return align(length) + SlotSize
+}
+
+// Capacity is the space of an empty page available for cells and slots
+func (p *Page) Capacity() int {
+	return len(p.buffer.Content())
+}
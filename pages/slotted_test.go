@@ -0,0 +1,246 @@
+package pages
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+)
+
+func newTestPage(t *testing.T) *Page {
+	t.Helper()
+
+	return Alloc(constants.DefaultPageSize).(*Page)
+}
+
+// TestSlottedInsertAndGet verifies cells can be read back through their slot
+func TestSlottedInsertAndGet(t *testing.T) {
+	tests := []struct {
+		name  string
+		cells [][]byte
+	}{
+		{
+			name:  "Single cell",
+			cells: [][]byte{[]byte("hello")},
+		},
+		{
+			name:  "Many cells of different sizes",
+			cells: [][]byte{[]byte("a"), []byte("bbbbbbbbb"), []byte("cccccccccccccccc"), {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPage(t)
+			ids := make([]base.SlotID, 0, len(tt.cells))
+
+			for _, cell := range tt.cells {
+				id, err := p.Insert(cell)
+				if err != nil {
+					t.Fatalf("insert failed: %v", err)
+				}
+
+				ids = append(ids, id)
+			}
+
+			for i, id := range ids {
+				got, err := p.Get(id)
+				if err != nil {
+					t.Fatalf("get failed: %v", err)
+				}
+
+				if !bytes.Equal(got, tt.cells[i]) {
+					t.Errorf("expected %q, got %q", tt.cells[i], got)
+				}
+
+				s := p.slotAt(id)
+				if int(s.offset)%constants.CellAlignment != 0 {
+					t.Errorf("expected cell offset aligned to %d, got %d", constants.CellAlignment, s.offset)
+				}
+			}
+		})
+	}
+}
+
+// TestSlottedFreeSpace verifies free space accounting across operations
+func TestSlottedFreeSpace(t *testing.T) {
+	p := newTestPage(t)
+	empty := int(p.FreeSpace())
+
+	if empty != len(p.buffer.Content()) {
+		t.Fatalf("expected %d free bytes on an empty page, got %d", len(p.buffer.Content()), empty)
+	}
+
+	id, err := p.Insert([]byte("abc"))
+	if err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	if got := int(p.FreeSpace()); got != empty-SlotSize-constants.CellAlignment {
+		t.Errorf("expected %d free bytes, got %d", empty-SlotSize-constants.CellAlignment, got)
+	}
+
+	if err := p.Delete(id); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	if got := int(p.FreeSpace()); got != empty {
+		t.Errorf("expected page to be empty again with %d free bytes, got %d", empty, got)
+	}
+}
+
+// TestSlottedDelete verifies deleted slots become tombstones and are reused
+func TestSlottedDelete(t *testing.T) {
+	p := newTestPage(t)
+
+	for _, cell := range []string{"one", "two", "three"} {
+		if _, err := p.Insert([]byte(cell)); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+
+	if err := p.Delete(1); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	if _, err := p.Get(1); err != errors.ErrInvalidSlot {
+		t.Errorf("expected ErrInvalidSlot, got %v", err)
+	}
+
+	if err := p.Delete(1); err != errors.ErrInvalidSlot {
+		t.Errorf("expected ErrInvalidSlot on double delete, got %v", err)
+	}
+
+	if p.NumSlots() != 3 {
+		t.Errorf("expected tombstone to keep 3 slots, got %d", p.NumSlots())
+	}
+
+	id, err := p.Insert([]byte("four"))
+	if err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	if id != 1 {
+		t.Errorf("expected deleted slot 1 to be reused, got %d", id)
+	}
+
+	if err := p.Delete(2); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	if p.NumSlots() != 2 {
+		t.Errorf("expected trailing tombstone to be trimmed, got %d slots", p.NumSlots())
+	}
+}
+
+// TestSlottedUpdate verifies cells can grow and shrink in place
+func TestSlottedUpdate(t *testing.T) {
+	p := newTestPage(t)
+
+	id, err := p.Insert([]byte("short"))
+	if err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	other, err := p.Insert([]byte("other"))
+	if err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cell []byte
+	}{
+		{name: "Grow", cell: bytes.Repeat([]byte("x"), 100)},
+		{name: "Shrink", cell: []byte("s")},
+		{name: "Empty", cell: []byte{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Update(id, tt.cell); err != nil {
+				t.Fatalf("update failed: %v", err)
+			}
+
+			got, _ := p.Get(id)
+			if !bytes.Equal(got, tt.cell) {
+				t.Errorf("expected %q, got %q", tt.cell, got)
+			}
+
+			got, _ = p.Get(other)
+			if string(got) != "other" {
+				t.Errorf("expected neighbour cell to be untouched, got %q", got)
+			}
+		})
+	}
+
+	if err := p.Update(42, []byte("x")); err != errors.ErrInvalidSlot {
+		t.Errorf("expected ErrInvalidSlot, got %v", err)
+	}
+}
+
+// TestSlottedCompaction verifies fragmented space is reclaimed when a page fills up
+func TestSlottedCompaction(t *testing.T) {
+	p := newTestPage(t)
+	cell := bytes.Repeat([]byte("c"), 200)
+
+	var ids []base.SlotID
+	for p.CanFit(len(cell)) {
+		id, err := p.Insert(cell)
+		if err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if _, err := p.Insert(cell); err != errors.ErrPageFull {
+		t.Fatalf("expected ErrPageFull, got %v", err)
+	}
+
+	// free every other cell, leaving holes between live cells
+	for i := 0; i < len(ids); i += 2 {
+		if err := p.Delete(ids[i]); err != nil {
+			t.Fatalf("delete failed: %v", err)
+		}
+	}
+
+	big := bytes.Repeat([]byte("b"), 600)
+	id, err := p.Insert(big)
+	if err != nil {
+		t.Fatalf("expected insert to succeed after compaction, got %v", err)
+	}
+
+	got, _ := p.Get(id)
+	if !bytes.Equal(got, big) {
+		t.Errorf("big cell corrupted after compaction")
+	}
+
+	for i := 1; i < len(ids); i += 2 {
+		got, err := p.Get(ids[i])
+		if err != nil || !bytes.Equal(got, cell) {
+			t.Errorf("cell in slot %d corrupted after compaction", ids[i])
+		}
+	}
+
+	p.Compact()
+
+	if p.contiguousFree() != int(p.FreeSpace()) {
+		t.Errorf("expected all free space to be contiguous after Compact")
+	}
+}
+
+// TestSlottedTooLarge verifies cells bigger than a page are refused
+func TestSlottedTooLarge(t *testing.T) {
+	p := newTestPage(t)
+
+	if _, err := p.Insert(make([]byte, p.MaxCellSize()+1)); err != errors.ErrCellTooLarge {
+		t.Errorf("expected ErrCellTooLarge, got %v", err)
+	}
+
+	if _, err := p.Insert(make([]byte, p.MaxCellSize())); err != nil {
+		t.Errorf("expected max sized cell to fit, got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+package utils
+
+import "unsafe"
+
+// AlignedBuffer returns a zeroed buffer of size bytes starting at a
+// multiple of alignment, direct I/O can use it without a bounce copy
+func AlignedBuffer(size, alignment int) []byte {
+	buf := make([]byte, size+alignment)
+
+	skip := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) % uintptr(alignment)); rem != 0 {
+		skip = alignment - rem
+	}
+
+	return buf[skip : skip+size : skip+size]
+}
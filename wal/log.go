@@ -0,0 +1,476 @@
+// Package wal implements the write-ahead log. Records are appended to an
+// in-memory tail and reach the disk when someone waits for them, several
+// waiters share a single write and sync (group commit). The log is split
+// in segments so the part recovery no longer needs can be dropped.
+package wal
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/constants"
+	"github.com/dark-vinci/nildb/errors"
+	"github.com/dark-vinci/nildb/interfaces"
+)
+
+const (
+	headerSize = 32
+	// maxRecordSize bounds the length read from a possibly torn frame
+	maxRecordSize = 1 << 24
+)
+
+// segment is one file of the log, it holds the records from base onwards
+type segment struct {
+	base base.LSN
+	file faces.IOOperator
+}
+
+// Log is an append-only log kept in a Store. An LSN is the position of a
+// record in the log, LSNs only grow and survive segment removal.
+type Log struct {
+	store       Store
+	ioLock      sync.Mutex // guards segments, files are used through seek + read/write pairs
+	segments    []*segment
+	segmentSize int64
+
+	lock       sync.Mutex
+	flushDone  *sync.Cond
+	first      base.LSN // first LSN still kept
+	next       base.LSN // LSN of the next appended record
+	flushed    base.LSN // every record starting below it is durable
+	pending    []byte   // records appended since pendingLSN, not written yet
+	pendingLSN base.LSN
+	flushing   bool
+	err        error // first write error, the log refuses work after it
+	lastTxID   uint64
+}
+
+func newLog(store Store, start base.LSN) *Log {
+	l := &Log{
+		store:       store,
+		segmentSize: constants.DefaultLogSegmentSize,
+		first:       start,
+		next:        start,
+		flushed:     start,
+		pendingLSN:  start,
+	}
+
+	l.flushDone = sync.NewCond(&l.lock)
+
+	return l
+}
+
+// Create starts a new empty log in store, dropping the segments it held
+func Create(store Store) (*Log, error) {
+	ids, err := store.Segments()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if err := store.Remove(id); err != nil {
+			return nil, err
+		}
+	}
+
+	l := newLog(store, 1)
+
+	if err := l.addSegment(1); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Open reads the log kept in store, an empty store becomes a new log. The
+// log ends at the first torn or corrupted record, the next append
+// overwrites it.
+func Open(store Store) (*Log, error) {
+	ids, err := store.Segments()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return Create(store)
+	}
+
+	l := newLog(store, base.LSN(ids[0]))
+
+	for _, id := range ids {
+		file, err := store.Open(id)
+		if err != nil {
+			return nil, err
+		}
+
+		l.segments = append(l.segments, &segment{base: base.LSN(id), file: file})
+
+		if err := readHeader(file, base.LSN(id)); err != nil {
+			_ = l.closeSegments()
+			return nil, err
+		}
+	}
+
+	for {
+		rec, size, err := l.readAt(l.next)
+		if err != nil {
+			break
+		}
+
+		l.lastTxID = max(l.lastTxID, rec.TxID)
+		l.next += base.LSN(size)
+	}
+
+	// segments started after a torn record hold nothing reachable
+	for len(l.segments) > 1 && l.segments[len(l.segments)-1].base > l.next {
+		last := l.segments[len(l.segments)-1]
+		l.segments = l.segments[:len(l.segments)-1]
+
+		_ = last.file.Close()
+
+		if err := store.Remove(uint64(last.base)); err != nil {
+			return nil, err
+		}
+	}
+
+	l.flushed = l.next
+	l.pendingLSN = l.next
+
+	return l, nil
+}
+
+func readHeader(file faces.IOOperator, start base.LSN) error {
+	header := make([]byte, headerSize)
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(file, header); err != nil {
+		return errors.ErrNotALog
+	}
+
+	le := binary.LittleEndian
+
+	if string(header[:8]) != constants.LogMagic ||
+		le.Uint32(header[24:]) != crc32.Checksum(header[:24], castagnoli) ||
+		base.LSN(le.Uint64(header[16:])) != start {
+		return errors.ErrNotALog
+	}
+
+	if version := le.Uint32(header[8:]); version != constants.LogVersion {
+		return &errors.HeaderMismatchError{Field: "log version", Expected: constants.LogVersion, Found: uint64(version)}
+	}
+
+	return nil
+}
+
+// addSegment creates the segment starting at start, ioLock must be held
+// unless the log is not shared yet
+func (l *Log) addSegment(start base.LSN) error {
+	file, err := l.store.Create(uint64(start))
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, headerSize)
+	le := binary.LittleEndian
+
+	copy(header, constants.LogMagic)
+	le.PutUint32(header[8:], constants.LogVersion)
+	le.PutUint64(header[16:], uint64(start))
+	le.PutUint32(header[24:], crc32.Checksum(header[:24], castagnoli))
+
+	if err := writeSynced(file, 0, header); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	l.segments = append(l.segments, &segment{base: start, file: file})
+
+	return nil
+}
+
+func writeSynced(file faces.IOOperator, offset int64, data []byte) error {
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// segmentFor returns the segment holding lsn, ioLock must be held
+func (l *Log) segmentFor(lsn base.LSN) *segment {
+	for i := len(l.segments) - 1; i > 0; i-- {
+		if l.segments[i].base <= lsn {
+			return l.segments[i]
+		}
+	}
+
+	return l.segments[0]
+}
+
+// write stores records starting at start, in a new segment when the
+// current one would grow past the segment size
+func (l *Log) write(start base.LSN, data []byte) error {
+	l.ioLock.Lock()
+	defer l.ioLock.Unlock()
+
+	current := l.segments[len(l.segments)-1]
+
+	if start > current.base && int64(start-current.base)+int64(len(data)) > l.segmentSize {
+		if err := l.addSegment(start); err != nil {
+			return err
+		}
+
+		current = l.segments[len(l.segments)-1]
+	}
+
+	return writeSynced(current.file, int64(start-current.base)+headerSize, data)
+}
+
+// readAt reads the record stored at lsn and returns it with its size
+func (l *Log) readAt(lsn base.LSN) (*Record, int, error) {
+	l.ioLock.Lock()
+	defer l.ioLock.Unlock()
+
+	seg := l.segmentFor(lsn)
+
+	if _, err := seg.file.Seek(int64(lsn-seg.base)+headerSize, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+
+	frame := make([]byte, frameSize)
+	if _, err := io.ReadFull(seg.file, frame); err != nil {
+		return nil, 0, err
+	}
+
+	length := binary.LittleEndian.Uint32(frame)
+	if length < fixedSize || length > maxRecordSize {
+		return nil, 0, errors.ErrCorruptedRecord
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(seg.file, body); err != nil {
+		return nil, 0, err
+	}
+
+	if binary.LittleEndian.Uint32(frame[4:]) != crc32.Checksum(body, castagnoli) {
+		return nil, 0, errors.ErrCorruptedRecord
+	}
+
+	rec, err := decode(body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// a stale record left behind an overwritten tail is at the wrong place
+	if rec.LSN != lsn {
+		return nil, 0, errors.ErrCorruptedRecord
+	}
+
+	return rec, frameSize + int(length), nil
+}
+
+// SetSegmentSize sets the size after which records go to a new segment
+func (l *Log) SetSegmentSize(size int64) {
+	l.ioLock.Lock()
+	defer l.ioLock.Unlock()
+
+	l.segmentSize = size
+}
+
+// Append assigns the next LSN to rec and buffers it, it is durable once
+// Flush returns for that LSN
+func (l *Log) Append(rec *Record) (base.LSN, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.err != nil {
+		return 0, l.err
+	}
+
+	rec.LSN = l.next
+	l.pending = rec.encode(l.pending)
+	l.next += base.LSN(rec.size())
+	l.lastTxID = max(l.lastTxID, rec.TxID)
+
+	return rec.LSN, nil
+}
+
+// Flush returns once the record at lsn and every record before it are on
+// disk. Callers arriving while a flush runs are served by the next one.
+func (l *Log) Flush(lsn base.LSN) error {
+	return l.flushTo(lsn + 1)
+}
+
+// FlushAll makes every record appended so far durable
+func (l *Log) FlushAll() error {
+	l.lock.Lock()
+	end := l.next
+	l.lock.Unlock()
+
+	return l.flushTo(end)
+}
+
+// flushTo makes every record starting below end durable
+func (l *Log) flushTo(end base.LSN) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for {
+		if l.err != nil {
+			return l.err
+		}
+
+		if end <= l.flushed || l.next == l.flushed {
+			return nil
+		}
+
+		if !l.flushing {
+			break
+		}
+
+		l.flushDone.Wait()
+	}
+
+	var (
+		start = l.pendingLSN
+		data  = l.pending
+		upTo  = l.next
+	)
+
+	l.flushing = true
+	l.pending = nil
+	l.pendingLSN = upTo
+	l.lock.Unlock()
+
+	err := l.write(start, data)
+
+	l.lock.Lock()
+	l.flushing = false
+
+	if err != nil {
+		l.err = err
+	} else {
+		l.flushed = upTo
+	}
+
+	l.flushDone.Broadcast()
+
+	return err
+}
+
+// Read returns the record at lsn, flushing the log first when it is
+// still buffered
+func (l *Log) Read(lsn base.LSN) (*Record, error) {
+	if err := l.Flush(lsn); err != nil {
+		return nil, err
+	}
+
+	rec, _, err := l.readAt(lsn)
+
+	return rec, err
+}
+
+// Truncate drops the segments that only hold records older than upTo.
+// The segment being written is always kept.
+func (l *Log) Truncate(upTo base.LSN) error {
+	l.ioLock.Lock()
+	defer l.ioLock.Unlock()
+
+	for len(l.segments) > 1 && l.segments[1].base <= upTo {
+		old := l.segments[0]
+
+		if err := old.file.Close(); err != nil {
+			return err
+		}
+
+		if err := l.store.Remove(uint64(old.base)); err != nil {
+			return err
+		}
+
+		l.segments = l.segments[1:]
+	}
+
+	l.lock.Lock()
+	l.first = l.segments[0].base
+	l.lock.Unlock()
+
+	return nil
+}
+
+// NextLSN returns the LSN the next appended record gets
+func (l *Log) NextLSN() base.LSN {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.next
+}
+
+// FlushedLSN returns the end of the durable part of the log
+func (l *Log) FlushedLSN() base.LSN {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.flushed
+}
+
+// FirstLSN returns the LSN of the oldest record kept in the log
+func (l *Log) FirstLSN() base.LSN {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.first
+}
+
+// Size returns the number of bytes kept in the log
+func (l *Log) Size() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return int64(l.next - l.first)
+}
+
+// LastTxID returns the highest transaction id found in the log
+func (l *Log) LastTxID() uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.lastTxID
+}
+
+func (l *Log) closeSegments() error {
+	var err error
+
+	for _, seg := range l.segments {
+		if cErr := seg.file.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+
+	return err
+}
+
+// Close flushes the log and closes its segments
+func (l *Log) Close() error {
+	if err := l.FlushAll(); err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	l.err = errors.ErrLogClosed
+	l.lock.Unlock()
+
+	l.ioLock.Lock()
+	defer l.ioLock.Unlock()
+
+	return l.closeSegments()
+}
@@ -0,0 +1,40 @@
+package wal
+
+import (
+	"io"
+
+	"github.com/dark-vinci/nildb/base"
+)
+
+// Reader walks the durable part of the log in LSN order
+type Reader struct {
+	log  *Log
+	next base.LSN
+	end  base.LSN
+}
+
+// NewReader returns a reader starting at the record at from, or at the
+// first record when from is older than the log
+func (l *Log) NewReader(from base.LSN) *Reader {
+	return &Reader{
+		log:  l,
+		next: max(from, l.FirstLSN()),
+		end:  l.FlushedLSN(),
+	}
+}
+
+// Next returns the next record, io.EOF once the end of the log is reached
+func (r *Reader) Next() (*Record, error) {
+	if r.next >= r.end {
+		return nil, io.EOF
+	}
+
+	rec, size, err := r.log.readAt(r.next)
+	if err != nil {
+		return nil, err
+	}
+
+	r.next += base.LSN(size)
+
+	return rec, nil
+}
@@ -0,0 +1,284 @@
+package wal
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/errors"
+)
+
+type RecordType uint8
+
+const (
+	BeginRecord RecordType = iota + 1
+	UpdateRecord
+	CommitRecord
+	AbortRecord
+	// CompensationRecord undoes an update during rollback, it is redone but never undone
+	CompensationRecord
+	// CheckpointRecord saves the dirty page and active transaction tables
+	CheckpointRecord
+)
+
+// Diff is one changed byte range of a page, Before is empty in compensation records
+type Diff struct {
+	Offset uint32
+	Before []byte
+	After  []byte
+}
+
+// Record is one entry of the log. Update and compensation records are
+// physiological: they name a page and the byte ranges changed inside it.
+type Record struct {
+	LSN      base.LSN
+	PrevLSN  base.LSN // previous record of the same transaction
+	TxID     uint64   // 0 for changes made outside a transaction, they are never undone
+	Type     RecordType
+	Page     base.PageNumber
+	UndoNext base.LSN // next record to undo once this compensation is applied
+	Diffs    []Diff
+
+	Checkpoint *Checkpoint // only in checkpoint records
+}
+
+// Checkpoint is what a checkpoint record saves. Recovery starts its
+// tables from the last one instead of from an empty state.
+type Checkpoint struct {
+	Dirty  map[base.PageNumber]base.LSN // cached dirty pages and the first record that dirtied them
+	Active map[uint64]base.LSN          // running transactions and their last record
+}
+
+const (
+	// frameSize is the length and checksum in front of every record
+	frameSize = 8
+	// fixedSize is the part of the body every record has
+	fixedSize = 8 + 8 + 8 + 1
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func (r *Record) hasPage() bool {
+	return r.Type == UpdateRecord || r.Type == CompensationRecord
+}
+
+// size returns the number of bytes the record takes in the log
+func (r *Record) size() int {
+	size := frameSize + fixedSize
+
+	if r.hasPage() {
+		size += 8 + 8 + 2
+
+		for _, d := range r.Diffs {
+			size += 4 + 4 + 4 + len(d.Before) + len(d.After)
+		}
+	}
+
+	if r.Type == CheckpointRecord {
+		size += 4 + 4 + 16*(len(r.Checkpoint.Dirty)+len(r.Checkpoint.Active))
+	}
+
+	return size
+}
+
+// encode appends the framed record to buf
+func (r *Record) encode(buf []byte) []byte {
+	start := len(buf)
+	le := binary.LittleEndian
+
+	buf = le.AppendUint32(buf, uint32(r.size()-frameSize))
+	buf = le.AppendUint32(buf, 0)
+	buf = le.AppendUint64(buf, uint64(r.LSN))
+	buf = le.AppendUint64(buf, uint64(r.PrevLSN))
+	buf = le.AppendUint64(buf, r.TxID)
+	buf = append(buf, byte(r.Type))
+
+	if r.hasPage() {
+		buf = le.AppendUint64(buf, uint64(r.Page))
+		buf = le.AppendUint64(buf, uint64(r.UndoNext))
+		buf = le.AppendUint16(buf, uint16(len(r.Diffs)))
+
+		for _, d := range r.Diffs {
+			buf = le.AppendUint32(buf, d.Offset)
+			buf = le.AppendUint32(buf, uint32(len(d.Before)))
+			buf = le.AppendUint32(buf, uint32(len(d.After)))
+			buf = append(buf, d.Before...)
+			buf = append(buf, d.After...)
+		}
+	}
+
+	if r.Type == CheckpointRecord {
+		buf = le.AppendUint32(buf, uint32(len(r.Checkpoint.Dirty)))
+		buf = le.AppendUint32(buf, uint32(len(r.Checkpoint.Active)))
+
+		for pn, lsn := range r.Checkpoint.Dirty {
+			buf = le.AppendUint64(buf, uint64(pn))
+			buf = le.AppendUint64(buf, uint64(lsn))
+		}
+
+		for tx, lsn := range r.Checkpoint.Active {
+			buf = le.AppendUint64(buf, tx)
+			buf = le.AppendUint64(buf, uint64(lsn))
+		}
+	}
+
+	le.PutUint32(buf[start+4:], crc32.Checksum(buf[start+frameSize:], castagnoli))
+
+	return buf
+}
+
+// decode parses the body of a record whose checksum was already verified
+func decode(body []byte) (*Record, error) {
+	if len(body) < fixedSize {
+		return nil, errors.ErrCorruptedRecord
+	}
+
+	le := binary.LittleEndian
+
+	r := &Record{
+		LSN:     base.LSN(le.Uint64(body[0:])),
+		PrevLSN: base.LSN(le.Uint64(body[8:])),
+		TxID:    le.Uint64(body[16:]),
+		Type:    RecordType(body[24]),
+	}
+
+	body = body[fixedSize:]
+
+	if r.Type == CheckpointRecord {
+		return decodeCheckpoint(r, body)
+	}
+
+	if !r.hasPage() {
+		return r, nil
+	}
+
+	if len(body) < 18 {
+		return nil, errors.ErrCorruptedRecord
+	}
+
+	r.Page = base.PageNumber(le.Uint64(body[0:]))
+	r.UndoNext = base.LSN(le.Uint64(body[8:]))
+	count := int(le.Uint16(body[16:]))
+	body = body[18:]
+
+	r.Diffs = make([]Diff, 0, count)
+
+	for i := 0; i < count; i++ {
+		if len(body) < 12 {
+			return nil, errors.ErrCorruptedRecord
+		}
+
+		var (
+			offset = le.Uint32(body[0:])
+			before = int(le.Uint32(body[4:]))
+			after  = int(le.Uint32(body[8:]))
+		)
+
+		body = body[12:]
+
+		if len(body) < before+after {
+			return nil, errors.ErrCorruptedRecord
+		}
+
+		r.Diffs = append(r.Diffs, Diff{
+			Offset: offset,
+			Before: body[:before:before],
+			After:  body[before : before+after : before+after],
+		})
+
+		body = body[before+after:]
+	}
+
+	return r, nil
+}
+
+func decodeCheckpoint(r *Record, body []byte) (*Record, error) {
+	if len(body) < 8 {
+		return nil, errors.ErrCorruptedRecord
+	}
+
+	le := binary.LittleEndian
+
+	var (
+		dirty  = int(le.Uint32(body[0:]))
+		active = int(le.Uint32(body[4:]))
+	)
+
+	body = body[8:]
+
+	if len(body) != 16*(dirty+active) {
+		return nil, errors.ErrCorruptedRecord
+	}
+
+	r.Checkpoint = &Checkpoint{
+		Dirty:  make(map[base.PageNumber]base.LSN, dirty),
+		Active: make(map[uint64]base.LSN, active),
+	}
+
+	for i := 0; i < dirty; i++ {
+		r.Checkpoint.Dirty[base.PageNumber(le.Uint64(body))] = base.LSN(le.Uint64(body[8:]))
+		body = body[16:]
+	}
+
+	for i := 0; i < active; i++ {
+		r.Checkpoint.Active[le.Uint64(body)] = base.LSN(le.Uint64(body[8:]))
+		body = body[16:]
+	}
+
+	return r, nil
+}
+
+// Apply writes the after image of every diff into page
+func (r *Record) Apply(page []byte) {
+	for _, d := range r.Diffs {
+		copy(page[d.Offset:], d.After)
+	}
+}
+
+// Revert writes the before image of every diff into page
+func (r *Record) Revert(page []byte) {
+	for _, d := range r.Diffs {
+		copy(page[d.Offset:], d.Before)
+	}
+}
+
+// Compare returns the byte ranges where after differs from before. Ranges
+// closer than gap bytes are merged so small edits do not each cost a header.
+func Compare(before, after []byte, gap int) []Diff {
+	var (
+		diffs []Diff
+		start = -1
+		last  = -1
+	)
+
+	emit := func() {
+		diffs = append(diffs, Diff{
+			Offset: uint32(start),
+			Before: append([]byte(nil), before[start:last+1]...),
+			After:  append([]byte(nil), after[start:last+1]...),
+		})
+	}
+
+	for i := range after {
+		if before[i] == after[i] {
+			continue
+		}
+
+		if start >= 0 && i-last > gap {
+			emit()
+			start = -1
+		}
+
+		if start < 0 {
+			start = i
+		}
+
+		last = i
+	}
+
+	if start >= 0 {
+		emit()
+	}
+
+	return diffs
+}
@@ -0,0 +1,148 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dark-vinci/nildb/files"
+	"github.com/dark-vinci/nildb/interfaces"
+)
+
+// Store keeps the segments of a log. A segment is named by the LSN of its
+// first record.
+type Store interface {
+	Segments() ([]uint64, error) // existing segments in LSN order
+	Open(id uint64) (faces.IOOperator, error)
+	Create(id uint64) (faces.IOOperator, error)
+	Remove(id uint64) error
+}
+
+const segmentExt = ".log"
+
+// DirStore keeps every segment in its own file inside a directory
+type DirStore struct {
+	dir string
+}
+
+var _ Store = (*DirStore)(nil)
+
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{dir: dir}
+}
+
+func (d *DirStore) path(id uint64) string {
+	return filepath.Join(d.dir, fmt.Sprintf("%016x%s", id, segmentExt))
+}
+
+func (d *DirStore) Segments() ([]uint64, error) {
+	entries, err := os.ReadDir(d.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint64
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		if id, err := strconv.ParseUint(name, 16, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+func (d *DirStore) Open(id uint64) (faces.IOOperator, error) {
+	return files.NewFile(d.path(id)).Open()
+}
+
+func (d *DirStore) Create(id uint64) (faces.IOOperator, error) {
+	return files.NewFile(d.path(id)).Create()
+}
+
+func (d *DirStore) Remove(id uint64) error {
+	return files.NewFile(d.path(id)).Remove()
+}
+
+// MemStore keeps segments in memory, they survive Close so a log can be
+// reopened the way it would be after a crash
+type MemStore struct {
+	lock     sync.Mutex
+	segments map[uint64]*files.MemFile
+}
+
+var _ Store = (*MemStore)(nil)
+
+func NewMemStore() *MemStore {
+	return &MemStore{segments: make(map[uint64]*files.MemFile)}
+}
+
+// memSegment ignores Close, MemFile.Close would drop its content
+type memSegment struct {
+	*files.MemFile
+}
+
+func (memSegment) Close() error {
+	return nil
+}
+
+func (m *MemStore) Segments() ([]uint64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ids := make([]uint64, 0, len(m.segments))
+
+	for id := range m.segments {
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+func (m *MemStore) Open(id uint64) (faces.IOOperator, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	file, ok := m.segments[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return memSegment{file}, nil
+}
+
+func (m *MemStore) Create(id uint64) (faces.IOOperator, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	file := &files.MemFile{}
+	m.segments[id] = file
+
+	return memSegment{file}, nil
+}
+
+func (m *MemStore) Remove(id uint64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.segments, id)
+
+	return nil
+}
@@ -0,0 +1,279 @@
+package wal
+
+import (
+	"bytes"
+	"io"
+	"maps"
+	"sync"
+	"testing"
+
+	"github.com/dark-vinci/nildb/base"
+	"github.com/dark-vinci/nildb/errors"
+)
+
+func newTestLog(t *testing.T) (*Log, *MemStore) {
+	t.Helper()
+
+	store := NewMemStore()
+
+	l, err := Create(store)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	return l, store
+}
+
+func update(tx uint64, pn base.PageNumber, before, after string) *Record {
+	return &Record{
+		TxID:  tx,
+		Type:  UpdateRecord,
+		Page:  pn,
+		Diffs: []Diff{{Offset: 16, Before: []byte(before), After: []byte(after)}},
+	}
+}
+
+// TestAppendAndReopen verifies flushed records are read back after reopening
+func TestAppendAndReopen(t *testing.T) {
+	l, store := newTestLog(t)
+
+	records := []*Record{
+		{TxID: 1, Type: BeginRecord},
+		update(1, 3, "old", "new"),
+		{TxID: 1, Type: CommitRecord},
+		{TxID: 2, Type: CompensationRecord, Page: 4, UndoNext: 7, Diffs: []Diff{{Offset: 8, After: []byte("x")}}},
+		{Type: CheckpointRecord, Checkpoint: &Checkpoint{
+			Dirty:  map[base.PageNumber]base.LSN{3: 30, 4: 40},
+			Active: map[uint64]base.LSN{2: 50},
+		}},
+	}
+
+	var prev base.LSN
+
+	for _, rec := range records {
+		rec.PrevLSN = prev
+
+		lsn, err := l.Append(rec)
+		if err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+
+		if lsn <= prev {
+			t.Fatalf("expected LSNs to grow, got %d after %d", lsn, prev)
+		}
+
+		prev = lsn
+	}
+
+	if err := l.FlushAll(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	reopened, err := Open(store)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	if reopened.NextLSN() != l.NextLSN() || reopened.LastTxID() != 2 {
+		t.Errorf("expected next LSN %d and last tx 2, got %d and %d", l.NextLSN(), reopened.NextLSN(), reopened.LastTxID())
+	}
+
+	r := reopened.NewReader(0)
+
+	for _, want := range records {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+
+		if got.LSN != want.LSN || got.PrevLSN != want.PrevLSN || got.Type != want.Type ||
+			got.Page != want.Page || got.UndoNext != want.UndoNext || len(got.Diffs) != len(want.Diffs) {
+			t.Fatalf("expected %+v, got %+v", want, got)
+		}
+
+		for i := range want.Diffs {
+			if !bytes.Equal(got.Diffs[i].Before, want.Diffs[i].Before) || !bytes.Equal(got.Diffs[i].After, want.Diffs[i].After) {
+				t.Errorf("diff %d of record %d differs", i, want.LSN)
+			}
+		}
+
+		if want.Checkpoint != nil && (!maps.Equal(got.Checkpoint.Dirty, want.Checkpoint.Dirty) ||
+			!maps.Equal(got.Checkpoint.Active, want.Checkpoint.Active)) {
+			t.Errorf("expected checkpoint %+v, got %+v", want.Checkpoint, got.Checkpoint)
+		}
+	}
+
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF at the end of the log, got %v", err)
+	}
+}
+
+// TestTornTail verifies the log ends at the first record that did not fully reach the file
+func TestTornTail(t *testing.T) {
+	l, store := newTestLog(t)
+	file := store.segments[1]
+
+	first, _ := l.Append(update(0, 1, "a", "b"))
+	if err := l.Flush(first); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	second, _ := l.Append(update(0, 2, "c", "d"))
+	if err := l.Flush(second); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	// cut the second record in half
+	size, _ := file.Seek(0, io.SeekEnd)
+	data := make([]byte, size)
+	file.Seek(0, io.SeekStart)
+	io.ReadFull(file, data)
+	file.Truncate()
+	file.Write(data[:size-5])
+
+	reopened, err := Open(store)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	if reopened.NextLSN() != second {
+		t.Fatalf("expected the log to end at %d, got %d", second, reopened.NextLSN())
+	}
+
+	// the next record takes the place of the torn one
+	lsn, _ := reopened.Append(update(0, 3, "e", "f"))
+	if err := reopened.Flush(lsn); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	rec, err := reopened.Read(lsn)
+	if err != nil || rec.Page != 3 {
+		t.Errorf("expected the new record at %d, got %+v, %v", lsn, rec, err)
+	}
+}
+
+// TestGroupCommit verifies concurrent flushes all return with their records durable
+func TestGroupCommit(t *testing.T) {
+	l, _ := newTestLog(t)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func(tx uint64) {
+			defer wg.Done()
+
+			lsn, err := l.Append(&Record{TxID: tx, Type: CommitRecord})
+			if err != nil {
+				t.Errorf("append failed: %v", err)
+				return
+			}
+
+			if err := l.Flush(lsn); err != nil {
+				t.Errorf("flush failed: %v", err)
+				return
+			}
+
+			if l.FlushedLSN() <= lsn {
+				t.Errorf("record %d returned before being flushed", lsn)
+			}
+		}(uint64(i + 1))
+	}
+
+	wg.Wait()
+}
+
+// TestSegments verifies the log rolls over to new segments and drops the old ones
+func TestSegments(t *testing.T) {
+	l, store := newTestLog(t)
+	l.SetSegmentSize(256)
+
+	var lsns []base.LSN
+
+	for i := 0; i < 40; i++ {
+		lsn, _ := l.Append(update(0, base.PageNumber(i), "before", "after"))
+		if err := l.Flush(lsn); err != nil {
+			t.Fatalf("flush failed: %v", err)
+		}
+
+		lsns = append(lsns, lsn)
+	}
+
+	ids, _ := store.Segments()
+	if len(ids) < 3 {
+		t.Fatalf("expected several segments, got %d", len(ids))
+	}
+
+	keep := lsns[30]
+	if err := l.Truncate(keep); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+
+	left, _ := store.Segments()
+	if len(left) >= len(ids) || base.LSN(left[0]) > keep || l.FirstLSN() != base.LSN(left[0]) {
+		t.Fatalf("expected old segments dropped up to %d, got %v", keep, left)
+	}
+
+	reopened, err := Open(store)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	if reopened.FirstLSN() != l.FirstLSN() || reopened.NextLSN() != l.NextLSN() {
+		t.Errorf("expected LSNs %d to %d, got %d to %d", l.FirstLSN(), l.NextLSN(), reopened.FirstLSN(), reopened.NextLSN())
+	}
+
+	for _, lsn := range lsns[30:] {
+		if rec, err := reopened.Read(lsn); err != nil || rec.LSN != lsn {
+			t.Errorf("expected record %d to be kept, got %+v, %v", lsn, rec, err)
+		}
+	}
+}
+
+// TestOpenRejectsForeignFile verifies a file that is not a log is refused
+func TestOpenRejectsForeignFile(t *testing.T) {
+	store := NewMemStore()
+	file, _ := store.Create(1)
+	file.Write(bytes.Repeat([]byte("x"), 64))
+
+	if _, err := Open(store); err != errors.ErrNotALog {
+		t.Errorf("expected ErrNotALog, got %v", err)
+	}
+}
+
+// TestCompare verifies diffs cover exactly the changed bytes and merge close ranges
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		diffs  int
+	}{
+		{name: "No change", before: "abcdefgh", after: "abcdefgh", diffs: 0},
+		{name: "Single range", before: "abcdefgh", after: "abXYefgh", diffs: 1},
+		{name: "Close ranges merge", before: "abcdefgh", after: "XbcdeYgh", diffs: 1},
+		{name: "Far ranges stay apart", before: "a" + string(make([]byte, 40)) + "b", after: "X" + string(make([]byte, 40)) + "Y", diffs: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs := Compare([]byte(tt.before), []byte(tt.after), 8)
+
+			if len(diffs) != tt.diffs {
+				t.Fatalf("expected %d diffs, got %d", tt.diffs, len(diffs))
+			}
+
+			page := []byte(tt.before)
+			rec := &Record{Diffs: diffs}
+
+			if rec.Apply(page); string(page) != tt.after {
+				t.Errorf("applying diffs gave %q", page)
+			}
+
+			if rec.Revert(page); string(page) != tt.before {
+				t.Errorf("reverting diffs gave %q", page)
+			}
+		})
+	}
+}